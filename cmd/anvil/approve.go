@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/foundry-ci/foundry/internal/approval"
+	"github.com/foundry-ci/foundry/internal/config"
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+const (
+	// approvalsDir holds the state of runs paused on approval steps.
+	approvalsDir = ".foundry/approvals"
+
+	// exitPendingApproval is the exit code of a run that stopped to wait
+	// for an approval, so CI can tell it apart from a failure.
+	exitPendingApproval = 3
+)
+
+// --- approve ---
+
+func cmdApprove(args []string) {
+	fs := flag.NewFlagSet("approve", flag.ContinueOnError)
+	by := fs.String("by", approval.CurrentUser(), "name recorded as the approver")
+	reject := fs.Bool("reject", false, "reject the step instead of approving it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: anvil approve [flags] <run-id> <step>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	setupLogger(false)
+
+	runID, stepID := fs.Arg(0), fs.Arg(1)
+	decision := exec.Approval{By: *by, At: util.NowUTC(), Approved: !*reject}
+	if err := approval.Decide(approvalsDir, runID, stepID, decision); err != nil {
+		slog.Error("failed to record approval", "error", err)
+		os.Exit(1)
+	}
+
+	verb := "Approved"
+	if *reject {
+		verb = "Rejected"
+	}
+	fmt.Printf("%s %s in run %s as %s\n", verb, stepID, runID, *by)
+	fmt.Println("Continue the run with: anvil run --resume --run-id " + runID)
+}
+
+// pausedRun loads the paused run to resume: runID if given, otherwise the
+// latest one of profile. It warns if the config has changed since, as the
+// run resumes with the plan it was started with.
+func pausedRun(configPath, profile, runID string) *approval.State {
+	var state *approval.State
+	var err error
+	if runID != "" {
+		state, err = approval.Load(approvalsDir, runID)
+	} else {
+		state, err = approval.Latest(approvalsDir, profile)
+	}
+	if err != nil {
+		slog.Error("cannot resume", "error", err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err == nil {
+		sum := sha256.Sum256(cfg.Content())
+		if hex.EncodeToString(sum[:]) != state.Plan.ConfigHash {
+			slog.Warn("config changed since the run was paused; resuming with the original plan", "run", state.RunID)
+		}
+	} else {
+		slog.Warn("config no longer loads; resuming with the original plan", "run", state.RunID, "error", err)
+	}
+
+	if pending := state.Pending(); len(pending) > 0 {
+		slog.Info("approvals still undecided", "run", state.RunID, "steps", pending)
+	}
+	return state
+}
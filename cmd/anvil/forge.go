@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/forge"
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// forgeFlushTimeout bounds how long a finished run waits for its statuses
+// to be sent, such as when the forge is rate limiting.
+const forgeFlushTimeout = 30 * time.Second
+
+// forgeFlags registers the flag selecting the forge to report statuses to.
+func forgeFlags(fs *flag.FlagSet) *string {
+	return fs.String("forge", os.Getenv("ANVIL_FORGE"), "report run and step statuses to the commit on this forge: auto, github, github-checks, gitlab or gitea (default $ANVIL_FORGE)")
+}
+
+// startForge reports the run and its steps as queued on the commit's
+// forge. It returns nil if reporting is off.
+func startForge(kind string, p *plan.Plan) *forge.Reporter {
+	if kind == "" {
+		return nil
+	}
+	cfg, err := forge.Detect(kind, os.Getenv)
+	if err != nil {
+		slog.Error("invalid forge configuration", "error", err)
+		os.Exit(1)
+	}
+	f, err := forge.New(cfg)
+	if err != nil {
+		slog.Error("invalid forge configuration", "error", err)
+		os.Exit(1)
+	}
+	r := forge.NewReporter(f, "anvil/"+p.Profile, forge.DefaultInterval)
+	r.Start(p)
+	return r
+}
+
+// observe chains the reporter after any observer of opts.
+func observe(opts *exec.Options, r *forge.Reporter) {
+	if r == nil {
+		return
+	}
+	next := opts.OnEvent
+	opts.OnEvent = func(ev exec.Event) {
+		if next != nil {
+			next(ev)
+		}
+		r.Handle(ev)
+	}
+}
+
+// finishForge reports the run's outcome and waits for outstanding statuses
+// to be sent. Failures are logged but do not change the outcome of the run.
+func finishForge(r *forge.Reporter, results *exec.ExecutionResult) {
+	if r == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), forgeFlushTimeout)
+	defer cancel()
+	r.Finish(ctx, results)
+}
+
+// failForge reports that the run failed with err before it could finish, so
+// its statuses are not left running, and waits like finishForge.
+func failForge(r *forge.Reporter, err error) {
+	if r == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), forgeFlushTimeout)
+	defer cancel()
+	r.Fail(ctx, err)
+}
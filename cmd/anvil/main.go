@@ -4,15 +4,37 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/foundry-ci/foundry/internal/approval"
 	"github.com/foundry-ci/foundry/internal/config"
 	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/lock"
+	"github.com/foundry-ci/foundry/internal/notify"
 	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/report"
+	"github.com/foundry-ci/foundry/internal/runs"
+	"github.com/foundry-ci/foundry/internal/tui"
+	"github.com/foundry-ci/foundry/internal/util"
+	"github.com/foundry-ci/foundry/internal/vcs"
+)
+
+const (
+	// runsDir holds one directory per run with its plan, results, logs and
+	// metadata. It is locked while a run or watch session is active.
+	runsDir = ".foundry/runs"
+
+	// planOutDir receives the plan written by "anvil plan".
+	planOutDir = ".foundry/out"
 )
 
 var (
@@ -36,6 +58,22 @@ func main() {
 		cmdPlan(os.Args[2:])
 	case "run":
 		cmdRun(os.Args[2:])
+	case "watch":
+		cmdWatch(os.Args[2:])
+	case "approve":
+		cmdApprove(os.Args[2:])
+	case "runs":
+		cmdRuns(os.Args[2:])
+	case "report":
+		cmdReport(os.Args[2:])
+	case "stats":
+		cmdStats(os.Args[2:])
+	case "migrate":
+		cmdMigrate(os.Args[2:])
+	case "validate":
+		cmdValidate(os.Args[2:])
+	case "schema":
+		cmdSchema(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", os.Args[1])
 		printUsage()
@@ -53,6 +91,14 @@ Commands:
   doctor     Check environment and configuration
   plan       Generate an execution plan
   run        Execute the plan
+  watch      Re-run affected steps when their inputs change
+  approve    Approve a step of a run waiting for approval
+  runs       List and inspect past runs
+  report     Render a run as JUnit, TAP, Markdown, HTML or a trace
+  stats      Summarise step durations and reliability across runs
+  migrate    Rewrite the config file in the current format version
+  validate   Report every problem in the config file, with its position
+  schema     Print the JSON Schema of the config file
 
 Use "anvil <command> --help" for more information.
 `)
@@ -110,13 +156,20 @@ func cmdDoctor(args []string) {
 		fmt.Printf("PASS  %s exists\n", *configPath)
 	}
 
-	// Check 2: config parses and validates.
-	if _, err := config.Load(*configPath); err != nil {
-		fmt.Printf("FAIL  config validation: %v\n", err)
+	// Check 2: config parses and validates, and matches the schema.
+	cfg, ds := config.Check(*configPath)
+	if cfg == nil {
 		allPass = false
 	} else {
 		fmt.Printf("PASS  config parses and validates\n")
 	}
+	for _, d := range ds {
+		if d.Severity == config.SeverityError {
+			fmt.Printf("FAIL  %s: %s\n", d.Position(), d.Message)
+		} else {
+			fmt.Printf("WARN  %s: %s\n", d.Position(), d.Message)
+		}
+	}
 
 	// Check 3: go is available.
 	if err := exec.CheckTool("go", "version"); err != nil {
@@ -139,29 +192,29 @@ func cmdPlan(args []string) {
 	profileName := fs.String("profile", "default", "profile name")
 	configPath := fs.String("config", ".foundry.yaml", "config file path")
 	jsonOut := fs.Bool("json", false, "output as JSON")
+	explain := fs.Bool("explain", false, "show the order profiles are merged in and the profile each step comes from")
+	sel := selectorFlags(fs)
+	changedSince := fs.String("changed-since", "", "skip steps whose paths filters match no file changed since this git ref")
 	if err := fs.Parse(args); err != nil {
 		os.Exit(1)
 	}
 
+	if sel.NoDeps && len(sel.Only) == 0 {
+		fmt.Fprintln(os.Stderr, "--no-deps requires --only: it runs the steps --only matches without their dependencies")
+		os.Exit(1)
+	}
+
 	setupLogger(*jsonOut)
 
 	cfg, steps, configData := loadAndResolve(*configPath, *profileName)
-
-	// Validate steps against policy.
+	origins := make(map[string]string, len(steps))
 	for _, s := range steps {
-		if err := cfg.Policy.ValidateStep(s.Type, s.ID); err != nil {
-			slog.Error("policy violation", "error", err)
-			os.Exit(1)
-		}
+		origins[s.ID] = s.Origin()
 	}
+	p := buildPlan(cfg, *profileName, steps, configData, *sel)
+	skipUnchanged(p, *changedSince)
 
-	p, err := plan.Build(cfg.Project.Name, *profileName, steps, configData)
-	if err != nil {
-		slog.Error("failed to build plan", "error", err)
-		os.Exit(1)
-	}
-
-	outDir := ".foundry/out"
+	outDir := planOutDir
 	if writeErr := plan.WritePlan(p, outDir); writeErr != nil {
 		slog.Error("failed to write plan", "error", writeErr)
 		os.Exit(1)
@@ -173,8 +226,27 @@ func cmdPlan(args []string) {
 		_ = enc.Encode(p)
 	} else {
 		fmt.Printf("Plan generated: %d steps, profile=%s\n", len(p.Steps), *profileName)
+		if *explain {
+			order, _ := config.Linearize(cfg, *profileName)
+			fmt.Printf("Profile order: %s\n", strings.Join(order, " > "))
+		}
+		skips := make(map[string]string, len(p.Steps))
+		for _, s := range p.Steps {
+			skips[s.ID] = s.Skip
+		}
 		fmt.Println("Execution order:")
 		for i, id := range p.Order {
+			var notes []string
+			if *explain {
+				notes = append(notes, "from "+origins[id])
+			}
+			if reason := skips[id]; reason != "" {
+				notes = append(notes, "skipped: "+reason)
+			}
+			if len(notes) > 0 {
+				fmt.Printf("  %d. %s (%s)\n", i+1, id, strings.Join(notes, "; "))
+				continue
+			}
 			fmt.Printf("  %d. %s\n", i+1, id)
 		}
 		fmt.Println("Written to .foundry/out/plan.json")
@@ -189,52 +261,144 @@ func cmdRun(args []string) {
 	configPath := fs.String("config", ".foundry.yaml", "config file path")
 	jobs := fs.Int("jobs", 4, "max parallel jobs")
 	jsonOut := fs.Bool("json", false, "output as JSON")
+	sel := selectorFlags(fs)
+	changedSince := fs.String("changed-since", "", "skip steps whose paths filters match no file changed since this git ref")
+	noTUI := fs.Bool("no-tui", false, "disable the interactive progress view")
+	resume := fs.Bool("resume", false, "continue the latest run of the profile that is waiting for approval")
+	resumeID := fs.String("run-id", "", "with --resume, the paused run to continue")
+	lockOpts := lockFlags(fs)
+	reports := reportFlags(fs)
+	otlpEndpoint := otlpFlags(fs)
+	forgeKind := forgeFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		os.Exit(1)
 	}
 
-	setupLogger(*jsonOut)
-
-	cfg, steps, configData := loadAndResolve(*configPath, *profileName)
+	if *resume && (!sel.IsZero() || sel.NoDeps || *changedSince != "") {
+		fmt.Fprintln(os.Stderr, "--resume continues the paused run's plan; it cannot be combined with --only, --from, --until, --skip, --no-deps or --changed-since")
+		os.Exit(1)
+	}
+	if sel.NoDeps && len(sel.Only) == 0 {
+		fmt.Fprintln(os.Stderr, "--no-deps requires --only: it runs the steps --only matches without their dependencies")
+		os.Exit(1)
+	}
 
-	for _, s := range steps {
-		if err := cfg.Policy.ValidateStep(s.Type, s.ID); err != nil {
-			slog.Error("policy violation", "error", err)
-			os.Exit(1)
+	setupLogger(*jsonOut)
+	tel := startTelemetry(*otlpEndpoint)
+
+	// A resumed run keeps its ID and plan; steps that already succeeded are
+	// carried over and approvals recorded since are applied.
+	var p *plan.Plan
+	var paused *approval.State
+	var retention config.Retention
+	var hooks []notify.Hook
+	runID := util.NewRunID()
+	if *resume {
+		paused = pausedRun(*configPath, *profileName, *resumeID)
+		p, runID = paused.Plan, paused.RunID
+		if cfg, err := config.Load(*configPath); err == nil {
+			retention = cfg.Retention
+			hooks = config.ResolveNotify(cfg, p.Profile)
 		}
+	} else {
+		cfg, steps, configData := loadAndResolve(*configPath, *profileName)
+		p = buildPlan(cfg, *profileName, steps, configData, *sel)
+		skipUnchanged(p, *changedSince)
+		retention = cfg.Retention
+		hooks = config.ResolveNotify(cfg, *profileName)
 	}
 
-	p, err := plan.Build(cfg.Project.Name, *profileName, steps, configData)
-	if err != nil {
-		slog.Error("failed to build plan", "error", err)
-		os.Exit(1)
-	}
+	// Execute with signal handling.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	locked, lockWait, unlock := lockRuns(ctx, runID, *lockOpts)
+	defer unlock()
+
+	meta := beginRun(p, runID, lockWait)
+	outDir := runs.Dir(runsDir, runID)
 
-	outDir := ".foundry/out"
 	if writeErr := plan.WritePlan(p, outDir); writeErr != nil {
 		slog.Error("failed to write plan", "error", writeErr)
 		os.Exit(1)
 	}
 
-	// Execute with signal handling.
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	runCtx, abort := context.WithCancel(ctx)
+	defer abort()
 
 	opts := exec.DefaultOptions()
 	opts.Jobs = *jobs
 	opts.OutDir = outDir
+	opts.Canceller = exec.NewCanceller()
+	tel.instrument(&opts)
+
+	// Undecided approvals are asked on an interactive terminal; otherwise
+	// the run pauses until they are given with "anvil approve".
+	interactive := !*jsonOut && tui.IsTerminal(os.Stdin) && tui.IsTerminal(os.Stdout)
+	approver := approval.Recorded{}
+	if interactive {
+		approver.Next = approval.NewPrompt(os.Stdin, os.Stdout, approval.CurrentUser())
+	}
+	if paused != nil {
+		approver.Decisions = paused.Decisions
+		opts.Prior = paused.Prior()
+	}
+	opts.Approver = approver
+
+	// Show the live progress view on interactive terminals; CI and piped
+	// output keep plain log lines. Approval prompts need the plain terminal.
+	stopDashboard := func() {}
+	if interactive && !*noTUI && !awaitsApproval(p, opts.Prior) {
+		var dash *tui.Dashboard
+		dash, stopDashboard = startDashboard(p, opts.Canceller, abort, outDir)
+		if dash != nil {
+			opts.OnEvent = dash.Handle
+		}
+	}
+	statuses := startForge(*forgeKind, p)
+	observe(&opts, statuses)
 
-	results, err := exec.Execute(ctx, p, opts)
+	results, err := exec.Execute(runCtx, p, opts)
+	stopDashboard()
 	if err != nil {
 		slog.Error("execution failed", "error", err)
+		failForge(statuses, err)
 		os.Exit(1)
 	}
+	results.RunID = runID
 
 	if err := exec.WriteResults(results, outDir); err != nil {
 		slog.Error("failed to write results", "error", err)
+		failForge(statuses, err)
 		os.Exit(1)
 	}
 
+	if results.Status == "pending" {
+		state := &approval.State{
+			RunID:     runID,
+			Profile:   p.Profile,
+			CreatedAt: util.NowUTC(),
+			Plan:      p,
+			Results:   results,
+		}
+		if err := approval.Save(approvalsDir, state); err != nil {
+			slog.Error("failed to save paused run", "error", err)
+			failForge(statuses, err)
+			os.Exit(1)
+		}
+	} else if paused != nil {
+		if err := approval.Remove(approvalsDir, runID); err != nil {
+			slog.Warn("failed to clean up paused run", "error", err)
+		}
+	}
+	finishRun(meta, results.Status, retention, locked)
+	recordHistory(meta, p, results, locked)
+	writeReports(*reports, &report.Run{Results: results, Plan: p, Meta: meta, Dir: outDir})
+	code := exitCode(results.Status)
+	tel.export(results, p, meta, code)
+	notifyRun(hooks, meta, results, *reports)
+	finishForge(statuses, results)
+
 	if *jsonOut {
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
@@ -242,40 +406,248 @@ func cmdRun(args []string) {
 	} else {
 		fmt.Printf("\nExecution %s (%s)\n", results.Status, results.Duration)
 		for _, sr := range results.Steps {
-			marker := "✓"
-			if sr.Status != "success" {
+			marker, status := "✓", sr.Status
+			switch sr.Status {
+			case "success":
+			case "skipped":
+				marker, status = "-", "skipped: "+sr.Error
+			case "pending":
+				marker, status = "?", "awaiting approval"
+			default:
 				marker = "✗"
 			}
-			fmt.Printf("  %s %s [%s] %s\n", marker, sr.ID, sr.Status, sr.Duration)
+			line := fmt.Sprintf("  %s %s [%s] %s", marker, sr.ID, status, sr.Duration)
+			if a := sr.Approval; a != nil {
+				verb := "approved"
+				if !a.Approved {
+					verb = "rejected"
+				}
+				line += fmt.Sprintf(" (%s by %s at %s)", verb, a.By, a.At)
+			}
+			fmt.Println(line)
+			if sr.Tests != nil {
+				fmt.Printf("      %s\n", sr.Tests)
+			}
+		}
+		if results.Status == "pending" {
+			fmt.Printf("\nRun %s is waiting for approval. Approve with:\n", runID)
+			for _, sr := range results.Steps {
+				if sr.Status == "pending" {
+					fmt.Printf("  anvil approve %s %s\n", runID, sr.ID)
+				}
+			}
+			fmt.Println("then continue it with: anvil run --resume")
 		}
 	}
 
-	if results.Status != "success" {
-		os.Exit(1)
+	unlock()
+	if code != 0 {
+		os.Exit(code)
 	}
 }
 
 // --- helpers ---
 
-// loadAndResolve loads config, resolves the profile, and returns raw config bytes.
+// lockOptions says what to do when another anvil process holds the output
+// directory.
+type lockOptions struct {
+	wait    bool
+	isolate bool
+}
+
+// lockFlags registers the flags controlling output directory locking.
+func lockFlags(fs *flag.FlagSet) *lockOptions {
+	lo := &lockOptions{}
+	fs.BoolVar(&lo.wait, "wait-lock", false, "wait for another anvil run to finish")
+	fs.BoolVar(&lo.isolate, "isolate", false, "if another anvil run is active, run anyway in this run's own directory")
+	return lo
+}
+
+// lockRuns takes the advisory lock on the runs directory and reports whether
+// it is held and how long it waited for another run to release it, along
+// with a func releasing it, which is safe to call more than once. If another
+// process holds the lock, it waits, proceeds unlocked or exits, depending on
+// lo.
+func lockRuns(ctx context.Context, runID string, lo lockOptions) (bool, time.Duration, func()) {
+	var l *lock.Lock
+	var err error
+	var waitStart time.Time
+	if lo.wait {
+		l, err = lock.Wait(ctx, runsDir, runID, func(held *lock.HeldError) {
+			if waitStart.IsZero() {
+				waitStart = time.Now()
+			}
+			slog.Info("waiting for another anvil run", "holder", held)
+		})
+	} else {
+		l, err = lock.Acquire(runsDir, runID)
+	}
+
+	var held *lock.HeldError
+	switch {
+	case err == nil:
+		var waited time.Duration
+		if !waitStart.IsZero() {
+			waited = time.Since(waitStart)
+		}
+		var once sync.Once
+		return true, waited, func() {
+			once.Do(func() {
+				if err := l.Release(); err != nil {
+					slog.Warn("failed to release runs directory lock", "error", err)
+				}
+			})
+		}
+	case errors.As(err, &held) && lo.isolate:
+		slog.Info("another anvil run is active, continuing in isolation", "holder", held)
+		return false, 0, func() {}
+	case errors.As(err, &held):
+		slog.Error("another anvil run is active; retry with --wait-lock or --isolate", "error", err)
+		os.Exit(1)
+	default:
+		slog.Error("failed to lock runs directory", "error", err)
+		os.Exit(1)
+	}
+	return false, 0, nil
+}
+
+// awaitsApproval reports whether p has approval steps that are not already
+// decided by a prior result.
+func awaitsApproval(p *plan.Plan, prior map[string]exec.StepResult) bool {
+	for _, s := range p.Steps {
+		if s.Type == "approval" && s.Skip == "" && prior[s.ID].Status != "success" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorFlags registers the step selection flags shared by plan and run.
+// Selector flags may be repeated or given comma-separated values.
+func selectorFlags(fs *flag.FlagSet) *plan.Selector {
+	sel := &plan.Selector{}
+	listFlag := func(name, usage string, dst *[]string) {
+		fs.Func(name, usage, func(v string) error {
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+			return nil
+		})
+	}
+	listFlag("only", "run only matching steps and their deps (ID, glob or tag:<name>)", &sel.Only)
+	listFlag("from", "run matching steps and everything downstream", &sel.From)
+	listFlag("until", "run matching steps and everything upstream", &sel.Until)
+	listFlag("skip", "drop matching steps", &sel.Skip)
+	fs.BoolVar(&sel.NoDeps, "no-deps", false, "with --only, do not include dependencies")
+	return sel
+}
+
+// loadAndResolve loads config, resolves the profile, and returns the bytes
+// of the config and the files it includes, for the plan's config hash.
 func loadAndResolve(configPath, profileName string) (*config.Config, []config.Step, []byte) {
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		slog.Error("failed to load config", "path", configPath, "error", err)
 		os.Exit(1)
 	}
+	for _, w := range cfg.Warnings {
+		slog.Warn(w, "path", configPath)
+	}
 
 	steps, err := config.ResolveProfile(cfg, profileName)
 	if err != nil {
 		slog.Error("failed to resolve profile", "profile", profileName, "error", err)
 		os.Exit(1)
 	}
+	steps, err = config.Render(cfg, profileName, steps, config.RenderContext{
+		LookupEnv: os.LookupEnv,
+		Git:       func() (vcs.Info, error) { return vcs.Describe(".") },
+	})
+	if err != nil {
+		slog.Error("failed to render profile", "profile", profileName, "error", err)
+		os.Exit(1)
+	}
+
+	return cfg, steps, cfg.Content()
+}
+
+// startDashboard takes over the terminal with the live progress view. While
+// it is shown, log output goes to anvil.log in outDir. It returns a nil
+// dashboard if the terminal cannot be driven; the returned func restores the
+// terminal and logging and is always safe to call.
+func startDashboard(p *plan.Plan, canceller *exec.Canceller, abort func(), outDir string) (*tui.Dashboard, func()) {
+	logFile, err := os.Create(filepath.Join(outDir, "anvil.log"))
+	if err != nil {
+		slog.Warn("interactive view disabled", "error", err)
+		return nil, func() {}
+	}
+
+	dash := tui.New(p, tui.Options{
+		Title:     p.ProjectName + " / " + p.Profile,
+		Canceller: canceller,
+		Abort:     abort,
+	})
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	if err := dash.Start(os.Stdin, os.Stdout); err != nil {
+		slog.SetDefault(defaultLogger)
+		_ = logFile.Close()
+		slog.Warn("interactive view disabled", "error", err)
+		return nil, func() {}
+	}
+
+	return dash, func() {
+		dash.Stop()
+		slog.SetDefault(defaultLogger)
+		_ = logFile.Close()
+	}
+}
+
+// skipUnchanged marks steps with no relevant changes since ref as skipped.
+// An empty ref leaves the plan untouched.
+func skipUnchanged(p *plan.Plan, ref string) {
+	if ref == "" {
+		return
+	}
+
+	changed, err := vcs.ChangedFiles(".", ref)
+	if err != nil {
+		slog.Error("failed to list changed files", "ref", ref, "error", err)
+		os.Exit(1)
+	}
+
+	if err := plan.SkipUnchanged(p, ref, changed); err != nil {
+		slog.Error("failed to apply change filter", "error", err)
+		os.Exit(1)
+	}
+}
+
+// buildPlan checks the resolved steps against policy, builds the plan and
+// applies the step selector.
+func buildPlan(cfg *config.Config, profileName string, steps []config.Step, configData []byte, sel plan.Selector) *plan.Plan {
+	// Validate steps against policy.
+	for _, s := range steps {
+		if err := cfg.Policy.ValidateStep(s.Type, s.ID); err != nil {
+			slog.Error("policy violation", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	p, err := plan.Build(cfg.Project.Name, profileName, steps, configData)
+	if err != nil {
+		slog.Error("failed to build plan", "error", err)
+		os.Exit(1)
+	}
 
-	configData, err := config.RawBytes(configPath)
+	p, err = plan.Select(p, sel)
 	if err != nil {
-		slog.Error("failed to read config bytes", "error", err)
+		slog.Error("failed to select steps", "error", err)
 		os.Exit(1)
 	}
 
-	return cfg, steps, configData
+	return p
 }
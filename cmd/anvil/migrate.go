@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/foundry-ci/foundry/internal/config"
+)
+
+// --- migrate ---
+
+func cmdMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configPath := fs.String("config", ".foundry.yaml", "config file path")
+	dryRun := fs.Bool("dry-run", false, "print the migrated config instead of rewriting the file")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	setupLogger(false)
+
+	files, err := config.MigrateFile(*configPath)
+	if err != nil {
+		slog.Error("failed to migrate config", "path", *configPath, "error", err)
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		for i, f := range files {
+			if i > 0 {
+				fmt.Printf("--- # %s\n", f.Path)
+			}
+			_, _ = os.Stdout.Write(f.Data)
+		}
+		return
+	}
+	migrated := false
+	for _, f := range files {
+		if f.From == config.CurrentVersion {
+			continue
+		}
+		if err := writeFileAtomic(f.Path, f.Data); err != nil {
+			slog.Error("failed to write config", "path", f.Path, "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Migrated %s from version %d to %d\n", f.Path, f.From, config.CurrentVersion)
+		migrated = true
+	}
+	if !migrated {
+		fmt.Printf("%s is already version %d\n", *configPath, config.CurrentVersion)
+	}
+}
+
+// writeFileAtomic replaces path with data, keeping its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
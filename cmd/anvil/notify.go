@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/history"
+	"github.com/foundry-ci/foundry/internal/notify"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// notifyRun sends the finished run to the profile's webhooks. Failed
+// deliveries are logged but do not change the outcome of the run.
+func notifyRun(hooks []notify.Hook, meta *runs.Meta, results *exec.ExecutionResult, reports []reportSpec) {
+	if len(hooks) == 0 {
+		return
+	}
+	previous := previousStatus(meta.Profile, meta.RunID)
+	raised := notify.Raised(results.Status, previous)
+	if len(raised) == 0 {
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	payload := notify.Payload{
+		Project:    meta.Project,
+		Profile:    meta.Profile,
+		RunID:      meta.RunID,
+		Status:     results.Status,
+		Previous:   previous,
+		ConfigHash: meta.ConfigHash,
+		StartedAt:  meta.StartedAt,
+		FinishedAt: meta.FinishedAt,
+		Duration:   meta.Duration,
+		Host:       hostname,
+		RunDir:     runs.Dir(runsDir, meta.RunID),
+		Steps:      []notify.Step{},
+		Failed:     []notify.Step{},
+	}
+	for _, spec := range reports {
+		payload.Reports = append(payload.Reports, notify.Report{Format: spec.format, Path: spec.path})
+	}
+	for _, sr := range results.Steps {
+		s := notify.Step{ID: sr.ID, Status: sr.Status, Duration: sr.Duration, ExitCode: sr.ExitCode, Error: sr.Error}
+		payload.Steps = append(payload.Steps, s)
+		if sr.Status == "failed" {
+			payload.Failed = append(payload.Failed, s)
+		}
+	}
+
+	for _, d := range notify.Send(context.Background(), hooks, raised, payload, os.Getenv) {
+		if d.Err != nil {
+			slog.Warn("failed to send notification", "url", d.URL, "event", d.Event, "error", d.Err)
+			continue
+		}
+		slog.Info("notification sent", "url", d.URL, "event", d.Event)
+	}
+}
+
+// previousStatus returns the status of the profile's last recorded run
+// other than runID, or "" if there is none.
+func previousStatus(profile, runID string) string {
+	all, err := history.Load(historyFile)
+	if err != nil {
+		slog.Warn("failed to read run history", "error", err)
+		return ""
+	}
+	for _, r := range slices.Backward(all) {
+		if r.Profile == profile && r.RunID != runID {
+			return r.Status
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/foundry-ci/foundry/internal/report"
+	"github.com/foundry-ci/foundry/internal/runs"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// reportSpec is a report requested with --report format=path.
+type reportSpec struct {
+	format string
+	path   string
+}
+
+// reportFlags registers the repeatable --report flag of run, and --trace as
+// a shorthand for --report trace=path.
+func reportFlags(fs *flag.FlagSet) *[]reportSpec {
+	specs := &[]reportSpec{}
+	usage := fmt.Sprintf("write a report after the run as format=path (formats: %s); may be repeated", strings.Join(report.Formats, ", "))
+	fs.Func("report", usage, func(v string) error {
+		format, path, ok := strings.Cut(v, "=")
+		if !ok || path == "" {
+			return fmt.Errorf("expected format=path, got %q", v)
+		}
+		if !slices.Contains(report.Formats, format) {
+			return fmt.Errorf("unknown report format %q (must be %s)", format, strings.Join(report.Formats, ", "))
+		}
+		*specs = append(*specs, reportSpec{format: format, path: path})
+		return nil
+	})
+	fs.Func("trace", "write a Chrome trace of the run (for Perfetto or chrome://tracing) to this file", func(path string) error {
+		*specs = append(*specs, reportSpec{format: "trace", path: path})
+		return nil
+	})
+	return specs
+}
+
+// writeReports writes the requested reports for a finished run. Failures are
+// logged but do not change the outcome of the run.
+func writeReports(specs []reportSpec, run *report.Run) {
+	for _, spec := range specs {
+		if err := report.WriteFile(spec.path, spec.format, run, report.Options{}); err != nil {
+			slog.Error("failed to write report", "format", spec.format, "path", spec.path, "error", err)
+			continue
+		}
+		slog.Info("report written", "format", spec.format, "path", spec.path)
+	}
+}
+
+// --- report ---
+
+func cmdReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := fs.String("format", "junit", "report format: "+strings.Join(report.Formats, ", "))
+	output := fs.String("o", "", "write the report to this file instead of stdout")
+	resultsPath := fs.String("results", "", "read this results.json instead of a run directory")
+	logLines := fs.Int("log-lines", 0, "trailing log lines per step (default 50, negative for none)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: anvil report [flags] [run-id|latest|latest-<profile>]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	setupLogger(false)
+
+	var run *report.Run
+	if *resultsPath != "" {
+		run = &report.Run{Dir: filepath.Dir(*resultsPath)}
+		if err := util.ReadJSON(*resultsPath, &run.Results); err != nil {
+			slog.Error("failed to read results", "error", err)
+			os.Exit(1)
+		}
+	} else {
+		ref := "latest"
+		if fs.NArg() == 1 {
+			ref = fs.Arg(0)
+		}
+		meta, err := runs.Load(runsDir, ref)
+		if err != nil {
+			slog.Error("failed to find run", "error", err)
+			os.Exit(1)
+		}
+		run, err = report.Load(runs.Dir(runsDir, meta.RunID))
+		if err != nil {
+			slog.Error("failed to load run", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := report.Options{LogLines: *logLines}
+	var err error
+	if *output != "" {
+		err = report.WriteFile(*output, *format, run, opts)
+	} else {
+		err = report.Write(os.Stdout, *format, run, opts)
+	}
+	if err != nil {
+		slog.Error("failed to write report", "error", err)
+		os.Exit(1)
+	}
+}
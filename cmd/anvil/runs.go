@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/approval"
+	"github.com/foundry-ci/foundry/internal/config"
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// beginRun creates the run directory and records the run as running. A
+// resumed run keeps its original metadata. lockWait is how long the run
+// waited for the runs lock.
+func beginRun(p *plan.Plan, runID string, lockWait time.Duration) *runs.Meta {
+	meta, err := runs.Load(runsDir, runID)
+	if err != nil {
+		hostname, _ := os.Hostname()
+		meta = &runs.Meta{
+			RunID:      runID,
+			Project:    p.ProjectName,
+			Profile:    p.Profile,
+			ConfigHash: p.ConfigHash,
+			StartedAt:  time.Now().UTC().Format(runs.TimeFormat),
+			Hostname:   hostname,
+			User:       approval.CurrentUser(),
+			Version:    version,
+			Command:    strings.Join(os.Args, " "),
+		}
+	}
+	meta.Status = "running"
+	meta.FinishedAt, meta.Duration = "", ""
+	if lockWait = lockWait.Round(time.Millisecond); lockWait > 0 {
+		meta.LockWait = lockWait.String()
+	}
+
+	if err := runs.WriteMeta(runsDir, meta); err != nil {
+		slog.Error("failed to create run directory", "error", err)
+		os.Exit(1)
+	}
+	return meta
+}
+
+// finishRun records the run's outcome, makes it the latest run of its
+// profile and, if this process holds the runs lock, removes runs beyond the
+// retention limits. Runs waiting for approval are never removed.
+func finishRun(meta *runs.Meta, status string, retention config.Retention, locked bool) {
+	meta.Status = status
+	meta.FinishedAt = time.Now().UTC().Format(runs.TimeFormat)
+	meta.Duration = time.Since(meta.Started()).Round(time.Millisecond).String()
+	if err := runs.WriteMeta(runsDir, meta); err != nil {
+		slog.Warn("failed to write run metadata", "error", err)
+	}
+
+	if err := runs.SetLatest(runsDir, meta.Profile, meta.RunID); err != nil {
+		slog.Warn("failed to update latest run", "error", err)
+	}
+
+	if !locked {
+		return
+	}
+	keepRuns := retention.KeepRuns
+	if keepRuns == 0 {
+		keepRuns = config.DefaultKeepRuns
+	}
+	removed, err := runs.Prune(runsDir, runs.Retention{KeepRuns: keepRuns, KeepDays: retention.KeepDays}, time.Now(), func(runID string) bool {
+		_, err := approval.Load(approvalsDir, runID)
+		return err == nil
+	})
+	if err != nil {
+		slog.Warn("failed to apply run retention", "error", err)
+	}
+	if len(removed) > 0 {
+		slog.Info("removed old runs", "count", len(removed))
+	}
+}
+
+// --- runs ---
+
+func cmdRuns(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: anvil runs list|show [flags]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		cmdRunsList(args[1:])
+	case "show":
+		cmdRunsShow(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown runs command: %s\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func cmdRunsList(args []string) {
+	fs := flag.NewFlagSet("runs list", flag.ContinueOnError)
+	profileName := fs.String("profile", "", "only list runs of this profile")
+	limit := fs.Int("n", 20, "maximum number of runs to list (0 for all)")
+	jsonOut := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	setupLogger(*jsonOut)
+
+	all, err := runs.List(runsDir)
+	if err != nil {
+		slog.Error("failed to list runs", "error", err)
+		os.Exit(1)
+	}
+
+	list := []runs.Meta{}
+	for _, m := range all {
+		if *profileName != "" && m.Profile != *profileName {
+			continue
+		}
+		if *limit > 0 && len(list) == *limit {
+			break
+		}
+		list = append(list, m)
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(list)
+		return
+	}
+
+	if len(list) == 0 {
+		fmt.Println("No runs")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN ID\tPROFILE\tSTATUS\tSTARTED\tDURATION")
+	for _, m := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.RunID, m.Profile, m.Status, m.StartedAt, m.Duration)
+	}
+	_ = tw.Flush()
+}
+
+func cmdRunsShow(args []string) {
+	fs := flag.NewFlagSet("runs show", flag.ContinueOnError)
+	profileName := fs.String("profile", "", "show the latest run of this profile")
+	jsonOut := fs.Bool("json", false, "output as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: anvil runs show [flags] [run-id|latest]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	setupLogger(*jsonOut)
+
+	ref := "latest"
+	switch {
+	case fs.NArg() > 1:
+		fs.Usage()
+		os.Exit(1)
+	case fs.NArg() == 1:
+		ref = fs.Arg(0)
+	case *profileName != "":
+		ref = "latest-" + *profileName
+	}
+
+	meta, err := runs.Load(runsDir, ref)
+	if err != nil {
+		slog.Error("failed to load run", "error", err)
+		os.Exit(1)
+	}
+
+	dir := runs.Dir(runsDir, meta.RunID)
+	var results *exec.ExecutionResult
+	if err := util.ReadJSON(filepath.Join(dir, "results.json"), &results); err != nil {
+		results = nil
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(struct {
+			Metadata *runs.Meta            `json:"metadata"`
+			Results  *exec.ExecutionResult `json:"results,omitempty"`
+		}{meta, results})
+		return
+	}
+
+	fmt.Printf("Run %s\n", meta.RunID)
+	fmt.Printf("  Project:  %s\n", meta.Project)
+	fmt.Printf("  Profile:  %s\n", meta.Profile)
+	fmt.Printf("  Status:   %s\n", meta.Status)
+	fmt.Printf("  Started:  %s by %s on %s\n", meta.StartedAt, meta.User, meta.Hostname)
+	if meta.FinishedAt != "" {
+		fmt.Printf("  Finished: %s (%s)\n", meta.FinishedAt, meta.Duration)
+	}
+	fmt.Printf("  Config:   %s\n", meta.ConfigHash)
+	fmt.Printf("  Dir:      %s\n", dir)
+
+	if results == nil {
+		return
+	}
+	fmt.Println("\nSteps:")
+	for _, sr := range results.Steps {
+		line := fmt.Sprintf("  %-24s %-8s %s", sr.ID, sr.Status, sr.Duration)
+		if sr.Error != "" {
+			line += "  " + sr.Error
+		}
+		if sr.LogFile != "" {
+			line += "  " + sr.LogFile
+		}
+		fmt.Println(line)
+		if sr.Tests != nil {
+			fmt.Printf("  %-24s %s\n", "", sr.Tests)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/history"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// historyFile records every finished run, one JSON line each, for "anvil
+// stats". It outlives run directories removed by retention.
+const historyFile = ".foundry/history.jsonl"
+
+// recordHistory appends a finished run to the history and, if this process
+// holds the runs lock, trims the oldest records. Runs waiting for approval
+// are recorded once they finish.
+func recordHistory(meta *runs.Meta, p *plan.Plan, results *exec.ExecutionResult, locked bool) {
+	if results.Status == "pending" {
+		return
+	}
+	if err := history.Append(historyFile, history.NewRun(meta, p, results)); err != nil {
+		slog.Warn("failed to record run history", "error", err)
+		return
+	}
+	if locked {
+		if err := history.Trim(historyFile, history.DefaultKeep); err != nil {
+			slog.Warn("failed to trim run history", "error", err)
+		}
+	}
+}
+
+// --- stats ---
+
+func cmdStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	profileName := fs.String("profile", "default", "profile to summarise (empty for all)")
+	window := fs.Int("runs", history.DefaultWindow, "newest runs to summarise (0 for all)")
+	recent := fs.Int("recent", history.DefaultRecent, "newest runs checked for regressions")
+	baseline := fs.Int("baseline", history.DefaultBaseline, "runs before the recent ones forming the regression baseline")
+	threshold := fs.Float64("threshold", history.DefaultThreshold*100, "slowdown of the median, in percent, reported as a regression")
+	jsonOut := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	setupLogger(*jsonOut)
+
+	all, err := history.Load(historyFile)
+	if err != nil {
+		slog.Error("failed to read run history", "error", err)
+		os.Exit(1)
+	}
+	st := history.Compute(all, history.Options{
+		Profile:   *profileName,
+		Window:    *window,
+		Recent:    *recent,
+		Baseline:  *baseline,
+		Threshold: *threshold / 100,
+	})
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(st)
+		return
+	}
+
+	if st.Runs == 0 {
+		fmt.Println("No run history")
+		return
+	}
+	name := "all profiles"
+	if st.Profile != "" {
+		name = "profile " + st.Profile
+	}
+	fmt.Printf("%d runs of %s, %s to %s\n", st.Runs, name, st.From, st.To)
+	fmt.Printf("  Duration:     p50 %s, p95 %s\n", ms(st.P50MS), ms(st.P95MS))
+	fmt.Printf("  Failure rate: %s\n", percent(st.FailureRate))
+
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tRUNS\tP50\tP95\tFAILED\tRETRIED\tFLAKY")
+	for _, s := range st.Steps {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Runs, ms(s.P50MS), ms(s.P95MS), percent(s.FailureRate), percent(s.RetryRate), percent(s.FlakeRate))
+	}
+	_ = tw.Flush()
+
+	if len(st.Flaky) > 0 {
+		fmt.Println("\nFlakiest steps:")
+		for _, s := range st.Flaky {
+			fmt.Printf("  %-24s %s (%d of %d runs)\n", s.ID, percent(s.FlakeRate), s.Flakes, s.Runs)
+		}
+	}
+	if cp := st.CriticalPath; cp != nil {
+		fmt.Printf("\nSlowest critical path (%s): %s\n", ms(cp.DurationMS), strings.Join(cp.Steps, " → "))
+	}
+	if len(st.Regressions) > 0 {
+		fmt.Printf("\nRegressions (median of the last %d runs against the %d before):\n", *recent, *baseline)
+		for _, r := range st.Regressions {
+			id := r.Step
+			if id == "" {
+				id = "(run)"
+			}
+			fmt.Printf("  %-24s %s → %s (+%.0f%%)\n", id, ms(r.BaselineP50MS), ms(r.RecentP50MS), r.Change*100)
+		}
+	}
+}
+
+// ms formats a duration in milliseconds for display, to a tenth of a
+// second beyond a second.
+func ms(n int64) string {
+	d := time.Duration(n) * time.Millisecond
+	if d >= time.Second {
+		d = d.Round(100 * time.Millisecond)
+	}
+	return d.String()
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.1f%%", f*100)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/otlp"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// telemetry exports a run to an OpenTelemetry collector.
+type telemetry struct {
+	cfg   otlp.Config
+	trace *otlp.Trace
+}
+
+// otlpFlags registers the flag overriding OTEL_EXPORTER_OTLP_ENDPOINT.
+func otlpFlags(fs *flag.FlagSet) *string {
+	return fs.String("otlp-endpoint", "", "export the run's trace and metrics to this OTLP/HTTP collector (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+}
+
+// startTelemetry starts the run's trace if an OTLP endpoint is configured,
+// joining the caller's trace if TRACEPARENT is set. It returns nil if export
+// is off.
+func startTelemetry(endpoint string) *telemetry {
+	cfg, ok, err := otlp.FromEnv(os.Getenv, endpoint)
+	if err != nil {
+		slog.Error("invalid OpenTelemetry configuration", "error", err)
+		os.Exit(1)
+	}
+	if !ok {
+		return nil
+	}
+	return &telemetry{cfg: cfg, trace: otlp.NewTrace(os.Getenv("TRACEPARENT"))}
+}
+
+// instrument hands each step attempt its trace context.
+func (t *telemetry) instrument(opts *exec.Options) {
+	if t == nil {
+		return
+	}
+	opts.AttemptEnv = t.trace.Env
+}
+
+// export sends the finished run to the collector. Failures are logged but
+// do not change the outcome of the run.
+func (t *telemetry) export(results *exec.ExecutionResult, p *plan.Plan, meta *runs.Meta, code int) {
+	if t == nil {
+		return
+	}
+	run := &otlp.Run{Results: results, Plan: p, Meta: meta, ExitCode: code, Version: version}
+	if err := otlp.Export(context.Background(), t.cfg, t.trace, run); err != nil {
+		slog.Warn("failed to export telemetry", "error", err)
+		return
+	}
+	slog.Debug("telemetry exported", "trace_id", t.trace.TraceID)
+}
+
+// exitCode returns anvil's exit code for a run's status.
+func exitCode(status string) int {
+	switch status {
+	case "success":
+		return 0
+	case "pending":
+		return exitPendingApproval
+	}
+	return 1
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/foundry-ci/foundry/internal/config"
+)
+
+// --- validate ---
+
+func cmdValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configPath := fs.String("config", ".foundry.yaml", "config file path")
+	format := fs.String("format", "text", "output format: text, json or sarif")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	var write func(io.Writer, config.Diagnostics) error
+	switch *format {
+	case "text":
+		write = writeDiagnosticsText
+	case "json":
+		write = writeDiagnosticsJSON
+	case "sarif":
+		write = writeDiagnosticsSARIF
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q (must be text, json or sarif)\n", *format)
+		os.Exit(1)
+	}
+
+	setupLogger(false)
+
+	_, ds := config.Check(*configPath)
+	if err := write(os.Stdout, ds); err != nil {
+		fmt.Fprintf(os.Stderr, "write diagnostics: %v\n", err)
+		os.Exit(1)
+	}
+	if ds.HasErrors() {
+		os.Exit(1)
+	}
+	if *format == "text" {
+		fmt.Printf("%s is valid\n", *configPath)
+	}
+}
+
+// writeDiagnosticsText writes each diagnostic as file:line:col: severity:
+// message, followed by the line it is on with a caret under its column.
+func writeDiagnosticsText(w io.Writer, ds config.Diagnostics) error {
+	sources := map[string][]byte{}
+	for _, d := range ds {
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+		src, ok := sources[d.File]
+		if !ok && d.File != "" {
+			src, _ = os.ReadFile(d.File)
+			sources[d.File] = src
+		}
+		if snippet := d.Snippet(src); snippet != "" {
+			if _, err := fmt.Fprint(w, snippet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeDiagnosticsJSON(w io.Writer, ds config.Diagnostics) error {
+	if ds == nil {
+		ds = config.Diagnostics{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Valid       bool               `json:"valid"`
+		Diagnostics config.Diagnostics `json:"diagnostics"`
+	}{!ds.HasErrors(), ds})
+}
+
+// SARIF 2.1.0, the format code scanning tools read, reduced to what anvil
+// reports: one run of one tool, with a result per diagnostic.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name    string      `json:"name"`
+		Version string      `json:"version"`
+		Rules   []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations,omitempty"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           *sarifRegion  `json:"region,omitempty"`
+	}
+	sarifArtifact struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+)
+
+func writeDiagnosticsSARIF(w io.Writer, ds config.Diagnostics) error {
+	results := make([]sarifResult, 0, len(ds))
+	for _, d := range ds {
+		r := sarifResult{RuleID: d.Rule, Level: d.Severity, Message: sarifMessage{d.Message}}
+		if d.File != "" {
+			loc := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifact{filepath.ToSlash(d.File)}}}
+			if d.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: d.Line, StartColumn: d.Column}
+			}
+			r.Locations = []sarifLocation{loc}
+		}
+		results = append(results, r)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:    "anvil",
+				Version: version,
+				Rules: []sarifRule{
+					{ID: config.RuleConfig, ShortDescription: sarifMessage{"The config decodes and is consistent"}},
+					{ID: config.RuleSchema, ShortDescription: sarifMessage{"The config matches schemas/foundry-config.schema.json"}},
+				},
+			}},
+			Results: results,
+		}},
+	})
+}
+
+// --- schema ---
+
+func cmdSchema(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	out, err := config.Schema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(out)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+	"github.com/foundry-ci/foundry/internal/util"
+	"github.com/foundry-ci/foundry/internal/watch"
+)
+
+// --- watch ---
+
+func cmdWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	profileName := fs.String("profile", "default", "profile name")
+	configPath := fs.String("config", ".foundry.yaml", "config file path")
+	jobs := fs.Int("jobs", 4, "max parallel jobs")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "quiet period after a change before re-running")
+	poll := fs.Bool("poll", false, "poll for changes instead of using native file notifications")
+	lockOpts := lockFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		os.Exit(1)
+	}
+
+	setupLogger(false)
+
+	cfg, steps, configData := loadAndResolve(*configPath, *profileName)
+	p := buildPlan(cfg, *profileName, steps, configData, plan.Selector{})
+
+	var patterns []string
+	for _, s := range p.Steps {
+		patterns = append(patterns, s.Inputs...)
+	}
+	if len(patterns) == 0 {
+		slog.Error("no step declares inputs to watch", "profile", *profileName)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// A watch session is a single run that holds the runs lock for as long
+	// as it watches.
+	runID := util.NewRunID()
+	locked, lockWait, unlock := lockRuns(ctx, runID, *lockOpts)
+	defer unlock()
+
+	meta := beginRun(p, runID, lockWait)
+	outDir := runs.Dir(runsDir, runID)
+
+	if err := plan.WritePlan(p, outDir); err != nil {
+		slog.Error("failed to write plan", "error", err)
+		os.Exit(1)
+	}
+
+	w, err := watch.New(watch.Options{Patterns: patterns, Debounce: *debounce, Poll: *poll})
+	if err != nil {
+		slog.Error("failed to start watcher", "error", err)
+		os.Exit(1)
+	}
+	defer func() { _ = w.Close() }()
+
+	fmt.Printf("Watching %d input patterns (%s). Press Ctrl-C to stop.\n", len(patterns), w.Mode())
+
+	session := &watchSession{
+		full:    p,
+		jobs:    *jobs,
+		runID:   runID,
+		outDir:  outDir,
+		latest:  map[string]exec.StepResult{},
+		pending: map[string]bool{},
+	}
+	session.loop(ctx, w)
+	finishRun(meta, session.status(), cfg.Retention, locked)
+}
+
+// watchSession re-runs the parts of a plan affected by input changes. Results
+// of steps that were not re-run are carried over between cycles.
+type watchSession struct {
+	full    *plan.Plan
+	jobs    int
+	runID   string
+	outDir  string
+	latest  map[string]exec.StepResult
+	pending map[string]bool // changed steps waiting for the next cycle
+	running *watchRun
+}
+
+// watchRun is one in-flight Execute call.
+type watchRun struct {
+	canceller *exec.Canceller
+	done      chan *exec.ExecutionResult
+}
+
+func (s *watchSession) loop(ctx context.Context, w *watch.Watcher) {
+	s.start(ctx, s.full)
+
+	for {
+		var done <-chan *exec.ExecutionResult
+		if s.running != nil {
+			done = s.running.done
+		}
+
+		select {
+		case changed, ok := <-w.Changes():
+			if !ok {
+				return
+			}
+			roots := watch.Affected(s.full.Steps, changed)
+			if len(roots) == 0 {
+				continue
+			}
+			slog.Info("inputs changed", "files", changed, "steps", roots)
+			for _, id := range roots {
+				s.pending[id] = true
+			}
+
+			if s.running == nil {
+				s.startPending(ctx)
+				continue
+			}
+
+			// Stop in-flight work that is about to be redone; unaffected
+			// steps of the current cycle run to completion.
+			for id := range s.affected() {
+				s.running.canceller.Cancel(id)
+			}
+
+		case result := <-done:
+			s.running = nil
+			if result != nil {
+				s.record(result)
+			}
+			if len(s.pending) > 0 {
+				s.startPending(ctx)
+			} else {
+				s.printSummary()
+			}
+
+		case <-ctx.Done():
+			if s.running != nil {
+				<-s.running.done
+			}
+			return
+		}
+	}
+}
+
+// affected returns the pending steps together with everything downstream.
+func (s *watchSession) affected() map[string]bool {
+	ids := map[string]bool{}
+	if len(s.pending) == 0 {
+		return ids
+	}
+	p, err := plan.Select(s.full, plan.Selector{From: slices.Sorted(maps.Keys(s.pending))})
+	if err != nil {
+		return ids
+	}
+	for _, step := range p.Steps {
+		ids[step.ID] = true
+	}
+	return ids
+}
+
+func (s *watchSession) startPending(ctx context.Context) {
+	roots := slices.Sorted(maps.Keys(s.pending))
+	p, err := s.rerunPlan(roots)
+	if err != nil {
+		slog.Error("failed to select affected steps", "error", err)
+		return
+	}
+	s.pending = map[string]bool{}
+
+	fmt.Printf("\nRe-running %s\n", strings.Join(p.Order, ", "))
+	s.start(ctx, p)
+}
+
+// rerunPlan returns the plan re-running roots and everything downstream,
+// along with the service steps those depend on, directly or through steps
+// that are not re-run. Services stopped after the previous cycle, so they are
+// started again and made deps of the steps needing them. Other deps that are
+// not re-run are satisfied by their latest results: a step whose dep last
+// failed or was skipped is skipped, as a full run would.
+func (s *watchSession) rerunPlan(roots []string) (*plan.Plan, error) {
+	p, err := plan.Select(s.full, plan.Selector{From: roots})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]plan.Step, len(s.full.Steps))
+	for _, step := range s.full.Steps {
+		byID[step.ID] = step
+	}
+	upstreamServices := func(id string) []string {
+		var services []string
+		seen := map[string]bool{}
+		queue := slices.Clone(byID[id].Deps)
+		for len(queue) > 0 {
+			dep := queue[0]
+			queue = queue[1:]
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if byID[dep].Type == "service" {
+				services = append(services, dep)
+			}
+			queue = append(queue, byID[dep].Deps...)
+		}
+		return services
+	}
+
+	// needs maps each step of the re-run to the services upstream of it.
+	needs := map[string][]string{}
+	queue := slices.Clone(p.Order)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if _, ok := needs[id]; !ok {
+			needs[id] = upstreamServices(id)
+			queue = append(queue, needs[id]...)
+		}
+	}
+
+	var steps []plan.Step
+	for _, step := range s.full.Steps {
+		services, ok := needs[step.ID]
+		if !ok {
+			continue
+		}
+		deps := slices.DeleteFunc(slices.Clone(step.Deps), func(dep string) bool {
+			_, ok := needs[dep]
+			return !ok
+		})
+		for _, svc := range services {
+			if !slices.Contains(deps, svc) {
+				deps = append(deps, svc)
+			}
+		}
+		for _, dep := range step.Deps {
+			if _, ok := needs[dep]; ok || step.Skip != "" {
+				continue
+			}
+			switch sr := s.latest[dep]; {
+			case sr.Status == "failed":
+				step.Skip = "dependency failed"
+			case sr.Status == "skipped" && sr.Error != plan.SkipNoChanges && sr.Error != plan.SkipDisabled:
+				step.Skip = "dependency skipped"
+			}
+		}
+		step.Deps = deps
+		steps = append(steps, step)
+	}
+
+	order, err := plan.TopologicalSort(steps)
+	if err != nil {
+		return nil, err
+	}
+	out := *p
+	out.Steps, out.Order = steps, order
+	return &out, nil
+}
+
+func (s *watchSession) start(ctx context.Context, p *plan.Plan) {
+	run := &watchRun{
+		canceller: exec.NewCanceller(),
+		done:      make(chan *exec.ExecutionResult, 1),
+	}
+	s.running = run
+
+	opts := exec.DefaultOptions()
+	opts.Jobs = s.jobs
+	opts.OutDir = s.outDir
+	opts.FailFast = false // keep unrelated steps green while one is broken
+	opts.Canceller = run.canceller
+
+	go func() {
+		result, err := exec.Execute(ctx, p, opts)
+		if err != nil {
+			slog.Error("execution failed", "error", err)
+		}
+		run.done <- result
+	}()
+}
+
+// record merges a cycle's results into the session, ignoring steps that are
+// already queued to run again.
+func (s *watchSession) record(result *exec.ExecutionResult) {
+	rerun := s.affected()
+	for _, sr := range result.Steps {
+		if rerun[sr.ID] {
+			continue
+		}
+		s.latest[sr.ID] = sr
+	}
+
+	merged := &exec.ExecutionResult{RunID: s.runID, Status: "success", Duration: result.Duration}
+	for _, id := range s.full.Order {
+		sr, ok := s.latest[id]
+		if !ok {
+			continue
+		}
+		merged.Steps = append(merged.Steps, sr)
+		if sr.Status == "failed" {
+			merged.Status = "failed"
+		}
+	}
+	if err := exec.WriteResults(merged, s.outDir); err != nil {
+		slog.Error("failed to write results", "error", err)
+	}
+}
+
+// status summarizes the latest result of every step. Skipped steps do not
+// fail the session.
+func (s *watchSession) status() string {
+	status := "success"
+	for _, sr := range s.latest {
+		if sr.Status == "failed" {
+			status = "failed"
+		}
+	}
+	return status
+}
+
+func (s *watchSession) printSummary() {
+	status := s.status()
+
+	fmt.Printf("\n[%s] %s\n", time.Now().Format(time.TimeOnly), status)
+	for _, id := range s.full.Order {
+		sr, ok := s.latest[id]
+		if !ok {
+			fmt.Printf("  · %s [pending]\n", id)
+			continue
+		}
+		marker, status := "✓", sr.Status
+		switch sr.Status {
+		case "success":
+		case "skipped":
+			marker, status = "-", "skipped: "+sr.Error
+		default:
+			marker = "✗"
+		}
+		fmt.Printf("  %s %s [%s] %s\n", marker, sr.ID, status, sr.Duration)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// TestWatchSession_RerunPlan verifies that a re-run restarts the services
+// the re-run steps need and skips steps whose deps, not re-run, last failed.
+func TestWatchSession_RerunPlan(t *testing.T) {
+	t.Parallel()
+
+	steps := []plan.Step{
+		{ID: "db", Type: "service"},
+		{ID: "gen", Type: "shell"},
+		{ID: "lint", Type: "shell", Skip: plan.SkipDisabled},
+		{ID: "migrate", Type: "shell", Deps: []string{"db"}},
+		{ID: "build", Type: "shell", Deps: []string{"gen", "lint"}},
+		{ID: "test", Type: "shell", Deps: []string{"migrate", "build"}},
+	}
+	order, err := plan.TopologicalSort(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &watchSession{
+		full: &plan.Plan{Steps: steps, Order: order},
+		latest: map[string]exec.StepResult{
+			"db":      {ID: "db", Status: "success"},
+			"gen":     {ID: "gen", Status: "failed"},
+			"lint":    {ID: "lint", Status: "skipped", Error: plan.SkipDisabled},
+			"migrate": {ID: "migrate", Status: "success"},
+			"build":   {ID: "build", Status: "skipped", Error: "dependency failed"},
+			"test":    {ID: "test", Status: "skipped", Error: "dependency skipped"},
+		},
+	}
+
+	p, err := s.rerunPlan([]string{"build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]plan.Step{}
+	for _, step := range p.Steps {
+		got[step.ID] = step
+	}
+	if ids := slices.Sorted(maps.Keys(got)); !slices.Equal(ids, []string{"build", "db", "test"}) {
+		t.Fatalf("expected build, test and the db service, got %v", ids)
+	}
+	if build := got["build"]; build.Skip != "dependency failed" || len(build.Deps) != 0 {
+		t.Errorf("expected build skipped for gen's failure, got %+v", build)
+	}
+	if test := got["test"]; test.Skip != "" || !slices.Equal(test.Deps, []string{"build", "db"}) {
+		t.Errorf("expected test to run after build and db, got %+v", test)
+	}
+
+	if status := s.status(); status != "failed" {
+		t.Errorf("expected the session failed while gen is, got %q", status)
+	}
+	s.latest["gen"] = exec.StepResult{ID: "gen", Status: "success"}
+	if status := s.status(); status != "success" {
+		t.Errorf("expected skipped steps not to fail the session, got %q", status)
+	}
+}
@@ -0,0 +1,266 @@
+// Package approval persists runs paused on manual approval steps and collects
+// the decisions that let them continue.
+package approval
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/lock"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// ErrNoPendingRun is returned by Latest when no paused run exists.
+var ErrNoPendingRun = errors.New("no run is waiting for approval")
+
+// State is a run paused on one or more approval steps. It holds everything
+// needed to resume the run: the plan it executed, the results so far and the
+// decisions recorded since.
+type State struct {
+	Plan      *plan.Plan               `json:"plan"`
+	Results   *exec.ExecutionResult    `json:"results"`
+	Decisions map[string]exec.Approval `json:"decisions,omitempty"`
+	RunID     string                   `json:"run_id"`
+	Profile   string                   `json:"profile"`
+	CreatedAt string                   `json:"created_at"`
+}
+
+// Pending returns the IDs of approval steps that are still undecided.
+func (s *State) Pending() []string {
+	var ids []string
+	for _, r := range s.Results.Steps {
+		if _, decided := s.Decisions[r.ID]; r.Status == "pending" && !decided {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// Prior returns the results to carry over when the run is resumed. Service
+// steps are left out: their processes stopped when the run paused, so they
+// are started again for the steps still to run.
+func (s *State) Prior() map[string]exec.StepResult {
+	services := make(map[string]bool)
+	for _, step := range s.Plan.Steps {
+		if step.Type == "service" {
+			services[step.ID] = true
+		}
+	}
+	prior := make(map[string]exec.StepResult, len(s.Results.Steps))
+	for _, r := range s.Results.Steps {
+		if !services[r.ID] {
+			prior[r.ID] = r
+		}
+	}
+	return prior
+}
+
+func statePath(dir, runID string) string {
+	return filepath.Join(dir, runID+".json")
+}
+
+// Save writes the state of a paused run to dir.
+func Save(dir string, s *State) error {
+	if err := util.WriteJSON(statePath(dir, s.RunID), s); err != nil {
+		return fmt.Errorf("save approval state: %w", err)
+	}
+	return nil
+}
+
+// Load reads the state of the paused run runID from dir.
+func Load(dir, runID string) (*State, error) {
+	if runID == "" || strings.ContainsAny(runID, `/\`) {
+		return nil, fmt.Errorf("load approval state: invalid run id %q", runID)
+	}
+	path := statePath(dir, runID)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("load approval state: run %q is not waiting for approval", runID)
+	}
+	var s State
+	if err := util.ReadJSON(path, &s); err != nil {
+		return nil, fmt.Errorf("load approval state: %w", err)
+	}
+	if s.Plan == nil || s.Results == nil {
+		return nil, fmt.Errorf("load approval state: %s is incomplete", path)
+	}
+	return &s, nil
+}
+
+// Latest returns the most recent paused run of profile in dir.
+func Latest(dir, profile string) (*State, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("list approval states: %w", err)
+	}
+
+	// Run IDs sort chronologically, so walk them newest first.
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	slices.Reverse(ids)
+
+	for _, id := range ids {
+		s, err := Load(dir, id)
+		if err != nil {
+			return nil, err
+		}
+		if s.Profile == profile {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("profile %q: %w", profile, ErrNoPendingRun)
+}
+
+// Remove deletes the state of runID, once the run no longer waits on anyone.
+func Remove(dir, runID string) error {
+	if err := os.Remove(statePath(dir, runID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove approval state: %w", err)
+	}
+	return nil
+}
+
+// Decide records a decision on the pending approval step stepID of runID.
+// It holds the lock on dir while doing so, so concurrent decisions on one
+// run are not lost.
+func Decide(dir, runID, stepID string, a exec.Approval) error {
+	l, err := lock.Wait(context.Background(), dir, runID, nil)
+	if err != nil {
+		return err
+	}
+	err = decide(dir, runID, stepID, a)
+	if releaseErr := l.Release(); err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+func decide(dir, runID, stepID string, a exec.Approval) error {
+	s, err := Load(dir, runID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(s.Pending(), stepID) {
+		pending := s.Pending()
+		if len(pending) == 0 {
+			return fmt.Errorf("run %q has no undecided approvals", runID)
+		}
+		return fmt.Errorf("run %q: step %q is not awaiting approval (pending: %s)", runID, stepID, strings.Join(pending, ", "))
+	}
+	if s.Decisions == nil {
+		s.Decisions = make(map[string]exec.Approval)
+	}
+	s.Decisions[stepID] = a
+	return Save(dir, s)
+}
+
+// CurrentUser names the person running anvil, for the approval record.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// Recorded is an exec.Approver that applies decisions recorded with Decide.
+// Steps without a decision are passed to Next, or deferred if Next is nil.
+type Recorded struct {
+	Decisions map[string]exec.Approval
+	Next      exec.Approver
+}
+
+// Approve implements exec.Approver.
+func (r Recorded) Approve(ctx context.Context, step plan.Step) (*exec.Approval, error) {
+	if a, ok := r.Decisions[step.ID]; ok {
+		return &a, nil
+	}
+	if r.Next == nil {
+		return nil, nil
+	}
+	return r.Next.Approve(ctx, step)
+}
+
+// Prompt is an exec.Approver that asks on an interactive terminal. Prompts
+// for concurrent approval steps are asked one at a time.
+type Prompt struct {
+	in      io.Reader
+	out     io.Writer
+	answers chan answer
+	by      string
+	mu      sync.Mutex
+	start   sync.Once
+}
+
+type answer struct {
+	line string
+	err  error
+}
+
+// NewPrompt returns a Prompt that reads answers from in, writes questions to
+// out and records by as the approver.
+func NewPrompt(in io.Reader, out io.Writer, by string) *Prompt {
+	return &Prompt{in: in, out: out, by: by, answers: make(chan answer)}
+}
+
+// readAnswers feeds lines from in to answers. A single reader outlives
+// cancelled prompts, so a line typed late goes to the next question.
+func (p *Prompt) readAnswers() {
+	defer close(p.answers)
+	r := bufio.NewReader(p.in)
+	for {
+		line, err := r.ReadString('\n')
+		p.answers <- answer{line, err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Approve implements exec.Approver. Only "y" or "yes" approves; any other
+// answer rejects the step.
+func (p *Prompt) Approve(ctx context.Context, step plan.Step) (*exec.Approval, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := fmt.Fprintf(p.out, "Approve step %q? [y/N] ", step.ID); err != nil {
+		return nil, err
+	}
+
+	p.start.Do(func() { go p.readAnswers() })
+
+	select {
+	case <-ctx.Done():
+		_, _ = fmt.Fprintln(p.out)
+		return nil, ctx.Err()
+	case a, ok := <-p.answers:
+		if !ok {
+			return nil, fmt.Errorf("read answer: %w", io.EOF)
+		}
+		if a.err != nil && a.line == "" {
+			return nil, fmt.Errorf("read answer: %w", a.err)
+		}
+		reply := strings.ToLower(strings.TrimSpace(a.line))
+		return &exec.Approval{
+			By:       p.by,
+			At:       util.NowUTC(),
+			Approved: reply == "y" || reply == "yes",
+		}, nil
+	}
+}
@@ -0,0 +1,191 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+func pausedState(runID, profile string) *State {
+	return &State{
+		RunID:   runID,
+		Profile: profile,
+		Plan:    &plan.Plan{Profile: profile},
+		Results: &exec.ExecutionResult{
+			RunID:  runID,
+			Status: "pending",
+			Steps: []exec.StepResult{
+				{ID: "build", Status: "success"},
+				{ID: "gate", Status: "pending"},
+				{ID: "deploy", Status: "skipped", Error: "awaiting approval"},
+			},
+		},
+	}
+}
+
+// TestStateLifecycle verifies saving, finding, deciding and removing paused runs.
+func TestStateLifecycle(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if _, err := Latest(dir, "default"); !errors.Is(err, ErrNoPendingRun) {
+		t.Fatalf("expected ErrNoPendingRun, got %v", err)
+	}
+
+	for _, s := range []*State{
+		pausedState("20260101T000000Z-aaaaaa", "default"),
+		pausedState("20260102T000000Z-bbbbbb", "default"),
+		pausedState("20260103T000000Z-cccccc", "release"),
+	} {
+		if err := Save(dir, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := Latest(dir, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.RunID != "20260102T000000Z-bbbbbb" {
+		t.Errorf("expected newest default run, got %q", latest.RunID)
+	}
+
+	err = Decide(dir, latest.RunID, "deploy", exec.Approval{By: "alice"})
+	if err == nil || !strings.Contains(err.Error(), "pending: gate") {
+		t.Errorf("expected error naming the pending step, got %v", err)
+	}
+
+	if err := Decide(dir, latest.RunID, "gate", exec.Approval{By: "alice", Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+	decided, err := Load(dir, latest.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decided.Pending()) != 0 || decided.Decisions["gate"].By != "alice" {
+		t.Errorf("expected gate decided by alice, got %+v", decided.Decisions)
+	}
+
+	if err := Remove(dir, latest.RunID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir, latest.RunID); err == nil {
+		t.Error("expected removed run to be gone")
+	}
+
+	if _, err := Load(dir, "../escape"); err == nil {
+		t.Error("expected run IDs with path separators to be rejected")
+	}
+}
+
+// TestRecordedAndPrompt verifies recorded decisions take precedence and that
+// the prompt only approves on an explicit yes.
+func TestRecordedAndPrompt(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	prompt := NewPrompt(strings.NewReader("yes\nnope\n"), &out, "carol")
+	approver := Recorded{
+		Decisions: map[string]exec.Approval{"gate": {By: "alice", Approved: true}},
+		Next:      prompt,
+	}
+	ctx := context.Background()
+
+	a, err := approver.Approve(ctx, plan.Step{ID: "gate"})
+	if err != nil || a.By != "alice" {
+		t.Errorf("expected recorded decision by alice, got %+v (err %v)", a, err)
+	}
+
+	a, err = approver.Approve(ctx, plan.Step{ID: "deploy"})
+	if err != nil || !a.Approved || a.By != "carol" || a.At == "" {
+		t.Errorf("expected deploy approved by carol, got %+v (err %v)", a, err)
+	}
+
+	a, err = approver.Approve(ctx, plan.Step{ID: "release"})
+	if err != nil || a.Approved {
+		t.Errorf("expected release rejected, got %+v (err %v)", a, err)
+	}
+
+	if _, err := approver.Approve(ctx, plan.Step{ID: "again"}); err == nil {
+		t.Error("expected an error once input is exhausted")
+	}
+
+	if !strings.Contains(out.String(), `Approve step "deploy"? [y/N]`) {
+		t.Errorf("expected prompt for deploy, got %q", out.String())
+	}
+
+	if a, err := (Recorded{}).Approve(ctx, plan.Step{ID: "gate"}); a != nil || err != nil {
+		t.Errorf("expected undecided step to be deferred, got %+v (err %v)", a, err)
+	}
+}
+
+// TestResumeRestartsServices verifies that a service is started again when a
+// run paused on an approval is resumed, so the steps after the approval that
+// need it find it running.
+func TestResumeRestartsServices(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	starts := filepath.Join(dir, "starts")
+	up := filepath.Join(dir, "up")
+	p := &plan.Plan{
+		Profile: "default",
+		Steps: []plan.Step{
+			{
+				ID:      "db",
+				Type:    "service",
+				Command: []string{"sh", "-c", "echo >> " + starts + "; touch " + up + "; trap 'rm " + up + "; exit 0' TERM; echo ready; while :; do sleep 0.05; done"},
+				Ready:   &plan.Probe{Log: "ready", Interval: "20ms"},
+			},
+			{ID: "gate", Type: "approval", Deps: []string{"db"}},
+			{ID: "deploy", Type: "shell", Command: []string{"test", "-f", up}, Deps: []string{"gate"}},
+		},
+		Order: []string{"db", "gate", "deploy"},
+	}
+
+	opts := exec.DefaultOptions()
+	opts.OutDir = t.TempDir()
+	opts.Approver = Recorded{}
+	results, err := exec.Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Status != "pending" {
+		t.Fatalf("expected the run to pause on gate, got %q: %+v", results.Status, results.Steps)
+	}
+
+	s := &State{RunID: "20260101T000000Z-aaaaaa", Profile: "default", Plan: p, Results: results}
+	if err := Save(dir, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := Decide(dir, s.RunID, "gate", exec.Approval{By: "alice", Approved: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Load(dir, s.RunID); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Prior = s.Prior()
+	opts.Approver = Recorded{Decisions: s.Decisions}
+	results, err = exec.Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.Status != "success" {
+		t.Errorf("expected deploy to find db running, got %q: %+v", results.Status, results.Steps)
+	}
+	data, err := os.ReadFile(starts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("expected db to be started again on resume, got %d starts", n)
+	}
+}
@@ -2,72 +2,144 @@
 package config
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/foundry-ci/foundry/internal/notify"
 	"github.com/foundry-ci/foundry/internal/policy"
-	"gopkg.in/yaml.v3"
+	"github.com/foundry-ci/foundry/internal/testresults"
 )
 
 // Config represents the complete Foundry configuration loaded from .foundry.yaml.
 type Config struct {
-	Profiles map[string]Profile `yaml:"profiles" json:"profiles"`
-	Project  Project            `yaml:"project" json:"project"`
-	Policy   policy.Policy      `yaml:"policy" json:"policy"`
-	Version  int                `yaml:"version" json:"version"`
+	Profiles  map[string]Profile  `yaml:"profiles" json:"profiles"`
+	Project   Project             `yaml:"project" json:"project"`
+	Policy    policy.Policy       `yaml:"policy" json:"policy"`
+	Retention Retention           `yaml:"retention,omitempty" json:"retention,omitempty"`
+	Notify    []notify.Hook       `yaml:"notify,omitempty" json:"notify,omitempty"`
+	Include   []string            `yaml:"include,omitempty" json:"include,omitempty"` // files merged into this one
+	Vars      map[string]Var      `yaml:"vars,omitempty" json:"vars,omitempty"`
+	Templates map[string]Template `yaml:"templates,omitempty" json:"templates,omitempty"`
+	Version   int                 `yaml:"version" json:"version"`
+
+	// Warnings are problems that do not stop the config from loading, such
+	// as deprecated features.
+	Warnings []string `yaml:"-" json:"-"`
+	// Sources are the files the config was loaded from, the top-level file
+	// first.
+	Sources []Source `yaml:"-" json:"-"`
+
+	pos      positions   // where each part of the config is written
+	warnings Diagnostics // Warnings, located
 }
 
+// Retention limits how many past run directories are kept per profile. A run
+// is removed once it is not among the newest KeepRuns or is older than
+// KeepDays. Zero KeepRuns means DefaultKeepRuns; zero KeepDays means no age
+// limit.
+type Retention struct {
+	KeepRuns int `yaml:"keep_runs,omitempty" json:"keep_runs,omitempty"`
+	KeepDays int `yaml:"keep_days,omitempty" json:"keep_days,omitempty"`
+}
+
+// DefaultKeepRuns is the number of runs kept per profile when retention is
+// not configured.
+const DefaultKeepRuns = 20
+
 // Project represents project-level metadata.
 type Project struct {
 	Name string `yaml:"name" json:"name"`
 }
 
-// Profile represents a named collection of steps that may extend another profile.
+// Profile represents a named collection of steps that may extend other
+// profiles, in the order given by Linearize. Its webhooks apply in addition
+// to the project's and its parents', and its vars override theirs.
 type Profile struct {
-	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
-	Steps   []Step `yaml:"steps,omitempty" json:"steps,omitempty"`
+	Extends Parents          `yaml:"extends,omitempty" json:"extends,omitempty"`
+	Steps   []Step           `yaml:"steps,omitempty" json:"steps,omitempty"`
+	Notify  []notify.Hook    `yaml:"notify,omitempty" json:"notify,omitempty"`
+	Vars    map[string]Var   `yaml:"vars,omitempty" json:"vars,omitempty"`
+	Remove  []string         `yaml:"remove,omitempty" json:"remove,omitempty"` // IDs of inherited steps to drop
+	Patch   map[string]Patch `yaml:"patch,omitempty" json:"patch,omitempty"`   // step ID -> changes to the inherited step
+}
+
+// Patch changes some fields of a step a profile inherits, leaving the rest
+// as the parent defined them.
+type Patch struct {
+	Disabled  *bool             `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty" json:"env,omitempty"`               // variables added or replaced
+	EnvRemove []string          `yaml:"env_remove,omitempty" json:"env_remove,omitempty"` // variables removed
+	Deps      []string          `yaml:"deps,omitempty" json:"deps,omitempty"`             // dependencies added
+	Timeout   string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
 }
 
 // Step represents a single execution unit within a profile.
 type Step struct {
-	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
-	ID      string            `yaml:"id" json:"id"`
-	Type    string            `yaml:"type" json:"type"`
-	Timeout string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
-	Command []string          `yaml:"command,omitempty" json:"command,omitempty"`
-	Deps    []string          `yaml:"deps,omitempty" json:"deps,omitempty"`
-	Retries int               `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	ID       string            `yaml:"id" json:"id"`
+	Type     string            `yaml:"type" json:"type"`
+	Timeout  string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Command  []string          `yaml:"command,omitempty" json:"command,omitempty"`
+	Deps     []string          `yaml:"deps,omitempty" json:"deps,omitempty"`
+	Retries  int               `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Disabled bool              `yaml:"disabled,omitempty" json:"disabled,omitempty"` // planned but skipped, without skipping its dependents
+	Ready    *Probe            `yaml:"ready,omitempty" json:"ready,omitempty"`
+	Tags     []string          `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Inputs   []string          `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	Reports  map[string]string `yaml:"reports,omitempty" json:"reports,omitempty"` // report format -> glob of files the step writes
+
+	Paths       []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	PathsIgnore []string `yaml:"paths_ignore,omitempty" json:"paths_ignore,omitempty"`
+
+	Vars   map[string]Var      `yaml:"vars,omitempty" json:"vars,omitempty"`
+	Matrix map[string][]string `yaml:"matrix,omitempty" json:"matrix,omitempty"` // name -> values; the step runs once per combination
+
+	Template string            `yaml:"template,omitempty" json:"template,omitempty"` // name of the template the step is based on
+	With     map[string]string `yaml:"with,omitempty" json:"with,omitempty"`         // template param -> value
+
+	use     *templateUse
+	profile string // set by ResolveProfile
+}
+
+// Origin returns the profile that defined a step returned by ResolveProfile.
+func (s Step) Origin() string {
+	return s.profile
+}
+
+// Probe describes the readiness check for a service step. Exactly one of
+// TCP, HTTP, Command or Log must be set.
+type Probe struct {
+	TCP      string   `yaml:"tcp,omitempty" json:"tcp,omitempty"`           // host:port accepting connections
+	HTTP     string   `yaml:"http,omitempty" json:"http,omitempty"`         // URL answering 200 OK
+	Log      string   `yaml:"log,omitempty" json:"log,omitempty"`           // regex matched against service output
+	Timeout  string   `yaml:"timeout,omitempty" json:"timeout,omitempty"`   // overall deadline (default 30s)
+	Interval string   `yaml:"interval,omitempty" json:"interval,omitempty"` // delay between attempts (default 250ms)
+	Command  []string `yaml:"command,omitempty" json:"command,omitempty"`   // command exiting 0
 }
 
-// Load reads and parses a YAML configuration file, then validates the result.
+// Load reads and parses a YAML configuration file and the files it
+// includes, then validates the result.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("load config %q: %w", path, err)
 	}
-	return LoadFromBytes(data)
+	return load(path, data)
 }
 
-// LoadFromBytes parses YAML configuration from bytes and validates the result.
-// Unknown fields in the YAML cause a parse error.
+// LoadFromBytes parses YAML configuration of any supported version from
+// bytes and validates the result. Unknown fields in the YAML cause a parse
+// error. Included files are resolved against the working directory.
 func LoadFromBytes(data []byte) (*Config, error) {
-	cfg := &Config{}
-
-	decoder := yaml.NewDecoder(bytes.NewReader(data))
-	decoder.KnownFields(true)
-
-	if err := decoder.Decode(cfg); err != nil {
-		return nil, fmt.Errorf("parse config YAML: %w", err)
-	}
-
-	if err := Validate(cfg); err != nil {
-		return nil, err
-	}
-
-	return cfg, nil
+	return load("", data)
 }
 
 // RawBytes returns the raw YAML bytes for a config file at the given path.
@@ -80,160 +152,449 @@ func RawBytes(path string) ([]byte, error) {
 	return data, nil
 }
 
-// Validate checks that the configuration is well-formed and internally consistent.
+// Validate checks that the configuration is well-formed and internally
+// consistent. It reports every problem it finds, as Diagnostics, though
+// at most one for each step.
 func Validate(cfg *Config) error {
 	if cfg == nil {
 		return fmt.Errorf("validate: config is nil")
 	}
+	v := &validator{cfg: cfg}
 
-	if cfg.Version != 1 {
-		return fmt.Errorf("validate: unsupported config version %d (expected 1)", cfg.Version)
+	if _, ok := formats[cfg.Version]; !ok {
+		v.errorf("/version", "unsupported config version %d (expected %s)", cfg.Version, supportedVersions())
 	}
 
 	if cfg.Project.Name == "" {
-		return fmt.Errorf("validate: project.name must be non-empty")
+		v.errorf("/project/name", "project.name must be non-empty")
 	}
 
 	if len(cfg.Profiles) == 0 {
-		return fmt.Errorf("validate: at least one profile must be defined")
+		v.errorf("/profiles", "at least one profile must be defined")
 	}
 
-	for profileName, profile := range cfg.Profiles {
-		if err := validateProfile(profileName, profile, cfg); err != nil {
-			return err
+	if cfg.Retention.KeepRuns < 0 || cfg.Retention.KeepDays < 0 {
+		v.errorf("/retention", "retention.keep_runs and retention.keep_days must not be negative")
+	}
+
+	for i, hook := range cfg.Notify {
+		if err := hook.Validate(); err != nil {
+			v.errorf("/notify/"+strconv.Itoa(i), "notify[%d]: %v", i, err)
 		}
 	}
 
+	if err := checkVars(cfg.Vars, scope{vars: cfg.Vars}); err != nil {
+		v.errorf("/vars", "%v", err)
+	}
+
+	for _, profileName := range sortedKeys(cfg.Profiles) {
+		v.profile(profileName, cfg.Profiles[profileName])
+	}
+
+	if len(v.ds) > 0 {
+		return v.ds
+	}
 	return nil
 }
 
-// validStepTypes lists the allowed step types.
-var validStepTypes = []string{"shell", "plugin", "script"}
+// validator collects the problems Validate finds.
+type validator struct {
+	cfg *Config
+	ds  Diagnostics
+}
 
-func validateProfile(name string, profile Profile, cfg *Config) error {
-	// Validate extends reference.
-	if profile.Extends != "" {
-		if _, exists := cfg.Profiles[profile.Extends]; !exists {
-			return fmt.Errorf("validate: profile %q extends non-existent profile %q", name, profile.Extends)
-		}
+// errorf reports a problem with the part of the config at path, once.
+func (v *validator) errorf(path, format string, args ...any) {
+	d := newDiagnostic(v.cfg.pos.lookup(path), "validate", fmt.Sprintf(format, args...))
+	d.path = path
+	if !slices.ContainsFunc(v.ds, func(o Diagnostic) bool { return o.text == d.text }) {
+		v.ds = append(v.ds, d)
 	}
+}
+
+// validStepTypes lists the allowed step types. The others say which types
+// must set, may not set, or alone may set a field; Validate and the schema
+// both follow them.
+var (
+	validStepTypes     = []string{"shell", "service", "approval", "plugin", "script"}
+	commandStepTypes   = []string{"shell", "service"} // must set command
+	noCommandStepTypes = []string{"approval"}         // may not set command
+	probeStepTypes     = []string{"service"}          // may set ready
+	reportStepTypes    = []string{"shell"}            // may set reports
+)
 
-	// Check extends cycle.
-	visited := map[string]bool{name: true}
-	if err := checkExtendsCycle(name, profile, cfg, visited); err != nil {
-		return err
+func (v *validator) profile(name string, profile Profile) {
+	cfg, at := v.cfg, profilePath(name)
+
+	// Steps are checked on their own first. Their vars, deps and what the
+	// profile removes and patches are only checked if the profile's extends
+	// can be resolved.
+	linear := v.extends(name, profile)
+	var vars map[string]Var
+	if linear {
+		vars = ResolveVars(cfg, name)
+		if err := checkVars(profile.Vars, scope{vars: vars}); err != nil {
+			v.errorf(at+"/vars", "profile %q: %v", name, err)
+		}
 	}
 
 	// Validate steps within this profile.
 	stepIDs := make(map[string]bool, len(profile.Steps))
 	for _, step := range profile.Steps {
+		ref, at := cfg.stepRef(step), stepPath(name, step.ID)
 		if step.ID == "" {
-			return fmt.Errorf("validate: profile %q has step with empty id", name)
+			v.errorf(at, "profile %q has step with empty id", name)
+			continue
 		}
 		if stepIDs[step.ID] {
-			return fmt.Errorf("validate: profile %q has duplicate step id %q", name, step.ID)
+			v.errorf(at, "profile %q has duplicate step id %q", name, step.ID)
+			continue
 		}
 		stepIDs[step.ID] = true
 
 		if !slices.Contains(validStepTypes, step.Type) {
-			return fmt.Errorf("validate: profile %q step %q has invalid type %q (must be shell, plugin, or script)", name, step.ID, step.Type)
+			v.errorf(at+"/type", "profile %q %s has invalid type %q (must be shell, service, approval, plugin, or script)", name, ref, step.Type)
+			continue
 		}
 
-		if step.Type == "shell" && len(step.Command) == 0 {
-			return fmt.Errorf("validate: profile %q step %q: shell steps must have non-empty command", name, step.ID)
+		if slices.Contains(commandStepTypes, step.Type) && len(step.Command) == 0 {
+			v.errorf(at, "profile %q %s: %s steps must have non-empty command", name, ref, step.Type)
+			continue
 		}
 
-		for _, dep := range step.Deps {
-			// Dep might reference a step defined before this one; re-check after all steps.
-			_ = dep
+		if slices.Contains(noCommandStepTypes, step.Type) && len(step.Command) > 0 {
+			v.errorf(at+"/command", "profile %q %s: %s steps cannot have a command", name, ref, step.Type)
+			continue
+		}
+
+		if err := validateProbe(step); err != nil {
+			v.errorf(at+"/ready", "profile %q %s: %v", name, ref, err)
+			continue
+		}
+
+		if err := validateReports(step); err != nil {
+			v.errorf(at+"/reports", "profile %q %s: %v", name, ref, err)
+			continue
+		}
+
+		if linear {
+			if err := checkStep(step, vars); err != nil {
+				v.errorf(at, "profile %q %s: %v", name, ref, err)
+			}
+		}
+	}
+
+	for i, hook := range profile.Notify {
+		if err := hook.Validate(); err != nil {
+			v.errorf(at+"/notify/"+strconv.Itoa(i), "profile %q notify[%d]: %v", name, i, err)
 		}
 	}
 
-	// Second pass: validate deps reference existing step IDs within this profile.
+	if !linear {
+		return
+	}
+
+	// Second pass: resolve the profile, which checks what it removes and
+	// patches against the steps it inherits. Deps may then reference any
+	// step of the resolved profile, and no matrix expansion may take the ID
+	// of another step.
+	resolved, err := resolve(cfg, name)
+	if err != nil {
+		var pe *pathError
+		if errors.As(err, &pe) {
+			v.errorf(pe.path, "%v", err)
+		} else {
+			v.errorf(at, "%v", err)
+		}
+		return
+	}
+	resolvedIDs := make(map[string]bool, len(resolved))
+	for _, step := range resolved {
+		resolvedIDs[step.ID] = true
+	}
 	for _, step := range profile.Steps {
-		for _, dep := range step.Deps {
-			if !stepIDs[dep] {
-				return fmt.Errorf("validate: profile %q step %q: dependency %q not found in profile", name, step.ID, dep)
+		ref, at := cfg.stepRef(step), stepPath(name, step.ID)
+		for _, values := range matrixCombinations(step.Matrix) {
+			if id := matrixID(step.ID, step.Matrix, values); len(step.Matrix) > 0 && resolvedIDs[id] {
+				v.errorf(at+"/matrix", "profile %q %s: matrix expansion %q has the ID of another step", name, ref, id)
+			}
+		}
+		for i, dep := range step.Deps {
+			if !resolvedIDs[dep] {
+				v.errorf(at+"/deps/"+strconv.Itoa(i), "profile %q %s: %s", name, ref, depNotFound(cfg, name, dep))
 			}
 		}
 	}
 
-	return nil
+	for _, id := range sortedKeys(profile.Patch) {
+		patch, at := profile.Patch[id], at+"/patch/"+id
+		for i, dep := range patch.Deps {
+			if !resolvedIDs[dep] {
+				v.errorf(at+"/deps/"+strconv.Itoa(i), "profile %q patch %q: %s", name, id, depNotFound(cfg, name, dep))
+			}
+		}
+		step := resolved[slices.IndexFunc(resolved, func(s Step) bool { return s.ID == id })]
+		sc := scope{vars: mergeMaps(vars, step.Vars), matrix: step.Matrix}
+		for _, k := range sortedKeys(patch.Env) {
+			if err := checkTemplate(patch.Env[k], sc); err != nil {
+				v.errorf(at+"/env/"+k, "profile %q patch %q: env %s: %v", name, id, k, err)
+			}
+		}
+		if err := checkTemplate(patch.Timeout, sc); err != nil {
+			v.errorf(at+"/timeout", "profile %q patch %q: timeout: %v", name, id, err)
+		}
+	}
+}
+
+// extends checks the profiles a profile extends, reporting whether they
+// can be linearized. A cycle is reported once, for the first of its
+// profiles by name, and a problem with a profile extended, for that
+// profile.
+func (v *validator) extends(name string, profile Profile) bool {
+	cfg, at := v.cfg, profilePath(name)+"/extends"
+	ok := true
+	for i, parent := range profile.Extends {
+		if _, exists := cfg.Profiles[parent]; !exists {
+			v.errorf(at, "profile %q extends non-existent profile %q", name, parent)
+			ok = false
+		}
+		if slices.Contains(profile.Extends[:i], parent) {
+			v.errorf(at, "profile %q extends %q more than once", name, parent)
+			ok = false
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	if cycle := extendsCycle(cfg, []string{name}); cycle != nil {
+		if cycle[0] == name && name == slices.Min(cycle) {
+			v.errorf(at, "profile %q: circular extends chain detected (%s)", name, strings.Join(cycle, " -> "))
+		}
+		return false
+	}
+	for _, parent := range profile.Extends {
+		if _, err := Linearize(cfg, parent); err != nil {
+			return false
+		}
+	}
+	if _, err := Linearize(cfg, name); err != nil {
+		v.errorf(at, "%v", err)
+		return false
+	}
+	return true
+}
+
+// depNotFound describes a dependency missing from a resolved profile: the
+// profiles it was looked for in, and any others that define it.
+func depNotFound(cfg *Config, name, dep string) string {
+	order, _ := Linearize(cfg, name)
+	msg := fmt.Sprintf("dependency %q not found in profile", dep)
+	if len(order) > 1 {
+		msg = fmt.Sprintf("dependency %q not found in profile or the profiles it extends (%s)", dep, strings.Join(order[1:], ", "))
+	}
+	var definedIn []string
+	for _, other := range sortedKeys(cfg.Profiles) {
+		if !slices.Contains(order, other) && slices.ContainsFunc(cfg.Profiles[other].Steps, func(s Step) bool { return s.ID == dep }) {
+			definedIn = append(definedIn, strconv.Quote(other))
+		}
+	}
+	if len(definedIn) > 0 {
+		msg += fmt.Sprintf("; it is defined in profile %s, which %q does not extend", strings.Join(definedIn, " and "), name)
+	}
+	return msg
 }
 
-func checkExtendsCycle(origin string, profile Profile, cfg *Config, visited map[string]bool) error {
-	if profile.Extends == "" {
+func validateProbe(step Step) error {
+	if step.Ready == nil {
 		return nil
 	}
+	if !slices.Contains(probeStepTypes, step.Type) {
+		return fmt.Errorf("ready probe is only valid on service steps")
+	}
 
-	if visited[profile.Extends] {
-		return fmt.Errorf("validate: profile %q: circular extends chain detected (reaches %q again)", origin, profile.Extends)
+	set := 0
+	for _, present := range []bool{step.Ready.TCP != "", step.Ready.HTTP != "", len(step.Ready.Command) > 0, step.Ready.Log != ""} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("ready probe must set exactly one of tcp, http, command or log")
 	}
 
-	visited[profile.Extends] = true
+	if step.Ready.Log != "" {
+		if _, err := regexp.Compile(step.Ready.Log); err != nil {
+			return fmt.Errorf("ready.log: %w", err)
+		}
+	}
+	if step.Ready.Timeout != "" {
+		if _, err := time.ParseDuration(step.Ready.Timeout); err != nil {
+			return fmt.Errorf("ready.timeout: %w", err)
+		}
+	}
+	if step.Ready.Interval != "" {
+		if _, err := time.ParseDuration(step.Ready.Interval); err != nil {
+			return fmt.Errorf("ready.interval: %w", err)
+		}
+	}
+
+	return nil
+}
 
-	parent, exists := cfg.Profiles[profile.Extends]
-	if !exists {
-		return fmt.Errorf("validate: profile %q extends non-existent profile %q", origin, profile.Extends)
+func validateReports(step Step) error {
+	if len(step.Reports) == 0 {
+		return nil
+	}
+	if !slices.Contains(reportStepTypes, step.Type) {
+		return fmt.Errorf("reports are only valid on shell steps")
 	}
+	for format, pattern := range step.Reports {
+		if !slices.Contains(testresults.Formats, format) {
+			return fmt.Errorf("reports: unknown format %q (must be %s)", format, strings.Join(testresults.Formats, " or "))
+		}
+		if pattern == "" {
+			return fmt.Errorf("reports.%s: path is empty", format)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("reports.%s: %w", format, err)
+		}
+	}
+	return nil
+}
 
-	return checkExtendsCycle(origin, parent, cfg, visited)
+// extendsCycle walks the profiles extended from the last profile of path,
+// returning the first chain of profiles that extends itself, ending with
+// the profile it starts with. Profiles that do not exist are skipped.
+func extendsCycle(cfg *Config, path []string) []string {
+	profile := cfg.Profiles[path[len(path)-1]]
+	for _, parent := range profile.Extends {
+		if i := slices.Index(path, parent); i >= 0 {
+			return append(slices.Clone(path[i:]), parent)
+		}
+		if _, exists := cfg.Profiles[parent]; !exists {
+			continue
+		}
+		if cycle := extendsCycle(cfg, append(path, parent)); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
 }
 
-// ResolveProfile resolves a profile by name, following the extends chain and
-// merging steps. Parent steps are inherited; child steps override by ID or are
-// appended.
+// ResolveProfile resolves a profile by name, merging the steps of the
+// profiles it extends in the order given by Linearize. Each profile in turn
+// drops the inherited steps it removes, then its steps override inherited
+// ones by ID or are appended, then its patches apply.
 func ResolveProfile(cfg *Config, name string) ([]Step, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("resolve profile: config is nil")
 	}
 
-	profile, exists := cfg.Profiles[name]
-	if !exists {
+	if _, exists := cfg.Profiles[name]; !exists {
 		return nil, fmt.Errorf("resolve profile: profile %q not found", name)
 	}
 
-	visited := map[string]bool{name: true}
-	return resolveProfileChain(profile, cfg, visited)
+	steps, err := resolve(cfg, name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve profile: %w", err)
+	}
+	return steps, nil
 }
 
-func resolveProfileChain(profile Profile, cfg *Config, visited map[string]bool) ([]Step, error) {
-	var baseSteps []Step
+func resolve(cfg *Config, name string) ([]Step, error) {
+	order, err := Linearize(cfg, name)
+	if err != nil {
+		return nil, err
+	}
 
-	if profile.Extends != "" {
-		if visited[profile.Extends] {
-			return nil, fmt.Errorf("resolve profile: circular extends chain detected")
+	var steps []Step
+	type removal struct{ profile, path string }
+	removedBy := map[string]removal{} // step ID -> where it was removed
+	index := func(id string) int {
+		return slices.IndexFunc(steps, func(s Step) bool { return s.ID == id })
+	}
+	for _, profileName := range slices.Backward(order) {
+		profile := cfg.Profiles[profileName]
+		for j, id := range profile.Remove {
+			path := profilePath(profileName) + "/remove/" + strconv.Itoa(j)
+			i := index(id)
+			if i < 0 {
+				return nil, &pathError{path, fmt.Errorf("profile %q removes step %q, which it does not inherit", profileName, id)}
+			}
+			steps = slices.Delete(steps, i, i+1)
+			removedBy[id] = removal{profileName, path}
 		}
-		visited[profile.Extends] = true
-
-		parent, exists := cfg.Profiles[profile.Extends]
-		if !exists {
-			return nil, fmt.Errorf("resolve profile: extended profile %q not found", profile.Extends)
+		for _, step := range profile.Steps {
+			step.profile = profileName
+			if i := index(step.ID); i >= 0 {
+				steps[i] = step
+			} else {
+				steps = append(steps, step)
+			}
+			delete(removedBy, step.ID)
 		}
-
-		var err error
-		baseSteps, err = resolveProfileChain(parent, cfg, visited)
-		if err != nil {
-			return nil, err
+		for _, id := range sortedKeys(profile.Patch) {
+			i := index(id)
+			if i < 0 {
+				return nil, &pathError{profilePath(profileName) + "/patch/" + id, fmt.Errorf("profile %q patches step %q, which it does not inherit", profileName, id)}
+			}
+			steps[i] = profile.Patch[id].apply(steps[i])
 		}
 	}
 
-	// Merge current profile's steps onto base.
-	for _, step := range profile.Steps {
-		replaced := false
-		for i, existing := range baseSteps {
-			if existing.ID == step.ID {
-				baseSteps[i] = step
-				replaced = true
-				break
+	for _, step := range steps {
+		for _, dep := range step.Deps {
+			if by, ok := removedBy[dep]; ok {
+				return nil, &pathError{by.path, fmt.Errorf("profile %q removes step %q, but step %q (from profile %q) depends on it; remove that step too, or disable %q instead", by.profile, dep, step.ID, step.profile, dep)}
 			}
 		}
-		if !replaced {
-			baseSteps = append(baseSteps, step)
+	}
+	return steps, nil
+}
+
+// pathError is an error about the part of the config at path.
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string { return e.err.Error() }
+
+func (e *pathError) Unwrap() error { return e.err }
+
+// apply returns step with the patch applied. The step's env and deps are
+// copied, not changed in place, as other profiles may share them.
+func (p Patch) apply(step Step) Step {
+	if p.Disabled != nil {
+		step.Disabled = *p.Disabled
+	}
+	if len(p.Env) > 0 || len(p.EnvRemove) > 0 {
+		env := mergeMaps(step.Env, p.Env)
+		for _, k := range p.EnvRemove {
+			delete(env, k)
 		}
+		step.Env = env
+	}
+	if len(p.Deps) > 0 {
+		step.Deps = append(slices.Clip(step.Deps), p.Deps...)
 	}
+	if p.Timeout != "" {
+		step.Timeout = p.Timeout
+	}
+	return step
+}
 
-	return baseSteps, nil
+// ResolveNotify returns the webhooks of a profile: the project's, then those
+// of each profile it extends, in the reverse of the order given by
+// Linearize, then its own.
+func ResolveNotify(cfg *Config, name string) []notify.Hook {
+	order, _ := Linearize(cfg, name) // validated configs always linearise
+	hooks := slices.Clone(cfg.Notify)
+	for _, profileName := range slices.Backward(order) {
+		hooks = append(hooks, cfg.Profiles[profileName].Notify...)
+	}
+	return hooks
 }
 
 // LogConfig logs the loaded configuration at info level for debugging.
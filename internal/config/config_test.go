@@ -1,8 +1,17 @@
 package config
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/foundry-ci/foundry/internal/vcs"
+	"github.com/foundry-ci/foundry/schemas"
 )
 
 // TestLoadFromBytes_Valid parses valid YAML and verifies all fields are correctly loaded.
@@ -84,7 +93,7 @@ profiles:
 		t.Fatal("expected 'ci' profile to exist")
 	}
 
-	if ciProfile.Extends != "default" {
+	if !slices.Equal(ciProfile.Extends, Parents{"default"}) {
 		t.Errorf("expected 'ci' profile to extend 'default', got %q", ciProfile.Extends)
 	}
 }
@@ -117,27 +126,235 @@ func TestLoadFromBytes_InvalidVersion(t *testing.T) {
 	t.Parallel()
 
 	yaml := `
-version: 2
+version: 3
 project:
   name: "test-project"
 profiles:
   default:
     steps:
-      - id: test
+      test:
         type: shell
         command: ["echo", "test"]
 `
 
 	_, err := LoadFromBytes([]byte(yaml))
 	if err == nil {
-		t.Fatal("expected error for version 2, got nil")
+		t.Fatal("expected error for version 3, got nil")
 	}
 
-	if err.Error() != "validate: unsupported config version 2 (expected 1)" {
+	if err.Error() != "validate: unsupported config version 3 (expected 1 or 2)" {
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
 
+// TestLoadFromBytes_V2 verifies that version 2 configs, which key steps by
+// ID, load into the same model as version 1, without its deprecation
+// warning.
+func TestLoadFromBytes_V2(t *testing.T) {
+	t.Parallel()
+
+	v1 := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: lint
+        type: shell
+        command: ["echo", "lint"]
+      - id: test
+        type: shell
+        deps: ["lint"]
+        command: ["echo", "test"]
+`
+	v2 := `
+version: 2
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      lint:
+        type: shell
+        command: ["echo", "lint"]
+      test:
+        type: shell
+        deps: ["lint"]
+        command: ["echo", "test"]
+`
+
+	old, err := LoadFromBytes([]byte(v1))
+	if err != nil {
+		t.Fatalf("LoadFromBytes v1 failed: %v", err)
+	}
+	cfg, err := LoadFromBytes([]byte(v2))
+	if err != nil {
+		t.Fatalf("LoadFromBytes v2 failed: %v", err)
+	}
+
+	if len(old.Warnings) != 1 || !strings.Contains(old.Warnings[0], "anvil migrate") {
+		t.Errorf("expected a deprecation warning for version 1, got %v", old.Warnings)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("expected no warnings for version 2, got %v", cfg.Warnings)
+	}
+	if !reflect.DeepEqual(old.Profiles, cfg.Profiles) {
+		t.Errorf("expected the same profiles, got %+v and %+v", old.Profiles, cfg.Profiles)
+	}
+
+	for _, tt := range []struct {
+		steps, wantErr string
+	}{
+		{"\n      - id: test\n        type: shell", `profile "default": steps must map step IDs to steps`},
+		{"\n      test:\n        id: test\n        type: shell", `line 8: profile "default" step "test": id is given by the step's key`},
+		{"\n      test:\n        type: shell\n        comand: [echo]", "line 9: field comand not found in type config.Step"},
+		{"\n      test:\n        type: service\n        command: [db]\n        ready: {tpc: x}", "line 10: field tpc not found in type config.Probe"},
+	} {
+		_, err := LoadFromBytes([]byte("version: 2\nproject:\n  name: p\nprofiles:\n  default:\n    steps:" + tt.steps + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+		}
+	}
+}
+
+// TestMigrate verifies that a version 1 config is rewritten as version 2
+// with its comments and key order kept.
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	v1 := `# Pipeline for the demo project.
+version: 1
+project:
+  name: demo
+profiles:
+  default:
+    # Steps run in dependency order.
+    steps:
+      # Lint first.
+      - id: lint # fast
+        type: shell
+        command: ["go", "vet", "./..."]
+      - id: approve
+        type: approval
+        deps: [lint]
+      - {id: test, type: shell, deps: [lint], command: [go, test]}
+  ci:
+    extends: default
+    steps: []
+`
+	want := `# Pipeline for the demo project.
+version: 2
+project:
+  name: demo
+profiles:
+  default:
+    # Steps run in dependency order.
+    steps:
+      # Lint first.
+      lint: # fast
+        type: shell
+        command: ["go", "vet", "./..."]
+      approve:
+        type: approval
+        deps: [lint]
+      test: {type: shell, deps: [lint], command: [go, test]}
+  ci:
+    extends: default
+    steps: {}
+`
+
+	got, from, err := Migrate([]byte(v1), 0)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if from != 1 {
+		t.Errorf("expected version 1, got %d", from)
+	}
+	if string(got) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	again, from, err := Migrate(got, 0)
+	if err != nil || from != CurrentVersion || string(again) != string(got) {
+		t.Errorf("expected a current config unchanged, got version %d, %v:\n%s", from, err, again)
+	}
+}
+
+// TestMigrateFile verifies that the files a config includes are migrated
+// with it, those without a version from the version of the file including
+// them, and that the result loads.
+func TestMigrateFile(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		".foundry.yaml": `version: 1
+project:
+  name: demo
+include: [ci/extra.yaml, ci/current.yaml]
+profiles:
+  default:
+    steps:
+      - id: lint
+        type: shell
+        command: [go, vet, ./...]
+`,
+		"ci/extra.yaml": `# Shared test steps.
+profiles:
+  default:
+    steps:
+      - id: test
+        type: shell
+        deps: [lint]
+        command: [go, test, ./...]
+`,
+		"ci/current.yaml": `version: 2
+profiles:
+  release:
+    extends: default
+`,
+	})
+	path := filepath.Join(dir, ".foundry.yaml")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Warnings) != 1 {
+		t.Errorf("expected one deprecation warning for the load, got %q", cfg.Warnings)
+	}
+
+	files, err := MigrateFile(path)
+	if err != nil {
+		t.Fatalf("MigrateFile failed: %v", err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f.Path)
+		got = append(got, filepath.ToSlash(rel)+" "+strconv.Itoa(f.From))
+		if err := os.WriteFile(f.Path, f.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{".foundry.yaml 1", "ci/extra.yaml 1", "ci/current.yaml 2"}; !slices.Equal(got, want) {
+		t.Errorf("expected files %q, got %q", want, got)
+	}
+	if want := "# Shared test steps.\nversion: 2\nprofiles:\n  default:\n    steps:\n      test:\n"; !strings.HasPrefix(string(files[1].Data), want) {
+		t.Errorf("expected the include to be given a version, got:\n%s", files[1].Data)
+	}
+
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load after migrating failed: %v", err)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("expected no warnings after migrating, got %q", cfg.Warnings)
+	}
+	if steps, err := ResolveProfile(cfg, "release"); err != nil || len(steps) != 2 {
+		t.Errorf("expected lint and test in release, got %v (err %v)", steps, err)
+	}
+}
+
 // TestLoadFromBytes_EmptyProjectName verifies that empty project names are rejected.
 func TestLoadFromBytes_EmptyProjectName(t *testing.T) {
 	t.Parallel()
@@ -214,7 +431,7 @@ profiles:
 		t.Fatal("expected error for invalid step type, got nil")
 	}
 
-	if err.Error() != "validate: profile \"default\" step \"test\" has invalid type \"invalid\" (must be shell, plugin, or script)" {
+	if err.Error() != "validate: profile \"default\" step \"test\" has invalid type \"invalid\" (must be shell, service, approval, plugin, or script)" {
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
@@ -370,13 +587,13 @@ func TestResolveProfile_CycleDetection(t *testing.T) {
 		Project: Project{Name: "test"},
 		Profiles: map[string]Profile{
 			"a": {
-				Extends: "b",
+				Extends: Parents{"b"},
 				Steps: []Step{
 					{ID: "step-a", Type: "shell", Command: []string{"echo", "a"}},
 				},
 			},
 			"b": {
-				Extends: "a",
+				Extends: Parents{"a"},
 				Steps: []Step{
 					{ID: "step-b", Type: "shell", Command: []string{"echo", "b"}},
 				},
@@ -425,3 +642,1063 @@ profiles:
 		t.Errorf("unexpected error message: %v", err)
 	}
 }
+
+// TestLoadFromBytes_ServiceProbe verifies readiness probe validation on service steps.
+func TestLoadFromBytes_ServiceProbe(t *testing.T) {
+	t.Parallel()
+
+	valid := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: db
+        type: service
+        command: ["postgres"]
+        ready:
+          tcp: "localhost:5432"
+          timeout: 1m
+      - id: test
+        type: shell
+        deps: ["db"]
+        command: ["echo", "test"]
+`
+
+	cfg, err := LoadFromBytes([]byte(valid))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	if ready := cfg.Profiles["default"].Steps[0].Ready; ready == nil || ready.TCP != "localhost:5432" {
+		t.Errorf("expected tcp probe on db, got %+v", ready)
+	}
+
+	twoProbes := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: db
+        type: service
+        command: ["postgres"]
+        ready:
+          tcp: "localhost:5432"
+          log: "ready"
+`
+
+	_, err = LoadFromBytes([]byte(twoProbes))
+	if err == nil {
+		t.Fatal("expected error for probe with two checks, got nil")
+	}
+	if !strings.Contains(err.Error(), "exactly one of tcp, http, command or log") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+
+	shellProbe := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: test
+        type: shell
+        command: ["echo", "test"]
+        ready:
+          log: "ready"
+`
+
+	_, err = LoadFromBytes([]byte(shellProbe))
+	if err == nil {
+		t.Fatal("expected error for probe on shell step, got nil")
+	}
+}
+
+// TestLoadFromBytes_ApprovalStep verifies approval steps need no command and may not have one.
+func TestLoadFromBytes_ApprovalStep(t *testing.T) {
+	t.Parallel()
+
+	valid := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: gate
+        type: approval
+      - id: deploy
+        type: shell
+        deps: ["gate"]
+        command: ["./deploy.sh"]
+`
+	if _, err := LoadFromBytes([]byte(valid)); err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+
+	withCommand := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: gate
+        type: approval
+        command: ["true"]
+`
+	_, err := LoadFromBytes([]byte(withCommand))
+	if err == nil {
+		t.Fatal("expected error for approval step with a command")
+	}
+	if err.Error() != "validate: profile \"default\" step \"gate\": approval steps cannot have a command" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestLoadFromBytes_Reports verifies report declarations are validated.
+func TestLoadFromBytes_Reports(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		reports string
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			reports: "{go-test-json: out/test.json, junit: \"build/*.xml\"}",
+		},
+		{
+			name:    "unknown format",
+			reports: "{xunit: out.xml}",
+			wantErr: `validate: profile "default" step "test": reports: unknown format "xunit" (must be go-test-json or junit)`,
+		},
+		{
+			name:    "bad pattern",
+			reports: "{junit: \"build/[*.xml\"}",
+			wantErr: `validate: profile "default" step "test": reports.junit: syntax error in pattern`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			yaml := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    steps:
+      - id: test
+        type: shell
+        command: ["go", "test", "-json", "./..."]
+        reports: ` + tt.reports + "\n"
+			_, err := LoadFromBytes([]byte(yaml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadFromBytes failed: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadFromBytes_Notify(t *testing.T) {
+	t.Parallel()
+
+	base := `
+version: 1
+project:
+  name: "test-project"
+notify:
+  - url: https://hooks.example.com/all
+    on: [finished]
+profiles:
+  default:
+    notify:
+      - url: https://hooks.example.com/default
+    steps:
+      - id: build
+        type: shell
+        command: ["make"]
+  release:
+    extends: default
+    notify:
+      - url: https://hooks.example.com/release
+        secret_env: HOOK_SECRET
+        retries: 5
+        body: '{"text": {{json .Status}}}'
+`
+	cfg, err := LoadFromBytes([]byte(base))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	var urls []string
+	for _, h := range ResolveNotify(cfg, "release") {
+		urls = append(urls, h.URL)
+	}
+	want := []string{"https://hooks.example.com/all", "https://hooks.example.com/default", "https://hooks.example.com/release"}
+	if !slices.Equal(urls, want) {
+		t.Errorf("expected hooks %v, got %v", want, urls)
+	}
+
+	tests := []struct {
+		name    string
+		hook    string
+		wantErr string
+	}{
+		{"bad url", "{url: hooks.example.com}", `validate: profile "default" notify[0]: url "hooks.example.com" must be an http or https URL`},
+		{"unknown event", "{url: 'https://h', on: [done]}", `validate: profile "default" notify[0]: on: unknown event "done" (must be finished, failed, recovered)`},
+		{"bad template", "{url: 'https://h', body: '{{.Status'}", `validate: profile "default" notify[0]: body: template: body:1: unclosed action`},
+		{"bad timeout", "{url: 'https://h', timeout: soon}", `validate: profile "default" notify[0]: invalid timeout "soon"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			yaml := `
+version: 1
+project:
+  name: "test-project"
+profiles:
+  default:
+    notify: [` + tt.hook + `]
+    steps:
+      - id: build
+        type: shell
+        command: ["make"]
+`
+			_, err := LoadFromBytes([]byte(yaml))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// writeFiles writes files, by path relative to a new temporary directory,
+// and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestLoad_Include verifies that included files are merged, relative to the
+// including file, with the including file's steps taking precedence.
+func TestLoad_Include(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		".foundry.yaml": `
+version: 2
+project:
+  name: demo
+include: [ci/go.yaml, ci/release.yaml]
+profiles:
+  default:
+    steps:
+      test:
+        type: shell
+        deps: [lint]
+        command: [go, test, -race, ./...]
+`,
+		"ci/go.yaml": `
+include: [common.yaml]
+profiles:
+  default:
+    steps:
+      test:
+        type: shell
+        deps: [lint]
+        command: [go, test, ./...]
+`,
+		"ci/common.yaml": `
+version: 1
+notify:
+  - url: https://hooks.example.com/ci
+profiles:
+  default:
+    steps:
+      - id: lint
+        type: shell
+        command: [go, vet, ./...]
+`,
+		"ci/release.yaml": `
+profiles:
+  release:
+    extends: default
+    steps:
+      publish:
+        type: shell
+        command: [./publish.sh]
+`,
+	})
+
+	cfg, err := Load(filepath.Join(dir, ".foundry.yaml"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	steps, err := ResolveProfile(cfg, "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range steps {
+		ids = append(ids, s.ID)
+	}
+	if want := []string{"lint", "test", "publish"}; !slices.Equal(ids, want) {
+		t.Errorf("expected steps %v, got %v", want, ids)
+	}
+	if got := steps[1].Command; !slices.Contains(got, "-race") {
+		t.Errorf("expected the including file's test step, got %v", got)
+	}
+	if len(cfg.Notify) != 1 {
+		t.Errorf("expected the included hook, got %v", cfg.Notify)
+	}
+	if len(cfg.Warnings) != 1 || !strings.HasPrefix(cfg.Warnings[0], filepath.Join(dir, "ci", "common.yaml")+": config version 1 is deprecated") {
+		t.Errorf("expected a deprecation warning naming common.yaml, got %v", cfg.Warnings)
+	}
+
+	if len(cfg.Sources) != 4 {
+		t.Fatalf("expected 4 sources, got %d", len(cfg.Sources))
+	}
+	content := string(cfg.Content())
+	for _, s := range cfg.Sources {
+		if !strings.Contains(content, string(s.Data)) {
+			t.Errorf("expected the content to cover %s", s.Path)
+		}
+	}
+	if !strings.Contains(content, "\n# include: ci/common.yaml\n") {
+		t.Errorf("expected includes named relative to the config, got:\n%s", content)
+	}
+}
+
+func TestLoad_IncludeErrors(t *testing.T) {
+	t.Parallel()
+
+	root := "version: 2\nproject:\n  name: demo\ninclude: [a.yaml, b.yaml]\nprofiles:\n  default: {}\n"
+	step := "profiles:\n  default:\n    steps:\n      lint: {type: shell, command: [true]}\n"
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "conflicting steps",
+			files:   map[string]string{"a.yaml": step, "b.yaml": step},
+			wantErr: `profile "default" step "lint" is defined in both DIR/a.yaml and DIR/b.yaml`,
+		},
+		{
+			name: "conflicting extends",
+			files: map[string]string{
+				"a.yaml": "profiles:\n  ci:\n    extends: default\n",
+				"b.yaml": "profiles:\n  ci:\n    extends: release\n",
+			},
+			wantErr: `profile "ci" extends "default" in DIR/a.yaml but "release" in DIR/b.yaml`,
+		},
+		{
+			name:    "conflicting vars",
+			files:   map[string]string{"a.yaml": "vars:\n  go: '1.22'\n", "b.yaml": "vars:\n  go: '1.23'\n"},
+			wantErr: `vars.go is defined in both DIR/a.yaml and DIR/b.yaml`,
+		},
+		{
+			name:    "conflicting templates",
+			files:   map[string]string{"a.yaml": "templates:\n  t: {type: shell}\n", "b.yaml": "templates:\n  t: {type: service}\n"},
+			wantErr: `template "t" is defined in both DIR/a.yaml and DIR/b.yaml`,
+		},
+		{
+			name: "template from another file",
+			files: map[string]string{
+				"a.yaml": "templates:\n  t:\n    params: {pkg: null}\n    type: shell\n",
+				"b.yaml": "profiles:\n  default:\n    steps:\n      s: {template: t}\n",
+			},
+			wantErr: `validate: profile "default" step "s" (DIR/b.yaml:4, from template "t" at DIR/a.yaml:3): with.pkg is required by the template`,
+		},
+		{
+			name:    "cycle",
+			files:   map[string]string{"a.yaml": "include: [b.yaml]\n", "b.yaml": "include: [sub/../a.yaml]\n"},
+			wantErr: "include cycle: DIR/a.yaml -> DIR/b.yaml -> DIR/a.yaml",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"a.yaml": "include: [missing.yaml]\n", "b.yaml": ""},
+			wantErr: `include "a.yaml": include "missing.yaml": open DIR/missing.yaml: no such file or directory`,
+		},
+		{
+			name:    "top-level only fields",
+			files:   map[string]string{"a.yaml": "policy:\n  allow_script_steps: true\n", "b.yaml": ""},
+			wantErr: `include "a.yaml": project, policy and retention may only be set in the top-level config`,
+		},
+		{
+			name:    "parse error",
+			files:   map[string]string{"a.yaml": "profiles:\n  default:\n    stepz: {}\n", "b.yaml": step},
+			wantErr: `include "a.yaml": parse config YAML: line 3: field stepz not found in type config.Profile`,
+		},
+	}
+	for _, tt := range tests {
+		tt.files[".foundry.yaml"] = root
+		dir := writeFiles(t, tt.files)
+		_, err := Load(filepath.Join(dir, ".foundry.yaml"))
+		if want := strings.ReplaceAll(tt.wantErr, "DIR", dir); err == nil || err.Error() != want {
+			t.Errorf("%s: expected error %q, got %v", tt.name, want, err)
+		}
+	}
+}
+
+// TestRender verifies that vars are scoped project, profile, step, that
+// env, git and matrix values are substituted, and that matrix steps expand
+// along with the deps on them.
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	data := `
+version: 2
+project:
+  name: demo
+vars:
+  image: app
+  flags: [-race, -count=1]
+  tag: "${{ vars.image }}:${{ git.short_sha }}"
+profiles:
+  default:
+    vars:
+      image: web
+    steps:
+      test:
+        type: shell
+        matrix:
+          os: [linux, darwin]
+          go: ["1.22", "1.23"]
+        env:
+          GOOS: ${{ matrix.os }}
+          TOOLCHAIN: go${{ matrix.go }}
+        command: [go, test, "${{ vars.flags }}", ./...]
+      build:
+        type: shell
+        deps: [test]
+        timeout: ${{ default(env.BUILD_TIMEOUT, '5m') }}
+        vars:
+          image: api
+        env:
+          FLAGS: ${{ join(vars.flags, ',') }}
+          HOME_DIR: ${{ env.HOME }}
+        command: [docker, build, -t, "${{ vars.tag }}", .]
+`
+	cfg, err := LoadFromBytes([]byte(data))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	steps, err := ResolveProfile(cfg, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitCalls := 0
+	ctx := RenderContext{
+		LookupEnv: func(k string) (string, bool) {
+			if k == "HOME" {
+				return "/home/ci", true
+			}
+			return "", false
+		},
+		Git: func() (vcs.Info, error) {
+			gitCalls++
+			return vcs.Info{SHA: "abcdef123456", ShortSHA: "abcdef1"}, nil
+		},
+	}
+	rendered, err := Render(cfg, "default", steps, ctx)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	var ids []string
+	for _, s := range rendered {
+		ids = append(ids, s.ID)
+	}
+	wantIDs := []string{"test-1.22-linux", "test-1.22-darwin", "test-1.23-linux", "test-1.23-darwin", "build"}
+	if !slices.Equal(ids, wantIDs) {
+		t.Fatalf("expected steps %v, got %v", wantIDs, ids)
+	}
+	first := rendered[0]
+	if first.Env["GOOS"] != "linux" || first.Env["TOOLCHAIN"] != "go1.22" {
+		t.Errorf("expected matrix env, got %v", first.Env)
+	}
+	if want := []string{"go", "test", "-race", "-count=1", "./..."}; !slices.Equal(first.Command, want) {
+		t.Errorf("expected command %v, got %v", want, first.Command)
+	}
+	if first.Matrix != nil || first.Vars != nil {
+		t.Errorf("expected matrix and vars to be cleared, got %v and %v", first.Matrix, first.Vars)
+	}
+
+	build := rendered[4]
+	if want := []string{"docker", "build", "-t", "api:abcdef1", "."}; !slices.Equal(build.Command, want) {
+		t.Errorf("expected command %v, got %v", want, build.Command)
+	}
+	if !slices.Equal(build.Deps, wantIDs[:4]) {
+		t.Errorf("expected deps %v, got %v", wantIDs[:4], build.Deps)
+	}
+	if build.Timeout != "5m" || build.Env["FLAGS"] != "-race,-count=1" || build.Env["HOME_DIR"] != "/home/ci" {
+		t.Errorf("expected rendered timeout and env, got %q and %v", build.Timeout, build.Env)
+	}
+	if gitCalls != 1 {
+		t.Errorf("expected git to be described once, got %d", gitCalls)
+	}
+
+	tests := []struct {
+		name    string
+		step    string
+		wantErr string
+	}{
+		{"unset env", "{type: shell, command: [echo, '${{ env.MISSING }}']}", `render: step "s" command: env.MISSING is not set`},
+		{"list in string", "{type: shell, command: ['x${{ vars.flags }}']}", `render: step "s" command: a list cannot be embedded in a string; use join`},
+		{"bad timeout", "{type: shell, command: [true], timeout: '${{ env.HOME }}'}", `render: step "s" timeout: time: invalid duration "/home/ci"`},
+		{"var cycle", "{type: shell, command: [echo, '${{ vars.a }}'], vars: {a: '${{ vars.b }}', b: '${{ vars.a }}'}}", `render: step "s" command: vars.a: vars.b: vars.a refers to itself`},
+	}
+	for _, tt := range tests {
+		cfg, err := LoadFromBytes([]byte("version: 2\nproject: {name: demo}\nvars: {flags: [a, b]}\nprofiles:\n  default:\n    steps:\n      s: " + tt.step + "\n"))
+		if err != nil {
+			t.Fatalf("%s: LoadFromBytes failed: %v", tt.name, err)
+		}
+		_, err = Render(cfg, "default", cfg.Profiles["default"].Steps, ctx)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// TestLoadFromBytes_Vars verifies that interpolations which can never
+// resolve are rejected when the config loads.
+func TestLoadFromBytes_Vars(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		step    string
+		wantErr string
+	}{
+		{"undefined var", "{type: shell, command: ['${{ vars.nope }}']}", `validate: profile "ci" step "s": command: vars.nope is not defined`},
+		{"child var", "{type: shell, command: ['${{ vars.child }}']}", `validate: profile "ci" step "s": command: vars.child is not defined`},
+		{"undefined matrix", "{type: shell, command: [true], env: {A: '${{ matrix.os }}'}}", `validate: profile "ci" step "s": env A: matrix.os is not defined`},
+		{"git field", "{type: shell, command: [true], timeout: '${{ git.author }}'}", `validate: profile "ci" step "s": timeout: git.author is not a git field (must be branch, dirty, sha, short_sha, tag)`},
+		{"unknown function", "{type: shell, command: ['${{ upper(vars.base) }}']}", `validate: profile "ci" step "s": command: unknown function upper (must be default or join)`},
+		{"arity", "{type: shell, command: ['${{ default(vars.base) }}']}", `validate: profile "ci" step "s": command: default takes 2 arguments, got 1`},
+		{"unterminated", "{type: shell, command: ['${{ vars.base']}", `validate: profile "ci" step "s": command: unterminated ${{`},
+		{"syntax", "{type: shell, command: ['${{ vars }}']}", `validate: profile "ci" step "s": command: ${{ vars }}: invalid reference "vars" (expected vars.NAME, env.NAME, git.FIELD or matrix.NAME)`},
+		{"empty matrix", "{type: shell, command: [true], matrix: {os: []}}", `validate: profile "ci" step "s": matrix.os has no values`},
+		{"matrix value", "{type: shell, command: [true], matrix: {os: [linux, 'mac os']}}", `validate: profile "ci" step "s": matrix.os: value "mac os" must contain only letters, digits, '.', '_' and '-'`},
+		{"matrix collision", "{type: shell, command: [true], matrix: {os: [base]}}\n      s-base: {type: shell, command: [true]}", `validate: profile "ci" step "s": matrix expansion "s-base" has the ID of another step`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			yaml := `
+version: 2
+project:
+  name: demo
+vars:
+  base: x
+profiles:
+  default:
+    vars:
+      parent: y
+  child:
+    extends: ci
+    vars:
+      child: z
+  ci:
+    extends: default
+    vars:
+      own: "${{ vars.parent }}"
+    steps:
+      s: ` + tt.step + `
+`
+			_, err := LoadFromBytes([]byte(yaml))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestLoadFromBytes_Templates verifies that steps are merged field by field
+// with the templates they use, and that errors name both.
+func TestLoadFromBytes_Templates(t *testing.T) {
+	t.Parallel()
+
+	base := `
+version: 2
+project:
+  name: demo
+templates:
+  go-test:
+    params:
+      pkg: ./...
+      retries: "0"
+      race:
+    type: shell
+    retries: ${{ params.retries }}
+    env:
+      CGO_ENABLED: "1"
+      GOFLAGS: -mod=readonly
+    tags: [test]
+    command: [go, test, "${{ params.race }}", "${{ params.pkg }}"]
+profiles:
+  default:
+    steps:
+      unit:
+        template: go-test
+        with: {race: -race}
+      integration:
+        template: go-test
+        with: {race: -race, pkg: ./integration/..., retries: "2"}
+        deps: [unit]
+        env:
+          GOFLAGS: -mod=mod
+          DB: postgres
+        tags: [slow]
+`
+	cfg, err := LoadFromBytes([]byte(base))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	steps := cfg.Profiles["default"].Steps
+	unit, integration := steps[0], steps[1]
+	if unit.ID != "unit" || unit.Type != "shell" || !slices.Equal(unit.Command, []string{"go", "test", "-race", "./..."}) || unit.Retries != 0 {
+		t.Errorf("expected unit to take the template's fields, got %+v", unit)
+	}
+	if !slices.Equal(integration.Command, []string{"go", "test", "-race", "./integration/..."}) || integration.Retries != 2 {
+		t.Errorf("expected integration to take its params, got %+v", integration)
+	}
+	wantEnv := map[string]string{"CGO_ENABLED": "1", "GOFLAGS": "-mod=mod", "DB": "postgres"}
+	if !reflect.DeepEqual(integration.Env, wantEnv) {
+		t.Errorf("expected env %v, got %v", wantEnv, integration.Env)
+	}
+	if !slices.Equal(integration.Tags, []string{"slow"}) || !slices.Equal(integration.Deps, []string{"unit"}) {
+		t.Errorf("expected integration's own tags and deps, got %v and %v", integration.Tags, integration.Deps)
+	}
+
+	tests := []struct {
+		name    string
+		step    string
+		wantErr string
+	}{
+		{"undefined template", "{template: go-tset}", `validate: profile "default" step "s" (line 14): template "go-tset" is not defined`},
+		{"missing param", "{template: go-test}", `validate: profile "default" step "s" (line 14, from template "go-test" at line 7): with.pkg is required by the template`},
+		{"unknown param", "{template: go-test, with: {pkg: ., race: x}}", `validate: profile "default" step "s" (line 14, from template "go-test" at line 7): with.race is not a param of the template`},
+		{"invalid result", "{template: go-test, with: {pkg: .}, type: approval}", `validate: profile "default" step "s" (line 14, from template "go-test" at line 7): approval steps cannot have a command`},
+		{"with without template", "{type: shell, command: [true], with: {pkg: .}}", `validate: profile "default" step "s": with is only valid with template`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			yaml := `
+version: 2
+project:
+  name: demo
+templates:
+  go-test:
+    params:
+      pkg:
+    type: shell
+    command: [go, test, "${{ params.pkg }}"]
+profiles:
+  default:
+    steps:
+      s: ` + tt.step + `
+`
+			_, err := LoadFromBytes([]byte(yaml))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cfg, err = LoadFromBytes([]byte(`
+version: 2
+project: {name: demo}
+templates:
+  t:
+    params: {msg: , dir: }
+    type: shell
+    env:
+      DIR: ${{ params.dir }}
+    command: [echo, "${{ params.msg }}"]
+profiles:
+  default:
+    steps:
+      s: {template: t, with: {msg: "null", dir: "~"}}
+`))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	if s := cfg.Profiles["default"].Steps[0]; !slices.Equal(s.Command, []string{"echo", "null"}) || s.Env["DIR"] != "~" {
+		t.Errorf("expected null and ~ params to stay strings, got %q and %q", s.Command, s.Env["DIR"])
+	}
+
+	_, err = LoadFromBytes([]byte("version: 2\nproject: {name: demo}\ntemplates:\n  t: {type: shell, command: ['${{ params.nope }}']}\nprofiles:\n  default:\n    steps:\n      s: {template: t}\n"))
+	if want := `validate: profile "default" step "s" (line 8, from template "t" at line 4): line 4: params.nope is not a param of the template`; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+// TestLinearize verifies the order profiles with several parents are merged
+// in, and that steps, vars and webhooks follow it.
+func TestLinearize(t *testing.T) {
+	t.Parallel()
+
+	data := `
+version: 2
+project:
+  name: demo
+vars:
+  flags: ""
+profiles:
+  base:
+    vars: {flags: -v}
+    steps:
+      lint: {type: shell, command: [lint]}
+      test: {type: shell, command: [go, test]}
+  race:
+    extends: base
+    vars: {flags: -race}
+    steps:
+      test: {type: shell, command: [go, test, -race]}
+  coverage:
+    extends: base
+    steps:
+      test: {type: shell, command: [go, test, -cover]}
+      report: {type: shell, command: [cover], deps: [test]}
+  ci:
+    extends: [race, coverage]
+    steps:
+      upload: {type: shell, command: [upload]}
+`
+	cfg, err := LoadFromBytes([]byte(data))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	order, err := Linearize(cfg, "ci")
+	if want := []string{"ci", "coverage", "race", "base"}; err != nil || !slices.Equal(order, want) {
+		t.Errorf("expected order %v, got %v (%v)", want, order, err)
+	}
+
+	steps, err := ResolveProfile(cfg, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range steps {
+		got = append(got, s.ID+"@"+s.Origin())
+	}
+	if want := []string{"lint@base", "test@coverage", "report@coverage", "upload@ci"}; !slices.Equal(got, want) {
+		t.Errorf("expected steps %v, got %v", want, got)
+	}
+	if v := ResolveVars(cfg, "ci")["flags"].Value; v != "-race" {
+		t.Errorf("expected vars.flags from race, got %q", v)
+	}
+
+	tests := []struct {
+		name     string
+		profiles string
+		wantErr  string
+	}{
+		{
+			name:     "inconsistent order",
+			profiles: "  a: {}\n  b: {extends: a}\n  c: {extends: [b, a]}\n",
+			wantErr:  `validate: profile "c" extends profiles in an inconsistent order: cannot order a and b`,
+		},
+		{
+			name:     "cycle",
+			profiles: "  a: {extends: [c]}\n  b: {extends: a}\n  c: {extends: [x, b]}\n  x: {}\n",
+			wantErr:  `validate: profile "a": circular extends chain detected (a -> c -> b -> a)`,
+		},
+		{
+			name:     "repeated parent",
+			profiles: "  a: {}\n  b: {extends: [a, a]}\n",
+			wantErr:  `validate: profile "b" extends "a" more than once`,
+		},
+	}
+	for _, tt := range tests {
+		_, err := LoadFromBytes([]byte("version: 2\nproject: {name: demo}\nprofiles:\n" + tt.profiles))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// TestResolveProfile_RemoveAndPatch verifies that child profiles can remove,
+// disable and patch the steps they inherit.
+func TestResolveProfile_RemoveAndPatch(t *testing.T) {
+	t.Parallel()
+
+	data := `
+version: 2
+project:
+  name: demo
+profiles:
+  default:
+    steps:
+      lint: {type: shell, command: [lint]}
+      vet: {type: shell, command: [vet]}
+      test:
+        type: shell
+        command: [go, test]
+        deps: [lint]
+        timeout: 5m
+        env: {GOFLAGS: -mod=mod, CGO_ENABLED: "1"}
+  ci:
+    extends: default
+    remove: [vet]
+    steps:
+      build: {type: shell, command: [go, build]}
+    patch:
+      lint: {disabled: true}
+      test:
+        env: {CI: "true"}
+        env_remove: [CGO_ENABLED]
+        deps: [build]
+        timeout: 15m
+`
+	cfg, err := LoadFromBytes([]byte(data))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	steps, err := ResolveProfile(cfg, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range steps {
+		ids = append(ids, s.ID)
+	}
+	if want := []string{"lint", "test", "build"}; !slices.Equal(ids, want) {
+		t.Fatalf("expected steps %v, got %v", want, ids)
+	}
+	if !steps[0].Disabled {
+		t.Errorf("expected lint to be disabled")
+	}
+	test := steps[1]
+	if want := map[string]string{"GOFLAGS": "-mod=mod", "CI": "true"}; !reflect.DeepEqual(test.Env, want) {
+		t.Errorf("expected env %v, got %v", want, test.Env)
+	}
+	if !slices.Equal(test.Deps, []string{"lint", "build"}) || test.Timeout != "15m" {
+		t.Errorf("expected patched deps and timeout, got %v and %q", test.Deps, test.Timeout)
+	}
+
+	parent, err := ResolveProfile(cfg, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent[0].Disabled || len(parent[2].Env) != 2 || len(parent[2].Deps) != 1 {
+		t.Errorf("expected the parent's steps to be unchanged, got %+v", parent)
+	}
+
+	tests := []struct {
+		name    string
+		child   string
+		wantErr string
+	}{
+		{"removed dependency", "remove: [lint]", `validate: profile "ci" removes step "lint", but step "test" (from profile "default") depends on it; remove that step too, or disable "lint" instead`},
+		{"remove unknown", "remove: [fmt]", `validate: profile "ci" removes step "fmt", which it does not inherit`},
+		{"patch unknown", "patch: {fmt: {disabled: true}}", `validate: profile "ci" patches step "fmt", which it does not inherit`},
+		{"patch dep", "patch: {test: {deps: [fmt]}}", `validate: profile "ci" patch "test": dependency "fmt" not found in profile or the profiles it extends (default)`},
+		{"patch var", "patch: {test: {timeout: '${{ vars.t }}'}}", `validate: profile "ci" patch "test": timeout: vars.t is not defined`},
+	}
+	for _, tt := range tests {
+		yaml := "version: 2\nproject: {name: demo}\nprofiles:\n  default:\n    steps:\n      lint: {type: shell, command: [lint]}\n      test: {type: shell, command: [test], deps: [lint]}\n  ci:\n    extends: default\n    " + tt.child + "\n"
+		_, err := LoadFromBytes([]byte(yaml))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// TestLoadFromBytes_InheritedDeps verifies that steps may depend on steps
+// their profile inherits, and that a missing dependency's error says where
+// it was looked for.
+func TestLoadFromBytes_InheritedDeps(t *testing.T) {
+	t.Parallel()
+
+	base := `
+version: 2
+project:
+  name: demo
+profiles:
+  default:
+    steps:
+      build: {type: shell, command: [make]}
+  release:
+    steps:
+      sign: {type: shell, command: [sign]}
+  ci:
+    extends: default
+    steps:
+`
+	cfg, err := LoadFromBytes([]byte(base + "      deploy: {type: shell, command: [deploy], deps: [build]}\n"))
+	if err != nil {
+		t.Fatalf("LoadFromBytes failed: %v", err)
+	}
+	steps, err := ResolveProfile(cfg, "ci")
+	if err != nil || len(steps) != 2 || !slices.Equal(steps[1].Deps, []string{"build"}) {
+		t.Errorf("expected deploy to depend on the inherited build, got %+v (%v)", steps, err)
+	}
+
+	tests := []struct {
+		name    string
+		dep     string
+		wantErr string
+	}{
+		{"missing", "test", `validate: profile "ci" step "deploy": dependency "test" not found in profile or the profiles it extends (default)`},
+		{"other profile", "sign", `validate: profile "ci" step "deploy": dependency "sign" not found in profile or the profiles it extends (default); it is defined in profile "release", which "ci" does not extend`},
+	}
+	for _, tt := range tests {
+		_, err := LoadFromBytes([]byte(base + "      deploy: {type: shell, command: [deploy], deps: [" + tt.dep + "]}\n"))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// TestCheck verifies that every problem in a config and the files it
+// includes is reported at its position, from both validation and the
+// schema.
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		".foundry.yaml": `version: 2
+project:
+  name: demo
+include: [ci.yaml]
+profiles:
+  default:
+    steps:
+      lint:
+        type: shel
+        command: [lint]
+      test:
+        type: shell
+        comand: [go, test]
+      build:
+        type: shell
+        command: [go, build]
+        deps: [lnt]
+  ci:
+    extends: nope
+`,
+		"ci.yaml": "profiles:\n  release:\n    steps:\n      sign: {type: shell, command: [sign], retries: -1}\n",
+	})
+	_, ds := Check(filepath.Join(dir, ".foundry.yaml"))
+
+	var got []string
+	for _, d := range ds {
+		got = append(got, strings.ReplaceAll(d.String(), dir+string(filepath.Separator), "")+" ["+d.Rule+"]")
+	}
+	want := []string{
+		`.foundry.yaml:9:9: error: profile "default" step "lint" has invalid type "shel" (must be shell, service, approval, plugin, or script) [config]`,
+		`.foundry.yaml:11:7: error: profile "default" step "test": shell steps must have non-empty command [config]`,
+		`.foundry.yaml:13:9: error: field comand not found in type config.Step [config]`,
+		`.foundry.yaml:17:16: error: profile "default" step "build": dependency "lnt" not found in profile [config]`,
+		`.foundry.yaml:19:5: error: profile "ci" extends non-existent profile "nope" [config]`,
+		`ci.yaml:4:53: error: /profiles/release/steps/sign/retries: -1 is less than the minimum of 0 [schema]`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected diagnostics\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// As an error, the diagnostics read as before, one per line.
+	_, err := Load(filepath.Join(dir, ".foundry.yaml"))
+	if err == nil || !strings.HasPrefix(err.Error(), "parse config YAML: line 13: field comand not found in type config.Step\nvalidate: profile \"ci\"") {
+		t.Errorf("expected the errors of every problem, got %v", err)
+	}
+
+	src := []byte("profiles:\n\tx:\n\t  type: shel\n")
+	snippet := Diagnostic{Line: 3, Column: 10}.Snippet(src)
+	if want := "\t  type: shel\n\t        ^\n"; snippet != want {
+		t.Errorf("expected snippet %q, got %q", want, snippet)
+	}
+	snippet = Diagnostic{Line: 1, Column: 15}.Snippet([]byte("name: \"café\", typ: x\n"))
+	if want := "name: \"café\", typ: x\n              ^\n"; snippet != want {
+		t.Errorf("expected the caret to count runes, got %q", snippet)
+	}
+
+	cfg, ds := Check(filepath.Join(dir, "missing.yaml"))
+	if cfg != nil || len(ds) != 1 || !ds.HasErrors() {
+		t.Errorf("expected an error for a missing file, got %v", ds)
+	}
+}
+
+// TestSchema verifies that schemas/foundry-config.schema.json is what
+// Schema generates, and that the schema requires of each step type what
+// Validate does.
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	got, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, schemas.Config) {
+		t.Error("schemas/foundry-config.schema.json is out of date; run make schema")
+	}
+
+	tests := []struct {
+		name  string
+		steps string
+		rules []string // of the errors, empty if the config is valid
+	}{
+		{"approval without command", "gate: {type: approval}", nil},
+		{"template", "lint: {template: go, with: {pkg: ./cmd}}", nil},
+		{"template setting type", "lint: {template: go, type: shell}", nil},
+		{"shell without command", "lint: {type: shell}", []string{RuleConfig}},
+		{"approval with command", "gate: {type: approval, command: [x]}", []string{RuleConfig}},
+		{"probe on shell", "db: {type: shell, command: [x], ready: {tcp: ':5432'}}", []string{RuleConfig}},
+		{"reports on service", "db: {type: service, command: [x], reports: {junit: '*.xml'}}", []string{RuleConfig}},
+		{"no type", "lint: {command: [x]}", []string{RuleConfig}},
+		{"negative retries", "lint: {type: shell, command: [x], retries: -1}", []string{RuleSchema}},
+	}
+	for _, tt := range tests {
+		dir := writeFiles(t, map[string]string{".foundry.yaml": `version: 2
+project: {name: demo}
+templates:
+  go:
+    params: {pkg: ./..., retries: '2'}
+    type: shell
+    command: [go, test, '${{ params.pkg }}']
+    retries: ${{ params.retries }}
+profiles:
+  default:
+    steps:
+      ` + tt.steps + "\n"})
+		_, ds := Check(filepath.Join(dir, ".foundry.yaml"))
+		var rules []string
+		for _, d := range ds {
+			rules = append(rules, d.Rule)
+		}
+		if !slices.Equal(rules, tt.rules) {
+			t.Errorf("%s: expected errors from %v, got %v", tt.name, tt.rules, ds)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/foundry-ci/foundry/internal/jsonschema"
+	"github.com/foundry-ci/foundry/schemas"
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of a Diagnostic.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Rules name the checks a Diagnostic comes from.
+const (
+	RuleConfig = "config" // decoding and validating the config
+	RuleSchema = "schema" // schemas/foundry-config.schema.json
+)
+
+// Diagnostic is a problem found in a config file, located by line and
+// column. Line and Column are 1-based, and 0 if unknown.
+type Diagnostic struct {
+	File     string `json:"file,omitempty"` // empty for a config not read from a file
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+
+	text string // the message as an error, with its context
+	path string // the part of the config it is about, if known
+}
+
+// Position returns file:line:col, leaving out what is unknown.
+func (d Diagnostic) Position() string {
+	parts := []string{d.File}
+	if d.File == "" {
+		parts[0] = "config"
+	}
+	if d.Line > 0 {
+		parts = append(parts, strconv.Itoa(d.Line))
+		if d.Column > 0 {
+			parts = append(parts, strconv.Itoa(d.Column))
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// Snippet returns the line of src the diagnostic is on, followed by a caret
+// under its column, or "" if its line is unknown.
+func (d Diagnostic) Snippet(src []byte) string {
+	lines := bytes.Split(src, []byte("\n"))
+	if d.Line < 1 || d.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(string(lines[d.Line-1]), "\r")
+	if d.Column < 1 {
+		return line + "\n"
+	}
+	// Columns count runes. Keep tabs in the indentation so the caret lines
+	// up.
+	var pad strings.Builder
+	runes := []rune(line)
+	for _, r := range runes[:min(d.Column-1, len(runes))] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	return line + "\n" + pad.String() + "^\n"
+}
+
+// Diagnostics is the list of problems found in a config. As an error, it
+// reads as its errors, one per line.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	var lines []string
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			lines = append(lines, d.text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HasErrors reports whether any of the diagnostics is an error.
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Sort orders the diagnostics by file and position. Diagnostics of the
+// same position keep their order.
+func (ds Diagnostics) Sort() {
+	slices.SortStableFunc(ds, func(a, b Diagnostic) int {
+		return cmp.Or(strings.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+}
+
+// Pos locates a node of a config file.
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// positions maps paths within the canonical config, such as
+// "/profiles/ci/steps/test/command", to where they are written. Steps are
+// identified by their IDs, and the items of other lists by their indices.
+type positions map[string]Pos
+
+// indexNodes records the position of every key and list item under n.
+func indexNodes(n *yaml.Node, path string, pos positions) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			p := path + "/" + key.Value
+			pos[p] = Pos{Line: key.Line, Column: key.Column}
+			indexNodes(value, p, pos)
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			p := path + "/" + strconv.Itoa(i)
+			at := Pos{Line: item.Line, Column: item.Column}
+			if strings.HasSuffix(path, "/steps") {
+				if id := mappingValue(item, "id"); id != nil {
+					p, at = path+"/"+id.Value, Pos{Line: id.Line, Column: id.Column}
+				}
+			}
+			pos[p] = at
+			indexNodes(item, p, pos)
+		}
+	}
+}
+
+// profilePath and stepPath return the paths of a profile and a step.
+func profilePath(name string) string {
+	return "/profiles/" + name
+}
+
+func stepPath(profile, id string) string {
+	return profilePath(profile) + "/steps/" + id
+}
+
+// lookup returns the position of path, or of its nearest ancestor with one.
+func (pos positions) lookup(path string) Pos {
+	for {
+		if p, ok := pos[path]; ok {
+			return p
+		}
+		i := strings.LastIndexByte(path, '/')
+		if i < 0 {
+			return Pos{}
+		}
+		path = path[:i]
+	}
+}
+
+// setFile records the file the positions are in.
+func (pos positions) setFile(file string) {
+	for k, p := range pos {
+		p.File = file
+		pos[k] = p
+	}
+}
+
+// merge adds the positions of o that pos lacks.
+func (pos positions) merge(o positions) {
+	for k, p := range o {
+		if _, ok := pos[k]; !ok {
+			pos[k] = p
+		}
+	}
+}
+
+// newDiagnostic returns an error diagnostic at p. context, such as
+// "validate", prefixes the message in the error text unless it is empty.
+func newDiagnostic(p Pos, context, msg string) Diagnostic {
+	return Diagnostic{
+		File:     p.File,
+		Line:     p.Line,
+		Column:   p.Column,
+		Severity: SeverityError,
+		Rule:     RuleConfig,
+		Message:  msg,
+		text:     strings.TrimPrefix(context+": "+msg, ": "),
+	}
+}
+
+// linePrefix matches the "line N: " that yaml.v3 and decoding errors start
+// with.
+var linePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// decodeDiagnostics turns an error decoding a file into diagnostics, taking
+// their lines from the messages.
+func decodeDiagnostics(err error, file string) Diagnostics {
+	var ds Diagnostics
+	if errors.As(err, &ds) {
+		return ds
+	}
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	for _, msg := range msgs {
+		d := newDiagnostic(Pos{File: file}, "parse config YAML", msg)
+		if m := linePrefix.FindStringSubmatch(msg); m != nil {
+			d.Line, _ = strconv.Atoi(m[1])
+			d.Message = msg[len(m[0]):]
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// wrapDiagnostics prefixes the error text of diagnostics found in an
+// included file with the include.
+func wrapDiagnostics(ds Diagnostics, context string) Diagnostics {
+	out := make(Diagnostics, len(ds))
+	for i, d := range ds {
+		d.text = context + ": " + d.text
+		out[i] = d
+	}
+	return out
+}
+
+// warning returns a warning diagnostic at p.
+func warning(p Pos, msg string) Diagnostic {
+	return Diagnostic{File: p.File, Line: p.Line, Column: p.Column, Severity: SeverityWarning, Rule: RuleConfig, Message: msg, text: msg}
+}
+
+// String formats a diagnostic as file:line:col: severity: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Position(), d.Severity, d.Message)
+}
+
+// Check loads the config at path as Load does, and also validates each of
+// its files against schemas/foundry-config.schema.json. It returns every
+// problem found, warnings included, in order of position; the config is
+// nil if any of them is an error. Schema errors on a line that already has
+// a config error, or about the part of the config one is about, are left
+// out, as the config error says more.
+func Check(path string) (*Config, Diagnostics) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, Diagnostics{newDiagnostic(Pos{File: path}, "load config", err.Error())}
+	}
+	l := newLoader()
+	cfg, err := l.load(path, data)
+	var ds Diagnostics
+	if err != nil {
+		ds = decodeDiagnostics(err, path)
+	} else {
+		ds = slices.Clone(cfg.warnings)
+	}
+	for i, src := range l.sources {
+		for _, d := range schemaDiagnostics(src, i > 0) {
+			if !slices.ContainsFunc(ds, func(o Diagnostic) bool {
+				return o.Severity == SeverityError && o.File == d.File &&
+					(o.Line == d.Line || o.path != "" && (d.path == o.path || strings.HasPrefix(d.path, o.path+"/")))
+			}) {
+				ds = append(ds, d)
+			}
+		}
+	}
+	ds.Sort()
+	if ds.HasErrors() {
+		return nil, ds
+	}
+	return cfg, ds
+}
+
+// configSchema is the parsed schemas/foundry-config.schema.json.
+var configSchema = sync.OnceValues(func() (*jsonschema.Schema, error) {
+	return jsonschema.Parse(schemas.Config)
+})
+
+// schemaDiagnostics validates a config file against the schema. The
+// properties required at the top level are not required of an included
+// file. A file that is not valid YAML has no schema diagnostics, as
+// decoding it reports why.
+func schemaDiagnostics(src Source, included bool) Diagnostics {
+	schema, err := configSchema()
+	if err != nil {
+		return Diagnostics{newDiagnostic(Pos{File: src.Path}, "schema", err.Error())}
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal(src.Data, &doc) != nil {
+		return nil
+	}
+	validate := schema.Validate
+	if included {
+		validate = schema.ValidateFragment
+	}
+	var ds Diagnostics
+	for _, e := range validate(&doc) {
+		d := newDiagnostic(Pos{File: src.Path, Line: e.Line, Column: e.Column}, "schema", cmp.Or(e.Path, "/")+": "+e.Message)
+		d.Rule, d.path = RuleSchema, e.Path
+		ds = append(ds, d)
+	}
+	return ds
+}
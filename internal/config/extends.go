@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Parents lists the profiles a profile extends. It is written as one name or
+// a list of names.
+type Parents []string
+
+// UnmarshalYAML reads a name or a list of names.
+func (p *Parents) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*p = nil
+		if n.Value != "" && n.Tag != "!!null" {
+			*p = Parents{n.Value}
+		}
+		return nil
+	}
+	return n.Decode((*[]string)(p))
+}
+
+// MarshalYAML writes a single name as a string.
+func (p Parents) MarshalYAML() (any, error) {
+	if len(p) == 1 {
+		return p[0], nil
+	}
+	return []string(p), nil
+}
+
+// String returns the names separated by commas.
+func (p Parents) String() string {
+	return strings.Join(p, ", ")
+}
+
+// Linearize returns a profile followed by the profiles it extends, directly
+// or not, most specific first: the order in which their steps, vars and
+// webhooks take precedence. A profile comes before the profiles it extends,
+// and a profile's later parents before its earlier ones, so that
+// "extends: [base, race]" lets race override base. Each profile appears
+// once, after all the profiles that extend it, as in C3 linearisation with
+// the parents read right to left. It is an error if the extends lists order
+// two profiles both ways.
+func Linearize(cfg *Config, name string) ([]string, error) {
+	return linearize(cfg, name, nil, map[string][]string{})
+}
+
+func linearize(cfg *Config, name string, path []string, memo map[string][]string) ([]string, error) {
+	if l, ok := memo[name]; ok {
+		return l, nil
+	}
+	if slices.Contains(path, name) {
+		return nil, fmt.Errorf("circular extends chain detected (%s -> %s)", strings.Join(path, " -> "), name)
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("extended profile %q not found", name)
+	}
+	path = append(path, name)
+
+	parents := slices.Clone(profile.Extends)
+	slices.Reverse(parents)
+	var seqs [][]string
+	for _, parent := range parents {
+		l, err := linearize(cfg, parent, path, memo)
+		if err != nil {
+			return nil, err
+		}
+		seqs = append(seqs, slices.Clone(l))
+	}
+	seqs = append(seqs, parents)
+
+	order := []string{name}
+	for {
+		seqs = slices.DeleteFunc(seqs, func(s []string) bool { return len(s) == 0 })
+		if len(seqs) == 0 {
+			break
+		}
+		var next string
+		for _, s := range seqs {
+			if !slices.ContainsFunc(seqs, func(o []string) bool { return slices.Contains(o[1:], s[0]) }) {
+				next = s[0]
+				break
+			}
+		}
+		if next == "" {
+			var heads []string
+			for _, s := range seqs {
+				if !slices.Contains(heads, s[0]) {
+					heads = append(heads, s[0])
+				}
+			}
+			return nil, fmt.Errorf("profile %q extends profiles in an inconsistent order: cannot order %s", name, strings.Join(heads, " and "))
+		}
+		order = append(order, next)
+		for i, s := range seqs {
+			if s[0] == next {
+				seqs[i] = s[1:]
+			}
+		}
+	}
+	memo[name] = order
+	return order, nil
+}
@@ -0,0 +1,425 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/foundry-ci/foundry/internal/policy"
+)
+
+// Source is a file a config was loaded from.
+type Source struct {
+	Path string // as given, or relative to the including file
+	Data []byte
+}
+
+// Content returns the bytes the config was loaded from: the top-level
+// file's, followed by those of each included file, named relative to the
+// top-level file's directory. It is what the plan's config hash covers, so
+// that editing an included file changes it, while how the top-level file
+// was named does not.
+func (c *Config) Content() []byte {
+	if len(c.Sources) == 0 {
+		return nil
+	}
+	top, _ := filepath.Abs(filepath.Dir(c.Sources[0].Path))
+	var buf bytes.Buffer
+	buf.Write(c.Sources[0].Data)
+	for _, s := range c.Sources[1:] {
+		name := filepath.Clean(s.Path)
+		if abs, err := filepath.Abs(s.Path); err == nil {
+			if rel, err := filepath.Rel(top, abs); err == nil {
+				name = rel
+			}
+		}
+		fmt.Fprintf(&buf, "\n# include: %s\n", filepath.ToSlash(name))
+		buf.Write(s.Data)
+	}
+	return buf.Bytes()
+}
+
+// loader reads a config file and the files it includes.
+type loader struct {
+	stack    []Source        // files being loaded, outermost first
+	seen     map[string]bool // absolute paths of the files already loaded
+	sources  []Source
+	warnings Diagnostics
+}
+
+// fragment is the config of a file merged with the files it includes,
+// recording which file defined each step, extends, var, template and patch,
+// for conflict errors.
+type fragment struct {
+	cfg    *Config
+	origin map[string]string
+}
+
+// load reads a config document and the files it includes, and validates
+// the merged result. path locates the document, or is empty for one read
+// from elsewhere, whose includes are resolved against the working
+// directory.
+func load(path string, data []byte) (*Config, error) {
+	return newLoader().load(path, data)
+}
+
+func newLoader() *loader {
+	return &loader{seen: map[string]bool{}}
+}
+
+// load loads a config as the package-level load does, keeping the files it
+// reads in l.sources even if the config is invalid.
+func (l *loader) load(path string, data []byte) (*Config, error) {
+	f, err := l.file(path, data, 0)
+	var cycle *cycleError
+	if errors.As(err, &cycle) {
+		return nil, Diagnostics{newDiagnostic(cycle.at, "", cycle.Error())}
+	}
+	if f == nil {
+		return nil, err
+	}
+	var ds Diagnostics
+	errors.As(err, &ds)
+	cfg := f.cfg
+	cfg.Sources, cfg.Warnings, cfg.warnings = l.sources, nil, l.warnings
+	for _, w := range l.warnings {
+		cfg.Warnings = append(cfg.Warnings, w.text)
+	}
+
+	if err := expandTemplates(cfg); err != nil {
+		return nil, append(ds, decodeDiagnostics(err, "")...)
+	}
+	if err := Validate(cfg); err != nil {
+		ds = append(ds, decodeDiagnostics(err, "")...)
+	}
+	if len(ds) > 0 {
+		return nil, ds
+	}
+	return cfg, nil
+}
+
+// file decodes one file, defaulting to version if it declares none, and
+// merges in the files it includes. It returns nil for a file already
+// merged through another include. Unknown fields do not stop it: it
+// returns the merged config along with their errors.
+func (l *loader) file(path string, data []byte, version int) (*fragment, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if l.seen[key] {
+		for i, s := range l.stack {
+			if abs, _ := filepath.Abs(s.Path); abs == key {
+				var cycle []string
+				for _, s := range l.stack[i:] {
+					cycle = append(cycle, s.Path)
+				}
+				return nil, &cycleError{files: append(cycle, path)}
+			}
+		}
+		return nil, nil
+	}
+	l.seen[key] = true
+	l.stack = append(l.stack, Source{Path: path, Data: data})
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+	l.sources = append(l.sources, Source{Path: path, Data: data})
+
+	cfg, err := decode(data, version)
+	var unknown Diagnostics
+	if err != nil {
+		unknown = decodeDiagnostics(err, "")
+		for i := range unknown {
+			unknown[i].File = path
+		}
+		if cfg == nil {
+			return nil, unknown
+		}
+	}
+	cfg.pos.setFile(path)
+	included := len(l.stack) > 1
+	for _, w := range cfg.warnings {
+		// Each version 1 file warns alike; one warning is enough.
+		if slices.ContainsFunc(l.warnings, func(d Diagnostic) bool { return d.Message == w.Message }) {
+			continue
+		}
+		w.File = path
+		if included {
+			w.text = path + ": " + w.text
+		}
+		l.warnings = append(l.warnings, w)
+	}
+	for name, t := range cfg.Templates {
+		t.file = path
+		cfg.Templates[name] = t
+	}
+	for _, p := range cfg.Profiles {
+		for _, s := range p.Steps {
+			if s.use != nil {
+				s.use.file = path
+			}
+		}
+	}
+	if included && (cfg.Project != (Project{}) || cfg.Policy != (policy.Policy{}) || cfg.Retention != (Retention{})) {
+		at := cfg.pos.lookup("/project")
+		for _, key := range []string{"/retention", "/policy"} {
+			if p, ok := cfg.pos[key]; ok && (at.Line == 0 || p.Line < at.Line) {
+				at = p
+			}
+		}
+		return nil, append(unknown, newDiagnostic(at, "", "project, policy and retention may only be set in the top-level config"))
+	}
+
+	own := newFragment(cfg, path)
+	merged := &fragment{cfg: &Config{pos: positions{}}, origin: map[string]string{}}
+	for i, inc := range cfg.Include {
+		at := cfg.pos.lookup("/include/" + strconv.Itoa(i))
+		incPath := inc
+		if !filepath.IsAbs(incPath) {
+			incPath = filepath.Join(filepath.Dir(path), inc)
+		}
+		incData, err := os.ReadFile(incPath)
+		if err != nil {
+			return nil, append(unknown, newDiagnostic(at, "", fmt.Sprintf("include %q: %v", inc, err)))
+		}
+		sub, err := l.file(incPath, incData, cfg.Version)
+		var cycle *cycleError
+		if errors.As(err, &cycle) {
+			if cycle.at.Line == 0 {
+				cycle.at = at
+			}
+			return nil, err
+		}
+		if err != nil {
+			ds := wrapDiagnostics(decodeDiagnostics(err, path), fmt.Sprintf("include %q", inc))
+			if sub == nil {
+				return nil, append(unknown, ds...)
+			}
+			unknown = append(unknown, ds...)
+		}
+		if sub != nil {
+			if err := merged.add(sub); err != nil {
+				return nil, append(unknown, decodeDiagnostics(err, path)...)
+			}
+		}
+	}
+	merged.override(own)
+	if len(unknown) > 0 {
+		return merged, unknown
+	}
+	return merged, nil
+}
+
+// cycleError reports files that include themselves, through the files
+// between. at is the include that closes the cycle.
+type cycleError struct {
+	files []string
+	at    Pos
+}
+
+func (e *cycleError) Error() string {
+	return "include cycle: " + strings.Join(e.files, " -> ")
+}
+
+func newFragment(cfg *Config, path string) *fragment {
+	f := &fragment{cfg: cfg, origin: map[string]string{}}
+	if path == "" {
+		path = "the config"
+	}
+	for name := range cfg.Vars {
+		f.origin[varKey("", name)] = path
+	}
+	for name := range cfg.Templates {
+		f.origin[templateKey(name)] = path
+	}
+	for name, p := range cfg.Profiles {
+		if len(p.Extends) > 0 {
+			f.origin[originKey(name, "")] = path
+		}
+		for _, s := range p.Steps {
+			f.origin[originKey(name, s.ID)] = path
+		}
+		for v := range p.Vars {
+			f.origin[varKey(name, v)] = path
+		}
+		for id := range p.Patch {
+			f.origin[patchKey(name, id)] = path
+		}
+	}
+	return f
+}
+
+// originKey identifies a profile's extends (with an empty step) or step.
+func originKey(profile, step string) string {
+	return profile + "\x00" + step
+}
+
+// varKey identifies a var of a profile, or of the project for an empty
+// profile.
+func varKey(profile, name string) string {
+	return profile + "\x01" + name
+}
+
+// patchKey identifies a profile's patch of a step.
+func patchKey(profile, step string) string {
+	return profile + "\x03" + step
+}
+
+// templateKey identifies a template.
+func templateKey(name string) string {
+	return "\x02" + name
+}
+
+// addVars merges vars defined alongside others into dst, rejecting any
+// defined twice.
+func (f *fragment) addVars(dst, src map[string]Var, o *fragment, profile string) (map[string]Var, error) {
+	for _, name := range sortedKeys(src) {
+		k := varKey(profile, name)
+		if first, ok := f.origin[k]; ok {
+			if profile == "" {
+				return nil, o.errorf("/vars/"+name, "vars.%s is defined in both %s and %s", name, first, o.origin[k])
+			}
+			return nil, o.errorf(profilePath(profile)+"/vars/"+name, "profile %q vars.%s is defined in both %s and %s", profile, name, first, o.origin[k])
+		}
+		if dst == nil {
+			dst = map[string]Var{}
+		}
+		dst[name] = src[name]
+	}
+	return dst, nil
+}
+
+// add merges a file included alongside others. Defining the same step, or
+// different extends, of a profile in two such files is an error.
+func (f *fragment) add(o *fragment) error {
+	f.cfg.Notify = append(f.cfg.Notify, o.cfg.Notify...)
+	vars, err := f.addVars(f.cfg.Vars, o.cfg.Vars, o, "")
+	if err != nil {
+		return err
+	}
+	f.cfg.Vars = vars
+	for _, name := range sortedKeys(o.cfg.Templates) {
+		k := templateKey(name)
+		if first, ok := f.origin[k]; ok {
+			return o.errorf("/templates/"+name, "template %q is defined in both %s and %s", name, first, o.origin[k])
+		}
+		if f.cfg.Templates == nil {
+			f.cfg.Templates = map[string]Template{}
+		}
+		f.cfg.Templates[name] = o.cfg.Templates[name]
+	}
+	for _, name := range sortedKeys(o.cfg.Profiles) {
+		src := o.cfg.Profiles[name]
+		dst := f.cfg.Profiles[name]
+		if dst.Vars, err = f.addVars(dst.Vars, src.Vars, o, name); err != nil {
+			return err
+		}
+		if len(src.Extends) > 0 {
+			if len(dst.Extends) > 0 && !slices.Equal(dst.Extends, src.Extends) {
+				k := originKey(name, "")
+				return o.errorf(profilePath(name)+"/extends", "profile %q extends %q in %s but %q in %s", name, dst.Extends.String(), f.origin[k], src.Extends.String(), o.origin[k])
+			}
+			dst.Extends = src.Extends
+		}
+		for _, s := range src.Steps {
+			k := originKey(name, s.ID)
+			if first, ok := f.origin[k]; ok {
+				return o.errorf(stepPath(name, s.ID), "profile %q step %q is defined in both %s and %s", name, s.ID, first, o.origin[k])
+			}
+			dst.Steps = append(dst.Steps, s)
+		}
+		for _, id := range sortedKeys(src.Patch) {
+			k := patchKey(name, id)
+			if first, ok := f.origin[k]; ok {
+				return o.errorf(profilePath(name)+"/patch/"+id, "profile %q patch %q is defined in both %s and %s", name, id, first, o.origin[k])
+			}
+			if dst.Patch == nil {
+				dst.Patch = map[string]Patch{}
+			}
+			dst.Patch[id] = src.Patch[id]
+		}
+		dst.Remove = append(dst.Remove, src.Remove...)
+		dst.Notify = append(dst.Notify, src.Notify...)
+		f.setProfile(name, dst)
+	}
+	for k, v := range o.origin {
+		if _, ok := f.origin[k]; !ok {
+			f.origin[k] = v
+		}
+	}
+	f.cfg.pos.merge(o.cfg.pos)
+	return nil
+}
+
+// errorf reports a conflict at path in the fragment's files.
+func (f *fragment) errorf(path, format string, args ...any) error {
+	return Diagnostics{newDiagnostic(f.cfg.pos.lookup(path), "", fmt.Sprintf(format, args...))}
+}
+
+// override merges the including file's own config over what it includes:
+// its steps replace included steps with the same ID, and its extends, vars,
+// templates and patches replace theirs.
+func (f *fragment) override(own *fragment) {
+	included := f.cfg
+	f.cfg = own.cfg
+	f.cfg.Notify = append(included.Notify, own.cfg.Notify...)
+	if len(included.Vars) > 0 {
+		f.cfg.Vars = mergeMaps(included.Vars, own.cfg.Vars)
+	}
+	if len(included.Templates) > 0 {
+		f.cfg.Templates = mergeMaps(included.Templates, own.cfg.Templates)
+	}
+	for _, name := range sortedKeys(own.cfg.Profiles) {
+		src := own.cfg.Profiles[name]
+		dst, ok := included.Profiles[name]
+		if !ok {
+			continue
+		}
+		if len(src.Extends) > 0 {
+			dst.Extends = src.Extends
+		}
+		if len(src.Vars) > 0 {
+			dst.Vars = mergeMaps(dst.Vars, src.Vars)
+		}
+		for _, s := range src.Steps {
+			if i := slices.IndexFunc(dst.Steps, func(d Step) bool { return d.ID == s.ID }); i >= 0 {
+				dst.Steps[i] = s
+			} else {
+				dst.Steps = append(dst.Steps, s)
+			}
+		}
+		if len(src.Patch) > 0 {
+			dst.Patch = mergeMaps(dst.Patch, src.Patch)
+		}
+		dst.Remove = append(dst.Remove, src.Remove...)
+		dst.Notify = append(dst.Notify, src.Notify...)
+		included.Profiles[name] = dst
+	}
+	for name, p := range included.Profiles {
+		f.setProfile(name, p)
+	}
+	for k, v := range own.origin {
+		f.origin[k] = v
+	}
+	f.cfg.pos.merge(included.pos)
+}
+
+func (f *fragment) setProfile(name string, p Profile) {
+	if f.cfg.Profiles == nil {
+		f.cfg.Profiles = map[string]Profile{}
+	}
+	f.cfg.Profiles[name] = p
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,632 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/vcs"
+	"gopkg.in/yaml.v3"
+)
+
+// Interpolations are written ${{ expression }} in a step's command, env
+// and timeout, and in vars. An expression is a reference (vars.NAME,
+// env.NAME, git.FIELD or matrix.NAME), a quoted string, or a call of a
+// function with expressions as arguments.
+const (
+	interpOpen  = "${{"
+	interpClose = "}}"
+)
+
+// Var is a value under vars: a string, or a list of strings to join or to
+// spread over command arguments.
+type Var struct {
+	Value  string
+	List   []string
+	IsList bool
+}
+
+// UnmarshalYAML reads a string or a list of strings.
+func (v *Var) UnmarshalYAML(n *yaml.Node) error {
+	switch {
+	case n.Kind == yaml.ScalarNode && n.Tag == "!!null":
+		*v = Var{}
+	case n.Kind == yaml.ScalarNode:
+		*v = Var{Value: n.Value}
+	case n.Kind == yaml.SequenceNode:
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		*v = Var{List: list, IsList: true}
+	default:
+		return fmt.Errorf("line %d: vars must be strings or lists of strings", n.Line)
+	}
+	return nil
+}
+
+// MarshalYAML writes the string or list.
+func (v Var) MarshalYAML() (any, error) {
+	if v.IsList {
+		return v.List, nil
+	}
+	return v.Value, nil
+}
+
+// gitFields are the git.FIELD references, describing the working tree's
+// HEAD.
+var gitFields = map[string]func(vcs.Info) string{
+	"sha":       func(i vcs.Info) string { return i.SHA },
+	"short_sha": func(i vcs.Info) string { return i.ShortSHA },
+	"branch":    func(i vcs.Info) string { return i.Branch },
+	"tag":       func(i vcs.Info) string { return i.Tag },
+	"dirty":     func(i vcs.Info) string { return fmt.Sprint(i.Dirty) },
+}
+
+// functions are the functions expressions may call, with their minimum and
+// maximum number of arguments.
+var functions = map[string][2]int{
+	"default": {2, 2}, // default(a, b): a, or b if a is unset or empty
+	"join":    {1, 2}, // join(list, sep): the list joined with sep (default " ")
+}
+
+// Expressions.
+type (
+	expr     interface{}
+	refExpr  struct{ ns, name string }
+	litExpr  string
+	callExpr struct {
+		fn   string
+		args []expr
+	}
+)
+
+// part is a literal piece of a template, or an interpolation.
+type part struct {
+	lit  string
+	expr expr
+}
+
+// parseTemplate splits s into literal text and interpolations.
+func parseTemplate(s string) ([]part, error) {
+	var parts []part
+	for {
+		i := strings.Index(s, interpOpen)
+		if i < 0 {
+			if s != "" {
+				parts = append(parts, part{lit: s})
+			}
+			return parts, nil
+		}
+		if i > 0 {
+			parts = append(parts, part{lit: s[:i]})
+		}
+		s = s[i+len(interpOpen):]
+		j := strings.Index(s, interpClose)
+		if j < 0 {
+			return nil, fmt.Errorf("unterminated %s", interpOpen)
+		}
+		e, err := parseExpr(s[:j])
+		if err != nil {
+			return nil, fmt.Errorf("%s%s%s: %w", interpOpen, s[:j], interpClose, err)
+		}
+		parts = append(parts, part{expr: e})
+		s = s[j+len(interpClose):]
+	}
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func parseExpr(s string) (expr, error) {
+	p := &exprParser{s: s}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *exprParser) space() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) expr() (expr, error) {
+	p.space()
+	if p.pos >= len(p.s) {
+		return nil, errors.New("expected an expression")
+	}
+	c := p.s[p.pos]
+	if c == '\'' || c == '"' {
+		end := strings.IndexByte(p.s[p.pos+1:], c)
+		if end < 0 {
+			return nil, errors.New("unterminated string")
+		}
+		lit := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return litExpr(lit), nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && isNameByte(p.s[p.pos]) {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	p.space()
+	if p.pos < len(p.s) && p.s[p.pos] == '(' {
+		p.pos++
+		call := callExpr{fn: name}
+		p.space()
+		if p.pos < len(p.s) && p.s[p.pos] == ')' {
+			p.pos++
+			return call, nil
+		}
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			p.space()
+			if p.pos >= len(p.s) {
+				return nil, fmt.Errorf("missing ) after arguments of %s", name)
+			}
+			switch p.s[p.pos] {
+			case ',':
+				p.pos++
+			case ')':
+				p.pos++
+				return call, nil
+			default:
+				return nil, fmt.Errorf("unexpected %q in arguments of %s", p.s[p.pos:], name)
+			}
+		}
+	}
+	ns, field, ok := strings.Cut(name, ".")
+	if !ok || field == "" {
+		return nil, fmt.Errorf("invalid reference %q (expected vars.NAME, env.NAME, git.FIELD or matrix.NAME)", name)
+	}
+	return refExpr{ns: ns, name: field}, nil
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// scope lists the names an interpolation may reference.
+type scope struct {
+	vars   map[string]Var
+	matrix map[string][]string
+}
+
+// checkTemplate reports syntax errors and references that can never
+// resolve in s: undefined vars and matrix values, unknown git fields and
+// functions.
+func checkTemplate(s string, sc scope) error {
+	parts, err := parseTemplate(s)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if p.expr != nil {
+			if err := checkExpr(p.expr, sc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkExpr(e expr, sc scope) error {
+	switch e := e.(type) {
+	case refExpr:
+		switch e.ns {
+		case "vars":
+			if _, ok := sc.vars[e.name]; !ok {
+				return fmt.Errorf("vars.%s is not defined", e.name)
+			}
+		case "matrix":
+			if _, ok := sc.matrix[e.name]; !ok {
+				return fmt.Errorf("matrix.%s is not defined", e.name)
+			}
+		case "git":
+			if _, ok := gitFields[e.name]; !ok {
+				return fmt.Errorf("git.%s is not a git field (must be %s)", e.name, strings.Join(sortedKeys(gitFields), ", "))
+			}
+		case "env":
+		default:
+			return fmt.Errorf("unknown reference %s.%s (expected vars, env, git or matrix)", e.ns, e.name)
+		}
+	case callExpr:
+		arity, ok := functions[e.fn]
+		if !ok {
+			return fmt.Errorf("unknown function %s (must be %s)", e.fn, strings.Join(sortedKeys(functions), " or "))
+		}
+		if n := len(e.args); n < arity[0] || n > arity[1] {
+			return fmt.Errorf("%s takes %s arguments, got %d", e.fn, arityText(arity), n)
+		}
+		for _, arg := range e.args {
+			if err := checkExpr(arg, sc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func arityText(arity [2]int) string {
+	if arity[0] == arity[1] {
+		return fmt.Sprint(arity[0])
+	}
+	return fmt.Sprintf("%d to %d", arity[0], arity[1])
+}
+
+// checkVars checks the interpolations in vars.
+func checkVars(vars map[string]Var, sc scope) error {
+	for _, name := range sortedKeys(vars) {
+		v := vars[name]
+		for _, s := range append([]string{v.Value}, v.List...) {
+			if err := checkTemplate(s, sc); err != nil {
+				return fmt.Errorf("vars.%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkStep checks the matrix of a step and the interpolations in its
+// vars, command, env and timeout.
+func checkStep(step Step, vars map[string]Var) error {
+	for _, name := range sortedKeys(step.Matrix) {
+		values := step.Matrix[name]
+		if len(values) == 0 {
+			return fmt.Errorf("matrix.%s has no values", name)
+		}
+		for _, v := range values {
+			if !matrixValue.MatchString(v) {
+				return fmt.Errorf("matrix.%s: value %q must contain only letters, digits, '.', '_' and '-'", name, v)
+			}
+		}
+	}
+
+	sc := scope{vars: mergeMaps(vars, step.Vars), matrix: step.Matrix}
+	if err := checkVars(step.Vars, sc); err != nil {
+		return err
+	}
+	for _, arg := range step.Command {
+		if err := checkTemplate(arg, sc); err != nil {
+			return fmt.Errorf("command: %w", err)
+		}
+	}
+	for _, k := range sortedKeys(step.Env) {
+		if err := checkTemplate(step.Env[k], sc); err != nil {
+			return fmt.Errorf("env %s: %w", k, err)
+		}
+	}
+	if err := checkTemplate(step.Timeout, sc); err != nil {
+		return fmt.Errorf("timeout: %w", err)
+	}
+	return nil
+}
+
+var matrixValue = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// mergeMaps returns the entries of a overridden by those of b.
+func mergeMaps[V any](a, b map[string]V) map[string]V {
+	merged := make(map[string]V, len(a)+len(b))
+	maps.Copy(merged, a)
+	maps.Copy(merged, b)
+	return merged
+}
+
+// ResolveVars returns the vars in scope in a profile: the project's, then
+// those of each profile it extends, in the reverse of the order given by
+// Linearize, then its own, later ones overriding earlier ones.
+func ResolveVars(cfg *Config, name string) map[string]Var {
+	order, _ := Linearize(cfg, name) // validated configs always linearise
+	vars := mergeMaps(nil, cfg.Vars)
+	for _, profileName := range slices.Backward(order) {
+		vars = mergeMaps(vars, cfg.Profiles[profileName].Vars)
+	}
+	return vars
+}
+
+// RenderContext supplies the values of env and git references.
+type RenderContext struct {
+	LookupEnv func(string) (string, bool)
+	Git       func() (vcs.Info, error) // called at most once, if git is referenced
+}
+
+// Render prepares the resolved steps of a profile for planning: it expands
+// each step with a matrix into one step per combination of values, and
+// replaces the interpolations in every step's command, env and timeout.
+// Dependencies on a matrix step become dependencies on all of its
+// expansions.
+func Render(cfg *Config, profile string, steps []Step, ctx RenderContext) ([]Step, error) {
+	base := ResolveVars(cfg, profile)
+	git := ctx.Git
+	if git != nil {
+		var once struct {
+			done bool
+			info vcs.Info
+			err  error
+		}
+		git = func() (vcs.Info, error) {
+			if !once.done {
+				once.info, once.err = ctx.Git()
+				once.done = true
+			}
+			return once.info, once.err
+		}
+	}
+
+	var out []Step
+	expansions := map[string][]string{}
+	for _, step := range steps {
+		for _, values := range matrixCombinations(step.Matrix) {
+			s := step
+			if len(step.Matrix) > 0 {
+				s.ID = matrixID(step.ID, step.Matrix, values)
+				expansions[step.ID] = append(expansions[step.ID], s.ID)
+			}
+			r := &renderer{vars: mergeMaps(base, step.Vars), matrix: values, lookupEnv: ctx.LookupEnv, git: git}
+			var err error
+			if s.Command, err = r.args(step.Command); err != nil {
+				return nil, fmt.Errorf("render: step %q command: %w", s.ID, err)
+			}
+			if step.Env != nil {
+				s.Env = make(map[string]string, len(step.Env))
+				for _, k := range sortedKeys(step.Env) {
+					if s.Env[k], err = r.render(step.Env[k]); err != nil {
+						return nil, fmt.Errorf("render: step %q env %s: %w", s.ID, k, err)
+					}
+				}
+			}
+			if s.Timeout, err = r.render(step.Timeout); err != nil {
+				return nil, fmt.Errorf("render: step %q timeout: %w", s.ID, err)
+			}
+			if s.Timeout != "" {
+				if _, err := time.ParseDuration(s.Timeout); err != nil {
+					return nil, fmt.Errorf("render: step %q timeout: %w", s.ID, err)
+				}
+			}
+			s.Vars, s.Matrix = nil, nil
+			out = append(out, s)
+		}
+	}
+
+	for i, s := range out {
+		var deps []string
+		for _, dep := range s.Deps {
+			if ids, ok := expansions[dep]; ok {
+				deps = append(deps, ids...)
+			} else {
+				deps = append(deps, dep)
+			}
+		}
+		out[i].Deps = deps
+	}
+	return out, nil
+}
+
+// matrixCombinations returns every combination of a matrix's values, or a
+// single empty one for a step without a matrix.
+func matrixCombinations(matrix map[string][]string) []map[string]string {
+	combos := []map[string]string{{}}
+	for _, name := range sortedKeys(matrix) {
+		var next []map[string]string
+		for _, c := range combos {
+			for _, v := range matrix[name] {
+				next = append(next, mergeMaps(c, map[string]string{name: v}))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// matrixID names the expansion of a matrix step for a combination of
+// values: its ID followed by the values, in the order of their names.
+func matrixID(id string, matrix map[string][]string, values map[string]string) string {
+	parts := []string{id}
+	for _, name := range sortedKeys(matrix) {
+		parts = append(parts, values[name])
+	}
+	return strings.Join(parts, "-")
+}
+
+// value is the result of an expression. unset is an env reference to a
+// variable that is not set, which is an error unless default replaces it.
+type value struct {
+	s      string
+	list   []string
+	isList bool
+	unset  string
+}
+
+type renderer struct {
+	vars      map[string]Var
+	matrix    map[string]string
+	lookupEnv func(string) (string, bool)
+	git       func() (vcs.Info, error)
+	resolving []string // vars being rendered, to detect cycles
+}
+
+// render replaces the interpolations in s.
+func (r *renderer) render(s string) (string, error) {
+	parts, err := parseTemplate(s)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p.expr == nil {
+			b.WriteString(p.lit)
+			continue
+		}
+		v, err := r.scalar(p.expr)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+	}
+	return b.String(), nil
+}
+
+// args renders command arguments. An argument that is a single
+// interpolation of a list is replaced by the list's items.
+func (r *renderer) args(args []string) ([]string, error) {
+	if args == nil {
+		return nil, nil
+	}
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		parts, err := parseTemplate(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 1 && parts[0].expr != nil {
+			v, err := r.eval(parts[0].expr)
+			if err != nil {
+				return nil, err
+			}
+			if v.unset != "" {
+				return nil, fmt.Errorf("%s is not set", v.unset)
+			}
+			if v.isList {
+				out = append(out, v.list...)
+				continue
+			}
+			out = append(out, v.s)
+			continue
+		}
+		s, err := r.render(arg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// scalar evaluates an expression that must produce a string.
+func (r *renderer) scalar(e expr) (string, error) {
+	v, err := r.eval(e)
+	if err != nil {
+		return "", err
+	}
+	if v.unset != "" {
+		return "", fmt.Errorf("%s is not set", v.unset)
+	}
+	if v.isList {
+		return "", fmt.Errorf("a list cannot be embedded in a string; use join")
+	}
+	return v.s, nil
+}
+
+func (r *renderer) eval(e expr) (value, error) {
+	switch e := e.(type) {
+	case litExpr:
+		return value{s: string(e)}, nil
+	case refExpr:
+		return r.ref(e)
+	case callExpr:
+		if arity, ok := functions[e.fn]; !ok || len(e.args) < arity[0] || len(e.args) > arity[1] {
+			return value{}, fmt.Errorf("invalid call of %s", e.fn)
+		}
+		switch e.fn {
+		case "default":
+			v, err := r.eval(e.args[0])
+			if err != nil {
+				return value{}, err
+			}
+			if v.unset != "" || (!v.isList && v.s == "") {
+				return r.eval(e.args[1])
+			}
+			return v, nil
+		case "join":
+			v, err := r.eval(e.args[0])
+			if err != nil || !v.isList {
+				return v, err
+			}
+			sep := " "
+			if len(e.args) == 2 {
+				if sep, err = r.scalar(e.args[1]); err != nil {
+					return value{}, err
+				}
+			}
+			return value{s: strings.Join(v.list, sep)}, nil
+		}
+	}
+	return value{}, fmt.Errorf("invalid expression")
+}
+
+func (r *renderer) ref(e refExpr) (value, error) {
+	switch e.ns {
+	case "vars":
+		v, ok := r.vars[e.name]
+		if !ok {
+			return value{}, fmt.Errorf("vars.%s is not defined", e.name)
+		}
+		if slices.Contains(r.resolving, e.name) {
+			return value{}, fmt.Errorf("vars.%s refers to itself", e.name)
+		}
+		r.resolving = append(r.resolving, e.name)
+		defer func() { r.resolving = r.resolving[:len(r.resolving)-1] }()
+		if !v.IsList {
+			s, err := r.render(v.Value)
+			if err != nil {
+				return value{}, fmt.Errorf("vars.%s: %w", e.name, err)
+			}
+			return value{s: s}, nil
+		}
+		list := make([]string, len(v.List))
+		for i, item := range v.List {
+			s, err := r.render(item)
+			if err != nil {
+				return value{}, fmt.Errorf("vars.%s: %w", e.name, err)
+			}
+			list[i] = s
+		}
+		return value{list: list, isList: true}, nil
+	case "env":
+		if v, ok := r.lookupEnv(e.name); ok {
+			return value{s: v}, nil
+		}
+		return value{unset: "env." + e.name}, nil
+	case "git":
+		field, ok := gitFields[e.name]
+		if !ok {
+			return value{}, fmt.Errorf("git.%s is not a git field", e.name)
+		}
+		if r.git == nil {
+			return value{}, fmt.Errorf("git.%s: git metadata is not available", e.name)
+		}
+		info, err := r.git()
+		if err != nil {
+			return value{}, fmt.Errorf("git.%s: %w", e.name, err)
+		}
+		return value{s: field(info)}, nil
+	case "matrix":
+		if v, ok := r.matrix[e.name]; ok {
+			return value{s: v}, nil
+		}
+		return value{}, fmt.Errorf("matrix.%s is not defined", e.name)
+	}
+	return value{}, fmt.Errorf("unknown reference %s.%s", e.ns, e.name)
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MigratedFile is a config file as MigrateFile rewrote it.
+type MigratedFile struct {
+	Path string // as given, or relative to the including file
+	Data []byte
+	From int // the version it had
+}
+
+// MigrateFile migrates the config file at path and the files it includes,
+// which are returned after it in the order they are loaded. Included files
+// without a version are migrated from the version of the file including
+// them, and are given a version, since that file's version changes.
+func MigrateFile(path string) ([]MigratedFile, error) {
+	var files []MigratedFile
+	seen := map[string]bool{}
+	var migrate func(path string, version int) error
+	migrate = func(path string, version int) error {
+		key, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+
+		data, err := RawBytes(path)
+		if err != nil {
+			return err
+		}
+		cfg, err := decode(data, version)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		out, from, err := Migrate(data, version)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		files = append(files, MigratedFile{Path: path, Data: out, From: from})
+
+		for _, inc := range cfg.Include {
+			if !filepath.IsAbs(inc) {
+				inc = filepath.Join(filepath.Dir(path), inc)
+			}
+			if err := migrate(inc, cfg.Version); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := migrate(path, 0); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Migrate rewrites a config document as the current version, keeping its
+// comments and key order, and returns the version it had. version is taken
+// as its version if it declares none, as for an included file, which is
+// then given one. A document already at the current version is returned
+// unchanged. Files it includes are migrated separately; see MigrateFile.
+func Migrate(data []byte, version int) ([]byte, int, error) {
+	cfg, err := decode(data, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cfg.Version == CurrentVersion {
+		return data, cfg.Version, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, cfg.Version, fmt.Errorf("parse config YAML: %w", err)
+	}
+	root := documentRoot(&doc)
+	if mappingValue(root, "version") == nil {
+		// The comment heading the file stays at its top.
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		if len(root.Content) > 0 {
+			key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+		}
+		root.Content = append([]*yaml.Node{key, {Kind: yaml.ScalarNode, Tag: "!!int"}}, root.Content...)
+	}
+	for v := cfg.Version; v < CurrentVersion; v++ {
+		if err := formats[v].upgrade(root); err != nil {
+			return nil, cfg.Version, fmt.Errorf("migrate from version %d: %w", v, err)
+		}
+		mappingValue(root, "version").Value = strconv.Itoa(v + 1)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, cfg.Version, fmt.Errorf("migrate: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, cfg.Version, fmt.Errorf("migrate: %w", err)
+	}
+	if _, err := decode(buf.Bytes(), 0); err != nil {
+		return nil, cfg.Version, fmt.Errorf("migrate: result is invalid: %w", err)
+	}
+	return buf.Bytes(), cfg.Version, nil
+}
+
+// upgradeV1 keys each profile's steps by their IDs. Comments above a step
+// move to its key, as does a comment on its id line.
+func upgradeV1(root *yaml.Node) error {
+	return profileSteps(root, func(profile string, steps *yaml.Node) error {
+		if steps.Kind != yaml.SequenceNode {
+			return fmt.Errorf("profile %q: steps must be a list", profile)
+		}
+		content := make([]*yaml.Node, 0, 2*len(steps.Content))
+		for i, step := range steps.Content {
+			at := -1
+			if step.Kind == yaml.MappingNode {
+				for j := 0; j+1 < len(step.Content); j += 2 {
+					if step.Content[j].Value == "id" {
+						at = j
+						break
+					}
+				}
+			}
+			if at < 0 {
+				return fmt.Errorf("profile %q steps[%d]: missing id", profile, i)
+			}
+			idKey, idValue := step.Content[at], step.Content[at+1]
+			key := &yaml.Node{
+				Kind:        yaml.ScalarNode,
+				Tag:         "!!str",
+				Value:       idValue.Value,
+				Style:       idValue.Style,
+				HeadComment: joinComments(step.HeadComment, idKey.HeadComment),
+				LineComment: or(idValue.LineComment, idKey.LineComment),
+			}
+			step.HeadComment = ""
+			step.Content = slices.Delete(step.Content, at, at+2)
+			if len(step.Content) == 0 {
+				step.Style = yaml.FlowStyle
+			}
+			content = append(content, key, step)
+		}
+		steps.Kind, steps.Tag, steps.Content = yaml.MappingNode, "!!map", content
+		return nil
+	})
+}
+
+func joinComments(comments ...string) string {
+	var out []string
+	for _, c := range comments {
+		if c != "" {
+			out = append(out, c)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func or(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,406 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/foundry-ci/foundry/internal/notify"
+	"github.com/foundry-ci/foundry/internal/testresults"
+)
+
+// Schema returns the JSON Schema of the config file, generated from the
+// config types, the descriptions in schemaDocs and the rules Validate
+// follows. schemas/foundry-config.schema.json is its output.
+func Schema() ([]byte, error) {
+	g := &schemaGen{}
+	root := &schemaNode{
+		Schema:               "http://json-schema.org/draft-07/schema#",
+		Title:                "Foundry Configuration Schema",
+		Description:          "Schema for .foundry.yaml configuration files",
+		Type:                 "object",
+		AdditionalProperties: false,
+	}
+	g.fields(root, reflect.TypeOf(Config{}), nil)
+	root.Definitions = g.defs
+	if len(g.missing) > 0 {
+		return nil, fmt.Errorf("schema: no description of %s", strings.Join(g.missing, ", "))
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fieldDoc describes a config field in the schema. Enum, Pattern and
+// NonNegative constrain its value, or the values in it if it is a list or
+// mapping. MinItems and UniqueItems constrain it if it is a list, or else
+// the lists in it.
+type fieldDoc struct {
+	Description   string
+	Required      bool
+	Enum          []any
+	Pattern       string
+	NonNegative   bool
+	MinItems      int
+	UniqueItems   bool
+	MinProperties int
+}
+
+// schemaDocs describes every field of the config types, by type and YAML
+// key. Schema fails for a field missing from it.
+var schemaDocs = map[string]fieldDoc{
+	"Config.profiles":  {Description: "Execution profiles", Required: true, MinProperties: 1},
+	"Config.project":   {Description: "Project metadata", Required: true},
+	"Config.policy":    {Description: "What steps the project allows"},
+	"Config.retention": {Description: "How many past runs are kept per profile"},
+	"Config.notify":    {Description: "Webhooks notified when runs of any profile finish, fail or recover"},
+	"Config.include":   {Description: "Config files whose profiles and webhooks are merged into this one, relative to this file"},
+	"Config.vars":      {Description: "Values referenced as ${{ vars.NAME }}, which profiles and steps may override"},
+	"Config.templates": {Description: "Reusable step shapes, used by steps with template"},
+	"Config.version":   {Description: "Configuration schema version; version 1 is deprecated (see anvil migrate)", Required: true, Enum: versionEnum()},
+
+	"Project.name": {Description: "Project name", Required: true},
+
+	"Policy.allow_script_steps": {Description: "Whether to allow script-type steps"},
+
+	"Retention.keep_runs": {Description: "Newest runs kept per profile (0 for the default of 20)", NonNegative: true},
+	"Retention.keep_days": {Description: "Remove runs older than this many days (0 for no limit)", NonNegative: true},
+
+	"Profile.extends": {Description: "Name of the profile to extend, or a list of profiles, later ones overriding earlier ones"},
+	"Profile.steps":   {Description: "Execution steps"},
+	"Profile.notify":  {Description: "Webhooks notified for runs of this profile and profiles extending it"},
+	"Profile.vars":    {Description: "Values referenced as ${{ vars.NAME }}, overriding those of the project and the profiles extended"},
+	"Profile.remove":  {Description: "IDs of inherited steps to drop", UniqueItems: true},
+	"Profile.patch":   {Description: "Changes to inherited steps, by step ID"},
+
+	"Patch.disabled":   {Description: "Disable or re-enable the step"},
+	"Patch.env":        {Description: "Environment variables added or replaced"},
+	"Patch.env_remove": {Description: "Environment variables removed"},
+	"Patch.deps":       {Description: "Step IDs added to the step's dependencies"},
+	"Patch.timeout":    {Description: "Execution timeout replacing the step's"},
+
+	"Step.env":          {Description: "Environment variables"},
+	"Step.id":           {Description: "Unique step identifier (version 1; in version 2 the step's key)"},
+	"Step.type":         {Description: "Step type", Enum: stringsToAny(validStepTypes)},
+	"Step.timeout":      {Description: "Execution timeout (e.g., '30s', '5m')"},
+	"Step.command":      {Description: "Command and arguments to execute", MinItems: 1},
+	"Step.deps":         {Description: "Step IDs this step depends on"},
+	"Step.retries":      {Description: "Number of retries on failure", NonNegative: true},
+	"Step.disabled":     {Description: "Skip the step without skipping the steps that depend on it"},
+	"Step.ready":        {Description: "Readiness probe (service steps)"},
+	"Step.tags":         {Description: "Labels used to select steps (e.g. --only tag:check)"},
+	"Step.inputs":       {Description: "Globs of files the step reads; changes re-run the step in watch mode"},
+	"Step.reports":      {Description: "Test reports the step writes, parsed into per-test results after it finishes (shell steps)"},
+	"Step.paths":        {Description: "With --changed-since, run only if a changed file matches one of these globs"},
+	"Step.paths_ignore": {Description: "With --changed-since, changed files matching these globs do not count"},
+	"Step.vars":         {Description: "Values referenced as ${{ vars.NAME }} in this step, overriding the profile's"},
+	"Step.matrix":       {Description: "Values referenced as ${{ matrix.NAME }}; the step runs once per combination", MinItems: 1, Pattern: matrixValue.String()},
+	"Step.template":     {Description: "Name of the template the step is based on"},
+	"Step.with":         {Description: "Values of the template's params"},
+
+	"Template.params": {Description: "Params referenced as ${{ params.NAME }}, with their defaults; null if the use must give a value"},
+
+	"Probe.tcp":      {Description: "host:port that must accept connections"},
+	"Probe.http":     {Description: "URL that must answer 200 OK"},
+	"Probe.log":      {Description: "Regular expression matched against service output lines"},
+	"Probe.timeout":  {Description: "Readiness deadline (default '30s')"},
+	"Probe.interval": {Description: "Delay between probe attempts (default '250ms')"},
+	"Probe.command":  {Description: "Command that must exit 0", MinItems: 1},
+
+	"Hook.url":        {Description: "URL the notification is POSTed to", Required: true, Pattern: "^https?://"},
+	"Hook.on":         {Description: "Events to notify (default failed and recovered)", Enum: stringsToAny(notify.Events)},
+	"Hook.body":       {Description: "Go text/template rendering the request body (default the JSON payload)"},
+	"Hook.headers":    {Description: "Extra request headers"},
+	"Hook.secret_env": {Description: "Environment variable holding the key the body is signed with (HMAC-SHA256, X-Anvil-Signature header)"},
+	"Hook.retries":    {Description: "Retries after a failed delivery (default 3)", NonNegative: true},
+	"Hook.timeout":    {Description: "Timeout of each request (default 10s)"},
+}
+
+// definitionDocs describes the types written once under definitions and
+// referenced where they are used.
+var definitionDocs = map[string]string{
+	"Profile":  "A named collection of steps, which may extend other profiles",
+	"Patch":    "Changes to some fields of an inherited step",
+	"Hook":     "A webhook notified when runs finish, fail or recover",
+	"Template": "Step fields and params; a step using the template overrides them field by field",
+	"Step":     "A single execution unit; shell and service steps must set command, and a step using a template may leave type to it",
+	"Probe":    "Readiness probe for service steps; set exactly one of tcp, http, command or log",
+	"Var":      "A value; a list spreads over command arguments or joins with join()",
+}
+
+// reportDocs describes the test report formats.
+var reportDocs = map[string]string{
+	"go-test-json": "Glob of files holding go test -json output",
+	"junit":        "Glob of JUnit XML files",
+}
+
+// schemaNode is a JSON Schema, its keywords in the order they are written.
+type schemaNode struct {
+	Schema               string        `json:"$schema,omitempty"`
+	Ref                  string        `json:"$ref,omitempty"`
+	Title                string        `json:"title,omitempty"`
+	Description          string        `json:"description,omitempty"`
+	Type                 any           `json:"type,omitempty"` // a type, or a list of types
+	Enum                 []any         `json:"enum,omitempty"`
+	Pattern              string        `json:"pattern,omitempty"`
+	Minimum              *int          `json:"minimum,omitempty"`
+	Items                *schemaNode   `json:"items,omitempty"`
+	MinItems             int           `json:"minItems,omitempty"`
+	UniqueItems          bool          `json:"uniqueItems,omitempty"`
+	Required             []string      `json:"required,omitempty"`
+	Properties           schemaProps   `json:"properties,omitempty"`
+	AdditionalProperties any           `json:"additionalProperties,omitempty"` // false, or a *schemaNode
+	MinProperties        int           `json:"minProperties,omitempty"`
+	AllOf                []*schemaNode `json:"allOf,omitempty"`
+	AnyOf                []*schemaNode `json:"anyOf,omitempty"`
+	OneOf                []*schemaNode `json:"oneOf,omitempty"`
+	Not                  *schemaNode   `json:"not,omitempty"`
+	If                   *schemaNode   `json:"if,omitempty"`
+	Then                 *schemaNode   `json:"then,omitempty"`
+	Definitions          schemaProps   `json:"definitions,omitempty"`
+}
+
+// schemaProps are named schemas, written as an object in their order.
+type schemaProps []schemaProp
+
+type schemaProp struct {
+	name   string
+	schema *schemaNode
+}
+
+func (ps schemaProps) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, p := range ps {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(p.name); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := enc.Encode(p.schema); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// schemaGen builds the schema, collecting the definitions it references
+// and the fields it has no description of.
+type schemaGen struct {
+	defs    schemaProps
+	missing []string
+}
+
+// fields adds the fields of the struct type t to the object n, leaving out
+// the keys in omit.
+func (g *schemaGen) fields(n *schemaNode, t reflect.Type, omit []string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name := yamlName(f)
+		if !f.IsExported() || name == "-" || slices.Contains(omit, name) {
+			continue
+		}
+		if _, opts, _ := strings.Cut(f.Tag.Get("yaml"), ","); opts == "inline" {
+			g.fields(n, f.Type, omit)
+			continue
+		}
+		key := t.Name() + "." + name
+		doc, ok := schemaDocs[key]
+		if !ok {
+			g.missing = append(g.missing, key)
+			continue
+		}
+		var s *schemaNode
+		switch {
+		case key == "Profile.steps":
+			s = g.steps()
+		case key == "Step.reports":
+			s = g.reports()
+		case f.Type.Kind() == reflect.Struct:
+			s = &schemaNode{Type: "object", AdditionalProperties: false}
+			g.fields(s, f.Type, nil)
+		default:
+			s = g.value(f.Type, doc)
+		}
+		s.Description = doc.Description
+		n.Properties = append(n.Properties, schemaProp{name, s})
+		if doc.Required {
+			n.Required = append(n.Required, name)
+		}
+	}
+}
+
+// value returns the schema of a value of type t.
+func (g *schemaGen) value(t reflect.Type, doc fieldDoc) *schemaNode {
+	switch t {
+	case reflect.TypeOf(Parents{}):
+		return &schemaNode{OneOf: []*schemaNode{
+			{Type: "string"},
+			{Type: "array", Items: &schemaNode{Type: "string"}, UniqueItems: true},
+		}}
+	case reflect.TypeOf(Var{}):
+		return g.ref(t)
+	}
+
+	// Constraints on the values in a list or mapping.
+	elem := fieldDoc{Enum: doc.Enum, Pattern: doc.Pattern, NonNegative: doc.NonNegative}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.value(t.Elem(), doc)
+	case reflect.Struct:
+		return g.ref(t)
+	case reflect.Slice:
+		return &schemaNode{Type: "array", Items: g.value(t.Elem(), elem), MinItems: doc.MinItems, UniqueItems: doc.UniqueItems}
+	case reflect.Map:
+		elem.MinItems, elem.UniqueItems = doc.MinItems, doc.UniqueItems
+		values := g.value(t.Elem(), elem)
+		if t.Elem().Kind() == reflect.Pointer && values.Type != nil {
+			values.Type = []any{values.Type, "null"} // a null value leaves the pointer nil
+		}
+		return &schemaNode{Type: "object", AdditionalProperties: values, MinProperties: doc.MinProperties}
+	}
+
+	s := &schemaNode{Enum: doc.Enum, Pattern: doc.Pattern}
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int:
+		s.Type = "integer"
+		if doc.NonNegative {
+			s.Minimum = new(int)
+		}
+	default:
+		s.Type = "string"
+	}
+	return s
+}
+
+// ref returns a reference to the definition of a named type, adding the
+// definition the first time.
+func (g *schemaGen) ref(t reflect.Type) *schemaNode {
+	name := t.Name()
+	ref := &schemaNode{Ref: "#/definitions/" + name}
+	if slices.ContainsFunc(g.defs, func(p schemaProp) bool { return p.name == name }) {
+		return ref
+	}
+	def := &schemaNode{Description: definitionDocs[name]}
+	if def.Description == "" {
+		g.missing = append(g.missing, name)
+	}
+	g.defs = append(g.defs, schemaProp{name, def})
+
+	switch name {
+	case "Var":
+		def.OneOf = []*schemaNode{
+			{Type: "string"},
+			{Type: "array", Items: &schemaNode{Type: "string"}},
+		}
+		return ref
+	case "Template":
+		// Any field may be a param reference, such as retries:
+		// ${{ params.retries }}, so only the params are typed.
+		def.Type, def.AdditionalProperties = "object", false
+		g.fields(def, t, templateKeys)
+		for i, p := range def.Properties {
+			if p.name != "params" {
+				def.Properties[i].schema = &schemaNode{Description: p.schema.Description}
+			}
+		}
+		return ref
+	case "Step":
+		def.AnyOf = []*schemaNode{{Required: []string{"template"}}, {Required: []string{"type"}}}
+		def.AllOf = stepTypeRules()
+	}
+	def.Type, def.AdditionalProperties = "object", false
+	g.fields(def, t, nil)
+	return ref
+}
+
+// stepTypeRules are the fields steps of some types must or may not set.
+// A step using a template may take its command from the template.
+func stepTypeRules() []*schemaNode {
+	others := func(types []string) []string {
+		return slices.DeleteFunc(slices.Clone(validStepTypes), func(t string) bool { return slices.Contains(types, t) })
+	}
+	typeIn := func(types []string) *schemaNode {
+		return &schemaNode{
+			Required:   []string{"type"},
+			Properties: schemaProps{{"type", &schemaNode{Enum: stringsToAny(types)}}},
+		}
+	}
+	forbid := func(field string) *schemaNode {
+		return &schemaNode{Not: &schemaNode{Required: []string{field}}}
+	}
+
+	needsCommand := typeIn(commandStepTypes)
+	needsCommand.Not = &schemaNode{Required: []string{"template"}}
+	return []*schemaNode{
+		{If: needsCommand, Then: &schemaNode{Required: []string{"command"}}},
+		{If: typeIn(noCommandStepTypes), Then: forbid("command")},
+		{If: typeIn(others(probeStepTypes)), Then: forbid("ready")},
+		{If: typeIn(others(reportStepTypes)), Then: forbid("reports")},
+	}
+}
+
+// steps returns the schema of a profile's steps: a mapping of IDs to steps
+// in version 2, or a list of steps with their IDs in version 1.
+func (g *schemaGen) steps() *schemaNode {
+	step := g.ref(reflect.TypeOf(Step{}))
+	return &schemaNode{OneOf: []*schemaNode{
+		{
+			Description:          "Execution steps by ID (version 2)",
+			Type:                 "object",
+			AdditionalProperties: &schemaNode{AllOf: []*schemaNode{step, {Not: &schemaNode{Required: []string{"id"}}}}},
+		},
+		{
+			Description: "List of execution steps (version 1)",
+			Type:        "array",
+			Items:       &schemaNode{AllOf: []*schemaNode{step, {Required: []string{"id"}}}},
+		},
+	}}
+}
+
+// reports returns the schema of a step's reports, a glob for each format.
+func (g *schemaGen) reports() *schemaNode {
+	s := &schemaNode{Type: "object", AdditionalProperties: false}
+	for _, format := range testresults.Formats {
+		doc, ok := reportDocs[format]
+		if !ok {
+			g.missing = append(g.missing, "Step.reports."+format)
+		}
+		s.Properties = append(s.Properties, schemaProp{format, &schemaNode{Type: "string", Description: doc}})
+	}
+	return s
+}
+
+// versionEnum returns the supported config versions.
+func versionEnum() []any {
+	var vs []any
+	for _, v := range slices.Sorted(maps.Keys(formats)) {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func stringsToAny(ss []string) []any {
+	out := make([]any, len(ss))
+	for i, s := range ss {
+		out[i] = s
+	}
+	return out
+}
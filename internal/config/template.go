@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template is a reusable step shape. A step uses it with template: NAME,
+// giving values for its params under with. The template's fields are
+// merged with the step's field by field: a field the step sets replaces
+// the template's, except that env, vars, reports and matrix merge key by
+// key.
+type Template struct {
+	// Step names the fields a template may set. They are decoded for each
+	// use, once params are substituted, so that a param can give a value
+	// such as retries; Step itself is left empty.
+	Step   Step               `yaml:",inline" json:"-"`
+	Params map[string]*string `yaml:"params,omitempty" json:"params,omitempty"` // name -> default; null if the use must give a value
+
+	node *yaml.Node
+	file string
+	line int
+}
+
+// UnmarshalYAML reads a template's params and keeps its YAML for
+// substituting them into.
+func (t *Template) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: a template must be a mapping", n.Line)
+	}
+	*t = Template{node: n, line: n.Line}
+	if params := mappingValue(n, "params"); params != nil {
+		return params.Decode(&t.Params)
+	}
+	return nil
+}
+
+// templateUse records where a step uses a template, and which fields it
+// sets itself.
+type templateUse struct {
+	file string
+	line int
+	keys []string
+}
+
+// UnmarshalYAML decodes a step, recording the fields it sets if it uses a
+// template.
+func (s *Step) UnmarshalYAML(n *yaml.Node) error {
+	type plain Step
+	if err := n.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	if s.Template != "" {
+		s.use = &templateUse{line: n.Line}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			s.use.keys = append(s.use.keys, n.Content[i].Value)
+		}
+	}
+	return nil
+}
+
+// templateKeys are the step fields a template cannot set.
+var templateKeys = []string{"id", "template", "with"}
+
+// paramRef matches a reference to a template param.
+var paramRef = regexp.MustCompile(`\$\{\{\s*params\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// expandTemplates replaces every step that uses a template with the
+// merge of the two. It reports every template and use that is invalid.
+func expandTemplates(cfg *Config) error {
+	var ds Diagnostics
+	errorf := func(path, format string, args ...any) {
+		ds = append(ds, newDiagnostic(cfg.pos.lookup(path), "validate", fmt.Sprintf(format, args...)))
+	}
+	for _, name := range sortedKeys(cfg.Templates) {
+		t := cfg.Templates[name]
+		for _, key := range templateKeys {
+			if mappingValue(t.node, key) != nil {
+				errorf("/templates/"+name+"/"+key, "template %q (%s): templates cannot set %s", name, position(t.file, t.line), key)
+			}
+		}
+	}
+	if len(ds) > 0 {
+		return ds
+	}
+	for _, profileName := range sortedKeys(cfg.Profiles) {
+		for i, step := range cfg.Profiles[profileName].Steps {
+			if step.Template == "" {
+				if len(step.With) > 0 {
+					errorf(stepPath(profileName, step.ID)+"/with", "profile %q step %q: with is only valid with template", profileName, step.ID)
+				}
+				continue
+			}
+			expanded, err := applyTemplate(cfg, step)
+			if err != nil {
+				errorf(stepPath(profileName, step.ID), "profile %q %s: %v", profileName, cfg.stepRef(step), err)
+				continue
+			}
+			cfg.Profiles[profileName].Steps[i] = expanded
+		}
+	}
+	if len(ds) > 0 {
+		return ds
+	}
+	return nil
+}
+
+// applyTemplate merges a step with the template it uses.
+func applyTemplate(cfg *Config, use Step) (Step, error) {
+	t, ok := cfg.Templates[use.Template]
+	if !ok {
+		return Step{}, fmt.Errorf("template %q is not defined", use.Template)
+	}
+	for _, name := range sortedKeys(use.With) {
+		if _, ok := t.Params[name]; !ok {
+			return Step{}, fmt.Errorf("with.%s is not a param of the template", name)
+		}
+	}
+	params := make(map[string]string, len(t.Params))
+	for _, name := range sortedKeys(t.Params) {
+		if v, ok := use.With[name]; ok {
+			params[name] = v
+		} else if def := t.Params[name]; def != nil {
+			params[name] = *def
+		} else {
+			return Step{}, fmt.Errorf("with.%s is required by the template", name)
+		}
+	}
+
+	node, err := substituteParams(t.node, params)
+	if err != nil {
+		return Step{}, err
+	}
+	var step Step
+	if err := node.Decode(&step); err != nil {
+		return Step{}, fmt.Errorf("template: %w", err)
+	}
+
+	dst, src := reflect.ValueOf(&step).Elem(), reflect.ValueOf(use)
+	for i := range dst.NumField() {
+		f := dst.Type().Field(i)
+		if !f.IsExported() || !slices.Contains(use.use.keys, yamlName(f)) {
+			continue
+		}
+		from, to := src.Field(i), dst.Field(i)
+		if f.Type.Kind() == reflect.Map && !to.IsNil() && !from.IsNil() {
+			merged := reflect.MakeMap(f.Type)
+			for _, m := range []reflect.Value{to, from} {
+				for it := m.MapRange(); it.Next(); {
+					merged.SetMapIndex(it.Key(), it.Value())
+				}
+			}
+			from = merged
+		}
+		to.Set(from)
+	}
+	step.ID, step.use = use.ID, use.use
+	return step, nil
+}
+
+// substituteParams returns a copy of a template's YAML with its params
+// replaced by their values.
+func substituteParams(n *yaml.Node, params map[string]string) (*yaml.Node, error) {
+	c := *n
+	if n.Kind == yaml.ScalarNode && paramRef.MatchString(n.Value) {
+		var err error
+		c.Value = paramRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			name := paramRef.FindStringSubmatch(ref)[1]
+			v, ok := params[name]
+			if !ok && err == nil {
+				err = fmt.Errorf("line %d: params.%s is not a param of the template", n.Line, name)
+			}
+			return v
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Unless the reference is quoted, let the value decide its type,
+		// so that a param can give a number such as retries. A value
+		// such as null or ~ stays a string, which a string field would
+		// otherwise read as empty.
+		if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 {
+			c.Tag, c.Style = "", 0
+			if c.ShortTag() == "!!null" {
+				c.Tag = "!!str"
+			}
+		}
+	}
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			c.Content[i] = child
+			continue
+		}
+		sub, err := substituteParams(child, params)
+		if err != nil {
+			return nil, err
+		}
+		c.Content[i] = sub
+	}
+	return &c, nil
+}
+
+// stepRef names a step in errors. For a step that uses a template, it
+// gives where the step and the template are defined.
+func (c *Config) stepRef(s Step) string {
+	if s.use == nil {
+		return fmt.Sprintf("step %q", s.ID)
+	}
+	if t, ok := c.Templates[s.Template]; ok {
+		return fmt.Sprintf("step %q (%s, from template %q at %s)", s.ID, position(s.use.file, s.use.line), s.Template, position(t.file, t.line))
+	}
+	return fmt.Sprintf("step %q (%s)", s.ID, position(s.use.file, s.use.line))
+}
+
+// position formats a line of a config file, or of the config read from
+// elsewhere if file is empty.
+func position(file string, line int) string {
+	if file == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config format version anvil writes and recommends.
+const CurrentVersion = 2
+
+// A format reads one version of the config file. Documents are decoded
+// through yaml.Node: canonicalize rewrites a document into the shape of the
+// canonical model, Config, whose fields are then decoded from it. upgrade
+// rewrites a document into the next version for "anvil migrate", keeping
+// comments and key order; it is nil for the current version.
+type format struct {
+	canonicalize func(doc *yaml.Node) (warnings []string, err error)
+	upgrade      func(doc *yaml.Node) error
+}
+
+// formats lists the supported versions.
+//
+// Version 1 lists each profile's steps with their IDs. Version 2 maps step
+// IDs to steps, so a step's ID is its key and cannot be repeated.
+var formats = map[int]format{
+	1: {canonicalize: canonicalV1, upgrade: upgradeV1},
+	2: {canonicalize: canonicalV2},
+}
+
+// supportedVersions returns the supported versions, e.g. "1 or 2".
+func supportedVersions() string {
+	var vs []string
+	for v := 1; v <= CurrentVersion; v++ {
+		vs = append(vs, strconv.Itoa(v))
+	}
+	if len(vs) == 1 {
+		return vs[0]
+	}
+	return strings.Join(vs[:len(vs)-1], ", ") + " or " + vs[len(vs)-1]
+}
+
+// decode reads a config document of any supported version into the
+// canonical model, taking version as its version if it declares none.
+// Unknown fields are errors, but the config is still decoded without them
+// and returned with their errors, so that the rest of it can be checked.
+// Includes and validation are left to the caller. Errors are Diagnostics,
+// without a file.
+func decode(data []byte, version int) (*Config, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, decodeDiagnostics(err, "")
+	}
+	root := documentRoot(&doc)
+	if root == nil {
+		return nil, Diagnostics{newDiagnostic(Pos{}, "parse config YAML", "document is empty")}
+	}
+	declared, err := documentVersion(root)
+	if err != nil {
+		return nil, decodeDiagnostics(err, "")
+	}
+	if declared != 0 {
+		version = declared
+	}
+	f, ok := formats[version]
+	if !ok {
+		at := Pos{Line: root.Line, Column: root.Column}
+		if n := mappingValue(root, "version"); n != nil {
+			at = Pos{Line: n.Line, Column: n.Column}
+		}
+		return nil, Diagnostics{newDiagnostic(at, "validate", fmt.Sprintf("unsupported config version %d (expected %s)", version, supportedVersions()))}
+	}
+
+	warnings, err := f.canonicalize(root)
+	if err != nil {
+		return nil, decodeDiagnostics(err, "")
+	}
+	unknown := checkFields(root, reflect.TypeOf(Config{}))
+	cfg := &Config{pos: positions{}}
+	if err := root.Decode(cfg); err != nil {
+		return nil, append(unknown, decodeDiagnostics(err, "")...)
+	}
+	indexNodes(root, "", cfg.pos)
+	cfg.Version, cfg.Warnings = version, warnings
+	for _, w := range warnings {
+		cfg.warnings = append(cfg.warnings, warning(cfg.pos.lookup("/version"), w))
+	}
+	if len(unknown) > 0 {
+		return cfg, unknown
+	}
+	return cfg, nil
+}
+
+// documentRoot returns the top-level mapping of a document, or nil if the
+// document is empty.
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil
+	}
+	return doc.Content[0]
+}
+
+// documentVersion reads the version of a document, 0 if it has none.
+func documentVersion(root *yaml.Node) (int, error) {
+	n := mappingValue(root, "version")
+	if n == nil {
+		return 0, nil
+	}
+	var v int
+	if err := n.Decode(&v); err != nil {
+		return 0, fmt.Errorf("line %d: version must be an integer", n.Line)
+	}
+	return v, nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// profileSteps calls fn with the steps node of each profile that has one.
+func profileSteps(root *yaml.Node, fn func(profile string, steps *yaml.Node) error) error {
+	profiles := mappingValue(root, "profiles")
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, profile := profiles.Content[i].Value, profiles.Content[i+1]
+		if steps := mappingValue(profile, "steps"); steps != nil {
+			if err := fn(name, steps); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func canonicalV1(*yaml.Node) ([]string, error) {
+	return []string{fmt.Sprintf("config version 1 is deprecated; run \"anvil migrate\" to rewrite it as version %d", CurrentVersion)}, nil
+}
+
+// canonicalV2 turns each profile's mapping of step IDs to steps into the
+// list of steps of the canonical model.
+func canonicalV2(root *yaml.Node) ([]string, error) {
+	return nil, profileSteps(root, func(profile string, steps *yaml.Node) error {
+		if steps.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: profile %q: steps must map step IDs to steps", steps.Line, profile)
+		}
+		list := make([]*yaml.Node, 0, len(steps.Content)/2)
+		for i := 0; i+1 < len(steps.Content); i += 2 {
+			key, step := steps.Content[i], steps.Content[i+1]
+			if step.Kind == yaml.ScalarNode && step.Tag == "!!null" {
+				step = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: step.Line, Column: step.Column}
+			}
+			if step.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: profile %q step %q must be a mapping", step.Line, profile, key.Value)
+			}
+			if id := mappingValue(step, "id"); id != nil {
+				return fmt.Errorf("line %d: profile %q step %q: id is given by the step's key", id.Line, profile, key.Value)
+			}
+			idKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "id", Line: key.Line, Column: key.Column}
+			idValue := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.Value, Line: key.Line, Column: key.Column}
+			list = append(list, &yaml.Node{
+				Kind:    yaml.MappingNode,
+				Tag:     "!!map",
+				Content: append([]*yaml.Node{idKey, idValue}, step.Content...),
+				Line:    step.Line,
+				Column:  step.Column,
+			})
+		}
+		steps.Kind, steps.Tag, steps.Content = yaml.SequenceNode, "!!seq", list
+		return nil
+	})
+}
+
+// checkFields reports the keys of n that are not fields of t, as
+// yaml.Decoder.KnownFields does when decoding directly.
+func checkFields(n *yaml.Node, t reflect.Type) Diagnostics {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	var ds Diagnostics
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return nil // type mismatches are reported by Decode
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Value == "<<" {
+				continue
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				d := newDiagnostic(Pos{Line: key.Line, Column: key.Column}, "parse config YAML", fmt.Sprintf("field %s not found in type %s", key.Value, t))
+				d.text = fmt.Sprintf("parse config YAML: line %d: %s", key.Line, d.Message)
+				ds = append(ds, d)
+				continue
+			}
+			ds = append(ds, checkFields(n.Content[i+1], ft)...)
+		}
+	case reflect.Slice:
+		if n.Kind == yaml.SequenceNode {
+			for _, item := range n.Content {
+				ds = append(ds, checkFields(item, t.Elem())...)
+			}
+		}
+	case reflect.Map:
+		if n.Kind == yaml.MappingNode {
+			for i := 1; i < len(n.Content); i += 2 {
+				ds = append(ds, checkFields(n.Content[i], t.Elem())...)
+			}
+		}
+	}
+	return ds
+}
+
+// yamlFields maps the YAML keys of a struct type to their field types.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if _, opts, _ := strings.Cut(f.Tag.Get("yaml"), ","); opts == "inline" {
+			maps.Copy(fields, yamlFields(f.Type))
+			continue
+		}
+		if name := yamlName(f); name != "-" {
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
+
+// yamlName returns the YAML key of a struct field.
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name
+}
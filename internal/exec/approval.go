@@ -0,0 +1,66 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// awaitingApproval is the skip reason of steps downstream of an approval
+// that has not been decided yet.
+const awaitingApproval = "awaiting approval"
+
+// Approval records the decision on an approval step.
+type Approval struct {
+	By       string `json:"by"`
+	At       string `json:"at"` // RFC 3339
+	Approved bool   `json:"approved"`
+}
+
+// Approver decides approval steps. Approve returns a nil Approval to defer
+// the decision, which leaves the step pending so the run can be resumed once
+// someone has approved it out of band.
+type Approver interface {
+	Approve(ctx context.Context, step plan.Step) (*Approval, error)
+}
+
+// requestApproval asks opts.Approver to decide an approval step.
+func requestApproval(ctx context.Context, step plan.Step, opts Options) *StepResult {
+	start := time.Now()
+	result := &StepResult{ID: step.ID, Status: "pending", Error: awaitingApproval}
+
+	opts.emit(Event{StepID: step.ID, State: StateRunning, Attempt: 1})
+
+	var approval *Approval
+	var err error
+	if opts.Approver != nil {
+		approval, err = opts.Approver.Approve(ctx, step)
+	}
+	result.Duration = time.Since(start).String()
+
+	switch {
+	case ctx.Err() != nil:
+		result.Status = "skipped"
+	case err != nil:
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("approval: %v", err)
+	case approval == nil:
+		slog.Info("approval pending", "id", step.ID)
+	case approval.Approved:
+		slog.Info("step approved", "id", step.ID, "by", approval.By)
+		result.Status = "success"
+		result.Error = ""
+		result.Approval = approval
+		result.Attempt = 1
+	default:
+		slog.Info("step rejected", "id", step.ID, "by", approval.By)
+		result.Status = "failed"
+		result.Error = fmt.Sprintf("rejected by %s", approval.By)
+		result.Approval = approval
+		result.Attempt = 1
+	}
+	return result
+}
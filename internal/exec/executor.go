@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/testresults"
 )
 
 // Options configures execution behavior.
@@ -21,21 +22,157 @@ type Options struct {
 	DefaultTimeout time.Duration // Default timeout for steps without explicit timeout
 	Jobs           int           // Number of concurrent jobs
 	FailFast       bool          // Stop execution on first failure
+	Canceller      *Canceller    // Optional handle for cancelling individual steps
+	OnEvent        func(Event)   // Optional observer of step state changes
+	Approver       Approver      // Decides approval steps; nil defers every approval
+
+	// AttemptEnv optionally returns extra KEY=VALUE environment entries for
+	// an attempt of a step, such as trace context. Step env takes precedence.
+	AttemptEnv func(stepID string, attempt int) []string
+
+	// Prior holds results carried over from an earlier run being resumed.
+	// Steps whose prior result is a success are not executed again.
+	Prior map[string]StepResult
+}
+
+// StepState is the lifecycle state of a step during execution.
+type StepState string
+
+// Step states reported through Options.OnEvent.
+const (
+	StateWaiting StepState = "waiting" // blocked on dependencies
+	StateQueued  StepState = "queued"  // waiting for a job slot
+	StateRunning StepState = "running" // an attempt (or a service) has started
+	StateDone    StepState = "done"    // final result available
+)
+
+// Event reports a step state change. OnEvent is called synchronously from
+// the step's goroutine, so observers must be safe for concurrent use and
+// should return quickly.
+type Event struct {
+	Time    time.Time
+	Result  *StepResult // copy of the final result; set for StateDone
+	StepID  string
+	State   StepState
+	LogFile string // log of the current attempt; set for StateRunning
+	Attempt int    // current attempt (1-indexed); set for StateRunning
+}
+
+// attemptEnv returns the extra environment for an attempt, if any.
+func (o Options) attemptEnv(stepID string, attempt int) []string {
+	if o.AttemptEnv == nil {
+		return nil
+	}
+	return o.AttemptEnv(stepID, attempt)
+}
+
+// emit delivers ev to the OnEvent observer, if any.
+func (o Options) emit(ev Event) {
+	if o.OnEvent == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	o.OnEvent(ev)
+}
+
+// emitDone reports a step's final result.
+func (o Options) emitDone(r *StepResult) {
+	result := *r
+	o.emit(Event{StepID: r.ID, State: StateDone, Result: &result})
+}
+
+// Canceller cancels individual steps of an Execute call while the rest of the
+// plan keeps running. A cancelled step is reported as skipped with error
+// "cancelled", and its dependents are skipped in turn. The zero value is not
+// usable; create one with NewCanceller. A nil *Canceller is valid and never
+// cancels anything.
+type Canceller struct {
+	mu        sync.Mutex
+	cancels   map[string]context.CancelFunc
+	requested map[string]bool
+}
+
+// NewCanceller returns a Canceller ready to be passed in Options.
+func NewCanceller() *Canceller {
+	return &Canceller{
+		cancels:   make(map[string]context.CancelFunc),
+		requested: make(map[string]bool),
+	}
+}
+
+// Cancel stops the step with the given ID if it is queued or running. Steps
+// that have not been reached yet are cancelled as soon as they are.
+func (c *Canceller) Cancel(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requested[id] = true
+	if cancel, ok := c.cancels[id]; ok {
+		cancel()
+	}
+}
+
+// track derives the context for a step and registers it for cancellation.
+// The returned func must be called once the step is finished.
+func (c *Canceller) track(ctx context.Context, id string) (context.Context, context.CancelFunc) {
+	stepCtx, cancel := context.WithCancel(ctx)
+	if c == nil {
+		return stepCtx, cancel
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.requested[id] {
+		cancel()
+	}
+	c.cancels[id] = cancel
+	return stepCtx, func() {
+		c.mu.Lock()
+		delete(c.cancels, id)
+		c.mu.Unlock()
+		cancel()
+	}
 }
 
 // StepResult represents the result of executing a single step.
 type StepResult struct {
-	ID       string `json:"id"`
-	Status   string `json:"status"` // success, failed, skipped
-	Error    string `json:"error,omitempty"`
-	LogFile  string `json:"log_file,omitempty"`
+	ID       string    `json:"id"`
+	Status   string    `json:"status"` // success, failed, skipped, pending
+	Error    string    `json:"error,omitempty"`
+	LogFile  string    `json:"log_file,omitempty"`
+	Queued   string    `json:"queued,omitempty"`  // RFC 3339 time the step began waiting for a job slot
+	Started  string    `json:"started,omitempty"` // RFC 3339 time the step started running; unset if it never did
+	Duration string    `json:"duration"`
+	Ready    string    `json:"ready,omitempty"`    // Services: time from start until ready, when the job slot was released
+	Approval *Approval `json:"approval,omitempty"` // Set for decided approval steps
+	Slot     int       `json:"slot,omitempty"`     // Job slot (1-indexed) the step ran in
+	ExitCode int       `json:"exit_code"`
+	Attempt  int       `json:"attempt"` // Number of attempts made (1-indexed)
+
+	// Attempts records each attempt of a shell step, in order.
+	Attempts []AttemptResult `json:"attempts,omitempty"`
+
+	// Tests holds the outcomes read from the step's reports, if any.
+	Tests *testresults.Summary `json:"tests,omitempty"`
+}
+
+// AttemptResult is the outcome of one attempt of a step.
+type AttemptResult struct {
+	Attempt  int    `json:"attempt"`
+	Status   string `json:"status"`
+	Started  string `json:"started"`
 	Duration string `json:"duration"`
 	ExitCode int    `json:"exit_code"`
-	Attempt  int    `json:"attempt"` // Number of attempts made (1-indexed)
+	Error    string `json:"error,omitempty"`
 }
 
-// ExecutionResult represents the overall result of executing a plan.
+// ExecutionResult represents the overall result of executing a plan. Status
+// is "pending" when no step failed but at least one approval is outstanding.
 type ExecutionResult struct {
+	RunID    string       `json:"run_id,omitempty"`
 	Status   string       `json:"status"`
 	Duration string       `json:"duration"`
 	Steps    []StepResult `json:"steps"`
@@ -66,17 +203,25 @@ func Execute(ctx context.Context, p *plan.Plan, opts Options) (*ExecutionResult,
 	results := make(map[string]*StepResult, len(p.Steps))
 	resultsMu := sync.Mutex{}
 
-	// Semaphore for concurrency control.
-	sem := make(chan struct{}, opts.Jobs)
-
-	// Track failed steps for dependency skipping.
-	failedSteps := make(map[string]bool)
-	failedMu := sync.Mutex{}
+	// Job slots for concurrency control, numbered so results record which
+	// slot each step ran in.
+	slots := make(chan int, opts.Jobs)
+	for i := 1; i <= opts.Jobs; i++ {
+		slots <- i
+	}
 
 	// Context for fail-fast cancellation.
 	execCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// Index direct dependents so service steps know how long to stay up.
+	dependents := make(map[string][]string, len(p.Steps))
+	for _, step := range p.Steps {
+		for _, dep := range step.Deps {
+			dependents[dep] = append(dependents[dep], step.ID)
+		}
+	}
+
 	// Execute steps in order, respecting dependencies.
 	var wg sync.WaitGroup
 	for _, stepID := range p.Order {
@@ -90,98 +235,129 @@ func Execute(ctx context.Context, p *plan.Plan, opts Options) (*ExecutionResult,
 		go func() {
 			defer wg.Done()
 
-			// Acquire semaphore.
-			select {
-			case sem <- struct{}{}:
-				defer func() { <-sem }()
-			case <-execCtx.Done():
+			// Each step gets its own context so it can be cancelled alone.
+			stepCtx, release := opts.Canceller.track(execCtx, stepID)
+			defer release()
+
+			finish := func(result *StepResult) {
 				resultsMu.Lock()
-				results[stepID] = &StepResult{
+				results[stepID] = result
+				resultsMu.Unlock()
+				opts.emitDone(result)
+			}
+			skip := func(reason string) {
+				finish(&StepResult{
 					ID:       stepID,
 					Status:   "skipped",
-					Error:    "execution cancelled",
+					Error:    reason,
 					Attempt:  0,
 					Duration: "0s",
-				}
-				resultsMu.Unlock()
+				})
+			}
+
+			// Steps that already succeeded in the run being resumed are
+			// carried over as-is.
+			if prior, ok := opts.Prior[stepID]; ok && prior.Status == "success" {
+				finish(&prior)
 				return
 			}
 
-			// Wait for dependencies to complete.
-			for {
-				allDepsComplete := true
-				resultsMu.Lock()
-				for _, dep := range step.Deps {
-					if _, complete := results[dep]; !complete {
-						allDepsComplete = false
-						break
-					}
-				}
-				resultsMu.Unlock()
+			// Steps pruned at plan time (e.g. no relevant changes) never run.
+			if step.Skip != "" {
+				skip(step.Skip)
+				return
+			}
 
-				if allDepsComplete {
-					break
-				}
+			// Wait for dependencies to complete before taking a job slot, so
+			// steps blocked on their deps never starve the steps they wait on.
+			if len(step.Deps) > 0 {
+				opts.emit(Event{StepID: stepID, State: StateWaiting})
+			}
+			if !waitForResults(stepCtx, step.Deps, results, &resultsMu) {
+				skip(cancelReason(execCtx))
+				return
+			}
 
-				// Sleep briefly before checking again.
-				select {
-				case <-time.After(10 * time.Millisecond):
-				case <-execCtx.Done():
-					resultsMu.Lock()
-					results[stepID] = &StepResult{
-						ID:       stepID,
-						Status:   "skipped",
-						Error:    "execution cancelled",
-						Attempt:  0,
-						Duration: "0s",
-					}
-					resultsMu.Unlock()
-					return
-				}
+			// Skip if any dependency did not succeed (after they completed).
+			if reason := depSkipReason(step.Deps, results, &resultsMu); reason != "" {
+				skip(reason)
+				return
 			}
 
-			// Check if dependencies failed (after they completed).
-			failedMu.Lock()
-			depFailed := false
-			for _, dep := range step.Deps {
-				if failedSteps[dep] {
-					depFailed = true
-					break
+			// Approvals wait on a person, not a job slot.
+			if step.Type == "approval" {
+				started := time.Now()
+				result := requestApproval(stepCtx, step, opts)
+				result.Started = formatTime(started)
+				if stepCtx.Err() != nil {
+					result.Error = cancelReason(execCtx)
+				}
+				if result.Status == "failed" && opts.FailFast {
+					cancel()
 				}
+				finish(result)
+				return
 			}
-			failedMu.Unlock()
 
-			if depFailed {
-				resultsMu.Lock()
-				results[stepID] = &StepResult{
-					ID:       stepID,
-					Status:   "skipped",
-					Error:    "dependency failed",
-					Attempt:  0,
-					Duration: "0s",
-				}
-				resultsMu.Unlock()
+			// Acquire a job slot.
+			opts.emit(Event{StepID: stepID, State: StateQueued})
+			queued := time.Now()
+			var slot int
+			select {
+			case slot = <-slots:
+			case <-stepCtx.Done():
+				skip(cancelReason(execCtx))
 				return
 			}
 
-			// Execute the step.
-			result := executeStep(execCtx, step, opts)
+			// Execute the step. Services release their job slot once ready
+			// and are torn down after the last step downstream finishes.
+			var svc *service
+			var result *StepResult
+			started := time.Now()
+			if step.Type == "service" {
+				svc, result = startService(stepCtx, step, opts)
+				result.Ready = time.Since(started).String()
+			} else {
+				result = executeStep(stepCtx, step, opts)
+				collectTests(step, result, started)
+			}
+			slots <- slot
+			result.Queued, result.Started, result.Slot = formatTime(queued), formatTime(started), slot
+
+			if stepCtx.Err() != nil && execCtx.Err() == nil {
+				result.Status = "skipped"
+				result.Error = "cancelled"
+			}
+
+			// Cancel execution if fail-fast is enabled.
+			if result.Status == "failed" && opts.FailFast {
+				cancel()
+			}
 
 			resultsMu.Lock()
 			results[stepID] = result
 			resultsMu.Unlock()
 
-			// Track failure for dependency skipping.
-			if result.Status == "failed" {
-				failedMu.Lock()
-				failedSteps[stepID] = true
-				failedMu.Unlock()
-
-				// Cancel execution if fail-fast is enabled.
-				if opts.FailFast {
-					cancel()
+			// Stopping can take up to serviceStopGrace, so it updates a copy
+			// of the result and only storing it back holds resultsMu.
+			if svc != nil {
+				waitForResults(stepCtx, downstream(dependents, stepID), results, &resultsMu)
+				stopped := *result
+				svc.stop(&stopped)
+				if stepCtx.Err() != nil && execCtx.Err() == nil {
+					stopped.Status = "skipped"
+					stopped.Error = "cancelled"
 				}
+				resultsMu.Lock()
+				*result = stopped
+				resultsMu.Unlock()
 			}
+
+			resultsMu.Lock()
+			final := *result
+			resultsMu.Unlock()
+			opts.emitDone(&final)
 		}()
 	}
 
@@ -196,8 +372,11 @@ func Execute(ctx context.Context, p *plan.Plan, opts Options) (*ExecutionResult,
 			return nil, fmt.Errorf("execute: missing result for step %q", stepID)
 		}
 		stepResults = append(stepResults, *result)
-		if result.Status == "failed" {
+		switch {
+		case result.Status == "failed":
 			overallStatus = "failed"
+		case result.Status == "pending" && overallStatus == "success":
+			overallStatus = "pending"
 		}
 	}
 
@@ -210,6 +389,88 @@ func Execute(ctx context.Context, p *plan.Plan, opts Options) (*ExecutionResult,
 	}, nil
 }
 
+// downstream returns the steps that depend on id directly or through other
+// steps, given each step's direct dependents.
+func downstream(dependents map[string][]string, id string) []string {
+	var ids []string
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		for _, dep := range dependents[queue[0]] {
+			if !seen[dep] {
+				seen[dep] = true
+				ids = append(ids, dep)
+				queue = append(queue, dep)
+			}
+		}
+		queue = queue[1:]
+	}
+	return ids
+}
+
+// depSkipReason returns why a step must be skipped because of its
+// dependencies, or "" if all of them succeeded. A dependency skipped for
+// having no relevant changes does not block its dependents: whatever it
+// would have produced is assumed to be up to date. Nor does a disabled
+// dependency, which the config has chosen not to run. Steps downstream of an
+// outstanding approval are skipped as awaiting it, so a resumed run knows
+// to execute them.
+func depSkipReason(deps []string, results map[string]*StepResult, mu *sync.Mutex) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	reason := ""
+	for _, dep := range deps {
+		switch r := results[dep]; {
+		case r.Status == "success":
+		case r.Status == "skipped" && (r.Error == plan.SkipNoChanges || r.Error == plan.SkipDisabled):
+		case r.Status == "failed":
+			return "dependency failed"
+		case r.Status == "pending" || r.Error == awaitingApproval:
+			reason = awaitingApproval
+		case reason != awaitingApproval:
+			reason = "dependency skipped"
+		}
+	}
+	return reason
+}
+
+// cancelReason distinguishes a whole-run cancellation from a single step
+// being cancelled through a Canceller.
+func cancelReason(execCtx context.Context) string {
+	if execCtx.Err() != nil {
+		return "execution cancelled"
+	}
+	return "cancelled"
+}
+
+// waitForResults blocks until every listed step has a recorded result. It
+// returns false if ctx is cancelled first.
+func waitForResults(ctx context.Context, ids []string, results map[string]*StepResult, mu *sync.Mutex) bool {
+	for {
+		complete := true
+		mu.Lock()
+		for _, id := range ids {
+			if _, ok := results[id]; !ok {
+				complete = false
+				break
+			}
+		}
+		mu.Unlock()
+
+		if complete {
+			return true
+		}
+
+		// Sleep briefly before checking again.
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
 // executeStep executes a single step with retries.
 func executeStep(ctx context.Context, step plan.Step, opts Options) *StepResult {
 	maxAttempts := step.Retries + 1
@@ -218,15 +479,25 @@ func executeStep(ctx context.Context, step plan.Step, opts Options) *StepResult
 	}
 
 	var lastResult *StepResult
+	var attempts []AttemptResult
 	stepStart := time.Now()
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		attemptStart := time.Now()
 		result := executeStepAttempt(ctx, step, opts, attempt)
 		result.Duration = time.Since(attemptStart).String()
+		attempts = append(attempts, AttemptResult{
+			Attempt:  attempt,
+			Status:   result.Status,
+			Started:  formatTime(attemptStart),
+			Duration: result.Duration,
+			ExitCode: result.ExitCode,
+			Error:    result.Error,
+		})
 
 		if result.Status == "success" {
 			result.Duration = time.Since(stepStart).String()
+			result.Attempts = attempts
 			return result
 		}
 
@@ -248,9 +519,30 @@ func executeStep(ctx context.Context, step plan.Step, opts Options) *StepResult
 	}
 
 	lastResult.Duration = time.Since(stepStart).String()
+	lastResult.Attempts = attempts
 	return lastResult
 }
 
+// formatTime formats t as recorded in results.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// collectTests attaches the outcomes of the tests the step reported. A
+// report that cannot be read is logged and does not change the step's status.
+func collectTests(step plan.Step, result *StepResult, started time.Time) {
+	if len(step.Reports) == 0 {
+		return
+	}
+	// File modification times can lag the clock slightly; only reports
+	// older than the second the step started in are considered stale.
+	tests, err := testresults.Collect(step.Reports, started.Truncate(time.Second))
+	if err != nil {
+		slog.Warn("failed to read test reports", "id", step.ID, "error", err)
+	}
+	result.Tests = tests
+}
+
 // CheckTool checks if a tool is available by running it with the given argument.
 func CheckTool(toolName, arg string) error {
 	cmd := exec.Command(toolName, arg)
@@ -340,12 +632,8 @@ func executeStepAttempt(ctx context.Context, step plan.Step, opts Options, attem
 	}
 
 	// Set environment.
-	if len(step.Env) > 0 {
-		cmd.Env = os.Environ()
-		for k, v := range step.Env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
+	env := commandEnv(step.Env, opts.attemptEnv(step.ID, attempt))
+	cmd.Env = env
 
 	// Apply timeout.
 	timeout := opts.DefaultTimeout
@@ -367,16 +655,12 @@ func executeStepAttempt(ctx context.Context, step plan.Step, opts Options, attem
 			cmd.Stdout = logFile
 			cmd.Stderr = logFile
 		}
-		if len(step.Env) > 0 {
-			cmd.Env = os.Environ()
-			for k, v := range step.Env {
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-			}
-		}
+		cmd.Env = env
 	}
 
 	// Execute command.
 	slog.Info("executing step", "id", step.ID, "attempt", attempt, "command", step.Command)
+	opts.emit(Event{StepID: step.ID, State: StateRunning, Attempt: attempt, LogFile: logPath})
 	err := cmd.Run()
 
 	if err != nil {
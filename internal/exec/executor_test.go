@@ -2,9 +2,13 @@ package exec
 
 import (
 	"context"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -316,3 +320,556 @@ func TestExecute_LogCapture(t *testing.T) {
 		t.Errorf("expected log to contain 'hello-from-log', got: %q", string(logContent))
 	}
 }
+
+// TestExecute_ServiceLogProbe verifies that a service gates its dependents on a
+// log-line probe, does not hold a job slot once ready, and is torn down after
+// its dependents finish.
+func TestExecute_ServiceLogProbe(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{
+				ID:      "db",
+				Type:    "service",
+				Command: []string{"sh", "-c", "echo starting; echo listening on 5432; exec sleep 30"},
+				Ready:   &plan.Probe{Log: "listening on \\d+", Interval: "20ms"},
+			},
+			{ID: "it", Type: "shell", Command: []string{"echo", "integration"}, Deps: []string{"db"}},
+		},
+		Order: []string{"db", "it"},
+	}
+
+	opts := Options{
+		Jobs:           1,
+		DefaultTimeout: 10 * time.Second,
+		FailFast:       true,
+		OutDir:         outDir,
+	}
+
+	start := time.Now()
+	results, err := Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if results.Status != "success" {
+		t.Fatalf("expected status 'success', got %q: %+v", results.Status, results.Steps)
+	}
+
+	if elapsed := time.Since(start); elapsed >= 10*time.Second {
+		t.Errorf("execution took %v, expected service to be torn down promptly", elapsed)
+	}
+
+	svc := results.Steps[0]
+	if svc.ID != "db" || svc.Status != "success" {
+		t.Errorf("expected db service success, got %+v", svc)
+	}
+
+	logContent, err := os.ReadFile(svc.LogFile)
+	if err != nil {
+		t.Fatalf("failed to read service log %q: %v", svc.LogFile, err)
+	}
+	if !strings.Contains(string(logContent), "listening on 5432") {
+		t.Errorf("expected service log to be captured, got: %q", string(logContent))
+	}
+}
+
+// TestExecute_ServiceDownstream verifies that a service stays up until the
+// steps depending on it through other steps have finished, not only its
+// direct dependents.
+func TestExecute_ServiceDownstream(t *testing.T) {
+	t.Parallel()
+
+	up := filepath.Join(t.TempDir(), "up")
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{
+				ID:      "db",
+				Type:    "service",
+				Command: []string{"sh", "-c", "touch " + up + "; trap 'rm " + up + "; exit 0' TERM; echo ready; while :; do sleep 0.05; done"},
+				Ready:   &plan.Probe{Log: "ready", Interval: "20ms"},
+			},
+			{ID: "migrate", Type: "shell", Command: []string{"true"}, Deps: []string{"db"}},
+			{ID: "test", Type: "shell", Command: []string{"sh", "-c", "sleep 0.3; test -f " + up}, Deps: []string{"migrate"}},
+		},
+		Order: []string{"db", "migrate", "test"},
+	}
+
+	opts := Options{
+		Jobs:           2,
+		DefaultTimeout: 10 * time.Second,
+		OutDir:         t.TempDir(),
+	}
+
+	results, err := Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if results.Status != "success" {
+		t.Errorf("expected the service to be up for test, got %q: %+v", results.Status, results.Steps)
+	}
+}
+
+// TestExecute_ServiceTCPProbe verifies that a TCP probe succeeds once the
+// address accepts connections.
+func TestExecute_ServiceTCPProbe(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{
+				ID:      "server",
+				Type:    "service",
+				Command: []string{"sleep", "30"},
+				Ready:   &plan.Probe{TCP: ln.Addr().String(), Timeout: "5s"},
+			},
+			{ID: "client", Type: "shell", Command: []string{"true"}, Deps: []string{"server"}},
+		},
+		Order: []string{"server", "client"},
+	}
+
+	opts := Options{
+		Jobs:           2,
+		DefaultTimeout: 10 * time.Second,
+		FailFast:       true,
+		OutDir:         t.TempDir(),
+	}
+
+	results, err := Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if results.Status != "success" {
+		t.Errorf("expected status 'success', got %q: %+v", results.Status, results.Steps)
+	}
+}
+
+// TestExecute_ServiceNotReady verifies that a service exiting before its probe
+// passes is failed and its dependents are skipped.
+func TestExecute_ServiceNotReady(t *testing.T) {
+	t.Parallel()
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{
+				ID:      "broken",
+				Type:    "service",
+				Command: []string{"sh", "-c", "exit 3"},
+				Ready:   &plan.Probe{Command: []string{"false"}, Interval: "20ms", Timeout: "5s"},
+			},
+			{ID: "dependent", Type: "shell", Command: []string{"echo", "dependent"}, Deps: []string{"broken"}},
+		},
+		Order: []string{"broken", "dependent"},
+	}
+
+	opts := Options{
+		Jobs:           2,
+		DefaultTimeout: 10 * time.Second,
+		FailFast:       false,
+		OutDir:         t.TempDir(),
+	}
+
+	results, err := Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if results.Steps[0].Status != "failed" || results.Steps[0].ExitCode != 3 {
+		t.Errorf("expected broken service failed with exit code 3, got %+v", results.Steps[0])
+	}
+
+	if results.Steps[1].Status != "skipped" || results.Steps[1].Error != "dependency failed" {
+		t.Errorf("expected dependent skipped on dependency failure, got %+v", results.Steps[1])
+	}
+}
+
+// TestExecute_CancelStep verifies that a Canceller stops a single running step,
+// skips its dependents, and leaves unrelated steps alone.
+func TestExecute_CancelStep(t *testing.T) {
+	t.Parallel()
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{ID: "slow", Type: "shell", Command: []string{"sleep", "30"}},
+			{ID: "after", Type: "shell", Command: []string{"true"}, Deps: []string{"slow"}},
+			{ID: "other", Type: "shell", Command: []string{"sleep", "0.2"}},
+		},
+		Order: []string{"other", "slow", "after"},
+	}
+
+	canceller := NewCanceller()
+	opts := Options{
+		Jobs:           4,
+		DefaultTimeout: 10 * time.Second,
+		FailFast:       true,
+		OutDir:         t.TempDir(),
+		Canceller:      canceller,
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { canceller.Cancel("slow") })
+
+	results, err := Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	byID := map[string]StepResult{}
+	for _, sr := range results.Steps {
+		byID[sr.ID] = sr
+	}
+
+	if sr := byID["slow"]; sr.Status != "skipped" || sr.Error != "cancelled" {
+		t.Errorf("expected slow to be cancelled, got %+v", sr)
+	}
+	if sr := byID["after"]; sr.Status != "skipped" || sr.Error != "dependency skipped" {
+		t.Errorf("expected after to be skipped, got %+v", sr)
+	}
+	if sr := byID["other"]; sr.Status != "success" {
+		t.Errorf("expected other to succeed, got %+v", sr)
+	}
+}
+
+// TestExecute_SkipNoChanges verifies that a step skipped for having no relevant
+// changes, or disabled, does not block dependents that are themselves relevant.
+func TestExecute_SkipNoChanges(t *testing.T) {
+	t.Parallel()
+
+	for _, reason := range []string{plan.SkipNoChanges, plan.SkipDisabled} {
+		p := &plan.Plan{
+			Version:     1,
+			ProjectName: "test",
+			Profile:     "default",
+			ConfigHash:  "abc123",
+			CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+			Steps: []plan.Step{
+				{ID: "build", Type: "shell", Command: []string{"false"}, Skip: reason},
+				{ID: "site", Type: "shell", Command: []string{"true"}, Deps: []string{"build"}},
+			},
+			Order: []string{"build", "site"},
+		}
+
+		opts := Options{
+			Jobs:           2,
+			DefaultTimeout: 10 * time.Second,
+			FailFast:       true,
+			OutDir:         t.TempDir(),
+		}
+
+		results, err := Execute(context.Background(), p, opts)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+
+		if results.Status != "success" {
+			t.Errorf("%s: expected status 'success', got %q", reason, results.Status)
+		}
+
+		if sr := results.Steps[0]; sr.Status != "skipped" || sr.Error != reason {
+			t.Errorf("expected build skipped with %q, got %+v", reason, sr)
+		}
+
+		if sr := results.Steps[1]; sr.Status != "success" {
+			t.Errorf("%s: expected site to run, got %+v", reason, sr)
+		}
+	}
+}
+
+// TestExecute_Events verifies the lifecycle events reported through OnEvent.
+func TestExecute_Events(t *testing.T) {
+	t.Parallel()
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{ID: "a", Type: "shell", Command: []string{"true"}},
+			{ID: "b", Type: "shell", Command: []string{"true"}, Deps: []string{"a"}},
+		},
+		Order: []string{"a", "b"},
+	}
+
+	var mu sync.Mutex
+	states := map[string][]StepState{}
+	opts := Options{
+		Jobs:           2,
+		DefaultTimeout: 10 * time.Second,
+		OutDir:         t.TempDir(),
+		OnEvent: func(ev Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			states[ev.StepID] = append(states[ev.StepID], ev.State)
+			if ev.State == StateDone && ev.Result == nil {
+				t.Errorf("done event for %q has no result", ev.StepID)
+			}
+		},
+	}
+
+	if _, err := Execute(context.Background(), p, opts); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	want := map[string][]StepState{
+		"a": {StateQueued, StateRunning, StateDone},
+		"b": {StateWaiting, StateQueued, StateRunning, StateDone},
+	}
+	for id, w := range want {
+		if got := states[id]; !slices.Equal(got, w) {
+			t.Errorf("step %q: expected states %v, got %v", id, w, got)
+		}
+	}
+}
+
+// approverFunc adapts a function to the Approver interface.
+type approverFunc func(step plan.Step) (*Approval, error)
+
+func (f approverFunc) Approve(_ context.Context, step plan.Step) (*Approval, error) {
+	return f(step)
+}
+
+// TestExecute_Approval verifies approved, rejected and deferred approval
+// steps, and that a resumed run carries over earlier successes.
+func TestExecute_Approval(t *testing.T) {
+	t.Parallel()
+
+	counter := filepath.Join(t.TempDir(), "build.count")
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{ID: "build", Type: "shell", Command: []string{"sh", "-c", "echo x >> " + counter}},
+			{ID: "gate", Type: "approval", Deps: []string{"build"}},
+			{ID: "deploy", Type: "shell", Command: []string{"true"}, Deps: []string{"gate"}},
+			{ID: "announce", Type: "shell", Command: []string{"true"}, Deps: []string{"deploy"}},
+		},
+		Order: []string{"build", "gate", "deploy", "announce"},
+	}
+
+	run := func(approver Approver, prior map[string]StepResult) *ExecutionResult {
+		t.Helper()
+		results, err := Execute(context.Background(), p, Options{
+			Jobs:           2,
+			DefaultTimeout: 10 * time.Second,
+			Approver:       approver, // no fail-fast: a rejection would race its dependents' skip reason
+			Prior:          prior,
+		})
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return results
+	}
+
+	// Without a decision the run pauses and downstream steps wait.
+	paused := run(nil, nil)
+	if paused.Status != "pending" {
+		t.Fatalf("expected status 'pending', got %q", paused.Status)
+	}
+	if sr := paused.Steps[1]; sr.Status != "pending" {
+		t.Errorf("expected gate pending, got %+v", sr)
+	}
+	for _, sr := range paused.Steps[2:] {
+		if sr.Status != "skipped" || sr.Error != awaitingApproval {
+			t.Errorf("expected %s skipped awaiting approval, got %+v", sr.ID, sr)
+		}
+	}
+
+	// Resuming with an approval runs the rest without repeating build.
+	prior := make(map[string]StepResult)
+	for _, sr := range paused.Steps {
+		prior[sr.ID] = sr
+	}
+	approve := approverFunc(func(step plan.Step) (*Approval, error) {
+		return &Approval{By: "alice", At: "2026-01-01T00:00:00Z", Approved: true}, nil
+	})
+	resumed := run(approve, prior)
+	if resumed.Status != "success" {
+		t.Fatalf("expected status 'success', got %q: %+v", resumed.Status, resumed.Steps)
+	}
+	if a := resumed.Steps[1].Approval; a == nil || a.By != "alice" {
+		t.Errorf("expected approval by alice to be recorded, got %+v", a)
+	}
+	if data, err := os.ReadFile(counter); err != nil || strings.Count(string(data), "x") != 1 {
+		t.Errorf("expected build to run once, got %q (err %v)", data, err)
+	}
+
+	// A rejection fails the gate and skips what depends on it.
+	reject := approverFunc(func(step plan.Step) (*Approval, error) {
+		return &Approval{By: "bob", At: "2026-01-01T00:00:00Z"}, nil
+	})
+	rejected := run(reject, prior)
+	if rejected.Status != "failed" {
+		t.Errorf("expected status 'failed', got %q", rejected.Status)
+	}
+	if sr := rejected.Steps[1]; sr.Status != "failed" || sr.Error != "rejected by bob" {
+		t.Errorf("expected gate rejected by bob, got %+v", sr)
+	}
+	if sr := rejected.Steps[2]; sr.Status != "skipped" || sr.Error != "dependency failed" {
+		t.Errorf("expected deploy skipped, got %+v", sr)
+	}
+}
+
+// TestExecute_TestReports verifies test outcomes from a step's reports are
+// attached to its result without changing its status.
+func TestExecute_TestReports(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.xml")
+	xml := `<testsuite name="unit"><testcase name="ok"/><testcase name="broken"><failure message="boom"/></testcase></testsuite>`
+
+	p := &plan.Plan{
+		Steps: []plan.Step{
+			{
+				ID:      "test",
+				Type:    "shell",
+				Command: []string{"sh", "-c", "printf '%s' '" + xml + "' > " + report},
+				Reports: map[string]string{"junit": filepath.Join(dir, "*.xml")},
+			},
+		},
+		Order: []string{"test"},
+	}
+
+	results, err := Execute(context.Background(), p, Options{Jobs: 1, DefaultTimeout: 10 * time.Second, OutDir: dir})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	sr := results.Steps[0]
+	if sr.Status != "success" {
+		t.Errorf("expected step status 'success', got %q", sr.Status)
+	}
+	if sr.Tests == nil {
+		t.Fatal("expected test results to be attached")
+	}
+	if got := sr.Tests.String(); got != "1 of 2 tests failed: broken" {
+		t.Errorf("unexpected test summary %q", got)
+	}
+}
+
+// TestExecute_Timing verifies job slots, queue times and attempts are
+// recorded for tracing.
+func TestExecute_Timing(t *testing.T) {
+	t.Parallel()
+
+	p := &plan.Plan{
+		Steps: []plan.Step{
+			{ID: "a", Type: "shell", Command: []string{"sleep", "0.1"}},
+			{ID: "b", Type: "shell", Command: []string{"sh", "-c", "exit 1"}, Retries: 1},
+		},
+		Order: []string{"a", "b"},
+	}
+
+	results, err := Execute(context.Background(), p, Options{Jobs: 1, DefaultTimeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	parse := func(s string) time.Time {
+		t.Helper()
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatalf("invalid time %q: %v", s, err)
+		}
+		return ts
+	}
+	var waited bool
+	for _, sr := range results.Steps {
+		if sr.Slot != 1 {
+			t.Errorf("expected %s in job slot 1, got %d", sr.ID, sr.Slot)
+		}
+		queued, started := parse(sr.Queued), parse(sr.Started)
+		if started.Sub(queued) >= 50*time.Millisecond {
+			waited = true
+		}
+	}
+	if !waited {
+		t.Error("expected one step to wait for the only job slot")
+	}
+
+	b := results.Steps[1]
+	if len(b.Attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %+v", b.Attempts)
+	}
+	for i, a := range b.Attempts {
+		if a.Attempt != i+1 || a.Status != "failed" || a.ExitCode != 1 {
+			t.Errorf("unexpected attempt %+v", a)
+		}
+		if parse(a.Started).Before(parse(b.Started)) {
+			t.Errorf("attempt %d started before its step", a.Attempt)
+		}
+	}
+}
+
+// TestExecute_AttemptEnv verifies that each attempt sees its own extra environment.
+func TestExecute_AttemptEnv(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env")
+	p := &plan.Plan{
+		Steps: []plan.Step{
+			{ID: "a", Type: "shell", Command: []string{"sh", "-c", `echo "$TRACEPARENT $OVERRIDE" >> "$OUT"; exit 1`},
+				Env: map[string]string{"OUT": out, "OVERRIDE": "step"}, Retries: 1},
+		},
+		Order: []string{"a"},
+	}
+	opts := Options{
+		Jobs:           1,
+		DefaultTimeout: 10 * time.Second,
+		AttemptEnv: func(stepID string, attempt int) []string {
+			return []string{"TRACEPARENT=" + stepID + "-" + strconv.Itoa(attempt), "OVERRIDE=extra"}
+		},
+	}
+	if _, err := Execute(context.Background(), p, opts); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "a-1 step\na-2 step\n"; got != want {
+		t.Errorf("expected attempt env %q, got %q", want, got)
+	}
+}
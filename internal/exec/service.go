@@ -0,0 +1,341 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+const (
+	defaultProbeTimeout  = 30 * time.Second
+	defaultProbeInterval = 250 * time.Millisecond
+
+	// serviceStopGrace is how long a service has to exit after SIGTERM
+	// before it and the processes it started are killed.
+	serviceStopGrace = 5 * time.Second
+)
+
+// service is a background process started for a service step.
+type service struct {
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	done    chan struct{} // closed once the process has exited
+	waitErr error         // set before done is closed
+	logFile *os.File
+	started time.Time
+}
+
+// startService launches a service step in the background and blocks until its
+// readiness probe passes. On success it returns the running service and a
+// provisional success result; on failure the process has already been torn
+// down and the returned service is nil.
+func startService(ctx context.Context, step plan.Step, opts Options) (*service, *StepResult) {
+	result := &StepResult{
+		ID:      step.ID,
+		Status:  "failed",
+		Attempt: 1,
+	}
+
+	if len(step.Command) == 0 {
+		result.Error = "empty command"
+		result.Duration = "0s"
+		return nil, result
+	}
+
+	timeout, interval, err := probeTimings(step.Ready)
+	if err != nil {
+		result.Error = err.Error()
+		result.Duration = "0s"
+		return nil, result
+	}
+
+	var logRe *regexp.Regexp
+	if step.Ready != nil && step.Ready.Log != "" {
+		logRe, err = regexp.Compile(step.Ready.Log)
+		if err != nil {
+			result.Error = fmt.Sprintf("invalid ready.log: %v", err)
+			result.Duration = "0s"
+			return nil, result
+		}
+	}
+
+	svc := &service{done: make(chan struct{}), started: time.Now()}
+
+	var out io.Writer = io.Discard
+	if opts.OutDir != "" {
+		logPath := filepath.Join(opts.OutDir, fmt.Sprintf("%s.1.log", step.ID))
+		svc.logFile, err = os.Create(logPath)
+		if err != nil {
+			result.Error = fmt.Sprintf("create log file: %v", err)
+			result.Duration = "0s"
+			return nil, result
+		}
+		result.LogFile = logPath
+		out = svc.logFile
+	}
+
+	matcher := newLineMatcher(logRe)
+	if logRe != nil {
+		out = io.MultiWriter(out, matcher)
+	}
+
+	svcCtx, cancel := context.WithCancel(ctx)
+	svc.cancel = cancel
+	svc.cmd = exec.CommandContext(svcCtx, step.Command[0], step.Command[1:]...)
+	svc.cmd.Stdout = out
+	svc.cmd.Stderr = out
+	svc.cmd.Env = commandEnv(step.Env, opts.attemptEnv(step.ID, 1))
+	setProcessGroup(svc.cmd)
+	svc.cmd.Cancel = func() error {
+		if err := signalGroup(svc.cmd, syscall.SIGTERM); err != nil {
+			return svc.cmd.Process.Kill()
+		}
+		return nil
+	}
+	svc.cmd.WaitDelay = serviceStopGrace
+
+	slog.Info("starting service", "id", step.ID, "command", step.Command)
+	opts.emit(Event{StepID: step.ID, State: StateRunning, Attempt: 1, LogFile: result.LogFile})
+	if err := svc.cmd.Start(); err != nil {
+		cancel()
+		svc.closeLog()
+		result.ExitCode = -1
+		result.Error = err.Error()
+		result.Duration = time.Since(svc.started).String()
+		return nil, result
+	}
+
+	go func() {
+		svc.waitErr = svc.cmd.Wait()
+		close(svc.done)
+	}()
+
+	if err := waitReady(ctx, step, svc, matcher, timeout, interval); err != nil {
+		svc.shutdown()
+		result.ExitCode = exitCode(svc.waitErr)
+		result.Error = err.Error()
+		result.Duration = time.Since(svc.started).String()
+		return nil, result
+	}
+
+	slog.Info("service ready", "id", step.ID, "after", time.Since(svc.started))
+	result.Status = "success"
+	result.Duration = time.Since(svc.started).String()
+	return svc, result
+}
+
+// stop tears the service down and finalizes its result. A service that exited
+// on its own before teardown is reported as failed.
+func (s *service) stop(result *StepResult) {
+	select {
+	case <-s.done:
+		result.Status = "failed"
+		result.ExitCode = exitCode(s.waitErr)
+		result.Error = fmt.Sprintf("service exited before teardown: %v", s.waitErr)
+	default:
+		result.ExitCode = 0
+	}
+	s.shutdown()
+	s.closeLog()
+	result.Duration = time.Since(s.started).String()
+	slog.Info("service stopped", "id", result.ID)
+}
+
+// shutdown signals the service's process group and waits for the process to
+// exit, for up to serviceStopGrace. What is left of the group is then killed,
+// so processes the service started do not outlive it, even if it exited on
+// its own.
+func (s *service) shutdown() {
+	s.cancel()
+	<-s.done
+	_ = signalGroup(s.cmd, syscall.SIGKILL)
+}
+
+func (s *service) closeLog() {
+	if s.logFile != nil {
+		_ = s.logFile.Close()
+	}
+}
+
+// probeTimings returns the effective timeout and polling interval for a probe.
+func probeTimings(p *plan.Probe) (time.Duration, time.Duration, error) {
+	timeout, interval := defaultProbeTimeout, defaultProbeInterval
+	if p == nil {
+		return timeout, interval, nil
+	}
+	if p.Timeout != "" {
+		d, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid ready.timeout: %v", err)
+		}
+		timeout = d
+	}
+	if p.Interval != "" {
+		d, err := time.ParseDuration(p.Interval)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid ready.interval: %v", err)
+		}
+		interval = d
+	}
+	return timeout, interval, nil
+}
+
+// waitReady polls the step's readiness probe until it passes, the service
+// exits, the probe deadline expires or ctx is cancelled. A service without a
+// probe is considered ready as soon as it has started.
+func waitReady(ctx context.Context, step plan.Step, svc *service, matcher *lineMatcher, timeout, interval time.Duration) error {
+	if step.Ready == nil {
+		return nil
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		if probeOnce(ctx, step, matcher, interval) {
+			return nil
+		}
+
+		select {
+		case <-svc.done:
+			return fmt.Errorf("service exited before becoming ready: %v", svc.waitErr)
+		case <-deadline.C:
+			return fmt.Errorf("service not ready after %s", timeout)
+		case <-ctx.Done():
+			return fmt.Errorf("service readiness cancelled: %w", ctx.Err())
+		case <-matcher.matched:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// probeOnce runs a single readiness check. Each attempt is bounded by the
+// polling interval, with a one-second floor so slow endpoints get a chance.
+func probeOnce(ctx context.Context, step plan.Step, matcher *lineMatcher, interval time.Duration) bool {
+	attemptTimeout := max(interval, time.Second)
+	probeCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	p := step.Ready
+	switch {
+	case p.TCP != "":
+		return probeTCP(probeCtx, p.TCP)
+	case p.HTTP != "":
+		return probeHTTP(probeCtx, p.HTTP)
+	case len(p.Command) > 0:
+		cmd := exec.CommandContext(probeCtx, p.Command[0], p.Command[1:]...)
+		cmd.Env = commandEnv(step.Env, nil)
+		return cmd.Run() == nil
+	case p.Log != "":
+		return matcher.isMatched()
+	}
+	return false
+}
+
+func probeTCP(ctx context.Context, addr string) bool {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+func probeHTTP(ctx context.Context, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// lineMatcher is an io.Writer that scans written output line by line and
+// closes matched once a line matches its pattern.
+type lineMatcher struct {
+	re      *regexp.Regexp
+	matched chan struct{}
+	mu      sync.Mutex
+	partial []byte
+	hit     bool
+}
+
+func newLineMatcher(re *regexp.Regexp) *lineMatcher {
+	return &lineMatcher{re: re, matched: make(chan struct{})}
+}
+
+// Write implements io.Writer.
+func (m *lineMatcher) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.hit || m.re == nil {
+		return len(p), nil
+	}
+
+	m.partial = append(m.partial, p...)
+	for {
+		i := bytes.IndexByte(m.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := m.partial[:i]
+		m.partial = m.partial[i+1:]
+		if m.re.Match(line) {
+			m.hit = true
+			m.partial = nil
+			close(m.matched)
+			break
+		}
+	}
+	return len(p), nil
+}
+
+func (m *lineMatcher) isMatched() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hit
+}
+
+// commandEnv returns the process environment extended with extra KEY=VALUE
+// entries and then env, or nil to inherit the parent environment unchanged.
+func commandEnv(env map[string]string, extra []string) []string {
+	if len(env) == 0 && len(extra) == 0 {
+		return nil
+	}
+	out := append(os.Environ(), extra...)
+	for k, v := range env {
+		out = append(out, fmt.Sprintf("%s=%s", k, v))
+	}
+	return out
+}
+
+// exitCode extracts a process exit code from a Wait error.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
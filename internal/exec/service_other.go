@@ -0,0 +1,20 @@
+//go:build !unix
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup does nothing without process groups; only the service's
+// own process is signalled.
+func setProcessGroup(*exec.Cmd) {}
+
+// signalGroup sends sig to cmd's process.
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return cmd.Process.Kill()
+	}
+	return cmd.Process.Signal(sig)
+}
@@ -0,0 +1,93 @@
+//go:build unix
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// TestExecute_ServiceProcessGroup verifies that stopping a service also stops
+// the processes it started, and does not wait out the stop grace period for
+// them.
+func TestExecute_ServiceProcessGroup(t *testing.T) {
+	t.Parallel()
+
+	pidFile := filepath.Join(t.TempDir(), "sleep.pid")
+
+	p := &plan.Plan{
+		Version:     1,
+		ProjectName: "test",
+		Profile:     "default",
+		ConfigHash:  "abc123",
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Steps: []plan.Step{
+			{
+				ID:      "db",
+				Type:    "service",
+				Command: []string{"sh", "-c", "sleep 60 & echo $! > " + pidFile + "; echo ready; wait"},
+				Ready:   &plan.Probe{Log: "ready", Interval: "20ms"},
+			},
+			{ID: "it", Type: "shell", Command: []string{"true"}, Deps: []string{"db"}},
+		},
+		Order: []string{"db", "it"},
+	}
+
+	opts := Options{
+		Jobs:           1,
+		DefaultTimeout: 10 * time.Second,
+		OutDir:         t.TempDir(),
+	}
+
+	start := time.Now()
+	results, err := Execute(context.Background(), p, opts)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if results.Status != "success" {
+		t.Fatalf("expected status 'success', got %q: %+v", results.Status, results.Steps)
+	}
+	if elapsed := time.Since(start); elapsed >= serviceStopGrace {
+		t.Errorf("execution took %v, expected the service to stop without waiting out the grace period", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The orphaned sleep may linger briefly as a zombie until it is reaped.
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the service's child %d to be stopped with it", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processRunning reports whether pid exists and is not a zombie.
+func processRunning(pid int) bool {
+	if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	_, rest, _ := strings.Cut(string(stat), ") ")
+	return !strings.HasPrefix(rest, "Z")
+}
@@ -0,0 +1,275 @@
+// Package forge publishes the status of a run and its steps to the code host
+// of the commit being built: GitHub commit statuses or check runs, GitLab
+// commit statuses and Gitea commit statuses.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State is the state of a status context.
+type State string
+
+// States of a status context. Forges without an equivalent state map them
+// to the nearest they have.
+const (
+	Pending   State = "pending"
+	Running   State = "running"
+	Success   State = "success"
+	Failure   State = "failure"
+	Skipped   State = "skipped"
+	Cancelled State = "cancelled"
+)
+
+// Final reports whether no further update of a context is expected.
+func (s State) Final() bool {
+	return s != Pending && s != Running
+}
+
+// Status is the state of one context (a step, or the whole run) on the
+// commit.
+type Status struct {
+	Context     string // e.g. "anvil/ci" or "anvil/ci/test"
+	State       State
+	Description string
+	Started     time.Time // when the context started running, if it did
+}
+
+// Forge publishes statuses to a code host.
+type Forge interface {
+	// Name identifies the forge in logs.
+	Name() string
+	// Publish sets the status of a context on the commit. It returns a
+	// *RateLimitError if the forge asks to slow down.
+	Publish(ctx context.Context, s Status) error
+}
+
+// Kinds of forge, as selected with Detect.
+var Kinds = []string{"github", "github-checks", "gitlab", "gitea"}
+
+// Config locates the commit and authenticates to the forge's API.
+type Config struct {
+	Kind      string
+	APIURL    string // API base URL, e.g. https://api.github.com
+	Repo      string // owner/name, or the GitLab project ID or path
+	SHA       string
+	Token     string
+	TargetURL string // link from each status, e.g. the CI job
+}
+
+// Detect reads the forge configuration from the environment of a CI job
+// through getenv. kind selects the forge, or "auto" to infer it from the CI
+// system. ANVIL_FORGE_API_URL, ANVIL_FORGE_REPO, ANVIL_FORGE_SHA and
+// ANVIL_FORGE_TOKEN override what the CI system provides.
+func Detect(kind string, getenv func(string) string) (Config, error) {
+	if kind == "auto" {
+		switch {
+		case getenv("GITEA_ACTIONS") == "true":
+			kind = "gitea"
+		case getenv("GITHUB_ACTIONS") == "true":
+			kind = "github"
+		case getenv("GITLAB_CI") == "true":
+			kind = "gitlab"
+		default:
+			return Config{}, errors.New("forge: cannot detect the code host; set --forge to one of " + strings.Join(Kinds, ", "))
+		}
+	}
+
+	cfg := Config{Kind: kind}
+	switch kind {
+	case "github", "github-checks":
+		cfg.APIURL = or(getenv("GITHUB_API_URL"), "https://api.github.com")
+		cfg.Repo, cfg.SHA, cfg.Token = getenv("GITHUB_REPOSITORY"), getenv("GITHUB_SHA"), getenv("GITHUB_TOKEN")
+		cfg.TargetURL = actionsRunURL(getenv)
+	case "gitea":
+		cfg.APIURL = getenv("GITEA_API_URL")
+		if cfg.APIURL == "" && getenv("GITHUB_SERVER_URL") != "" {
+			cfg.APIURL = strings.TrimRight(getenv("GITHUB_SERVER_URL"), "/") + "/api/v1"
+		}
+		cfg.Repo, cfg.SHA = getenv("GITHUB_REPOSITORY"), getenv("GITHUB_SHA")
+		cfg.Token = or(getenv("GITEA_TOKEN"), getenv("GITHUB_TOKEN"))
+		cfg.TargetURL = actionsRunURL(getenv)
+	case "gitlab":
+		cfg.APIURL = getenv("CI_API_V4_URL")
+		cfg.Repo, cfg.SHA, cfg.Token = getenv("CI_PROJECT_ID"), getenv("CI_COMMIT_SHA"), getenv("GITLAB_TOKEN")
+		cfg.TargetURL = or(getenv("CI_JOB_URL"), getenv("CI_PIPELINE_URL"))
+	default:
+		return Config{}, fmt.Errorf("forge: unknown forge %q (must be auto, %s)", kind, strings.Join(Kinds, ", "))
+	}
+	cfg.APIURL = strings.TrimRight(or(getenv("ANVIL_FORGE_API_URL"), cfg.APIURL), "/")
+	cfg.Repo = or(getenv("ANVIL_FORGE_REPO"), cfg.Repo)
+	cfg.SHA = or(getenv("ANVIL_FORGE_SHA"), cfg.SHA)
+	cfg.Token = or(getenv("ANVIL_FORGE_TOKEN"), cfg.Token)
+
+	var missing []string
+	for _, f := range []struct{ name, value string }{{"API URL", cfg.APIURL}, {"repository", cfg.Repo}, {"commit SHA", cfg.SHA}, {"token", cfg.Token}} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return Config{}, fmt.Errorf("forge: %s: missing %s", kind, strings.Join(missing, ", "))
+	}
+	return cfg, nil
+}
+
+// actionsRunURL returns the URL of the GitHub (or Gitea) Actions run.
+func actionsRunURL(getenv func(string) string) string {
+	server, repo, run := getenv("GITHUB_SERVER_URL"), getenv("GITHUB_REPOSITORY"), getenv("GITHUB_RUN_ID")
+	if server == "" || repo == "" || run == "" {
+		return ""
+	}
+	return strings.TrimRight(server, "/") + "/" + repo + "/actions/runs/" + run
+}
+
+func or(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+// New returns the forge cfg describes.
+func New(cfg Config) (Forge, error) {
+	c := &client{http: &http.Client{Timeout: 30 * time.Second}, cfg: cfg, remaining: -1}
+	switch cfg.Kind {
+	case "github":
+		c.auth = githubAuth(cfg.Token)
+		return &githubStatuses{c}, nil
+	case "github-checks":
+		c.auth = githubAuth(cfg.Token)
+		return &githubChecks{client: c, ids: map[string]int64{}}, nil
+	case "gitlab":
+		c.auth = func(req *http.Request) { req.Header.Set("PRIVATE-TOKEN", cfg.Token) }
+		return &gitlab{client: c, sent: map[string]string{}}, nil
+	case "gitea":
+		c.auth = func(req *http.Request) { req.Header.Set("Authorization", "token "+cfg.Token) }
+		return &gitea{c}, nil
+	}
+	return nil, fmt.Errorf("forge: unknown forge %q", cfg.Kind)
+}
+
+// RateLimitError reports that the forge refused a request until Until.
+type RateLimitError struct {
+	Until time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited until " + e.Until.Format(time.RFC3339)
+}
+
+// client makes API requests, tracking the rate limit the forge reports.
+type client struct {
+	http *http.Client
+	cfg  Config
+	auth func(*http.Request)
+
+	// remaining is the number of requests left in the current rate limit
+	// window, or -1 if unknown.
+	remaining int
+	reset     time.Time
+}
+
+// maxDescription is the longest description GitHub accepts.
+const maxDescription = 140
+
+func truncate(s string) string {
+	if r := []rune(s); len(r) > maxDescription {
+		return string(r[:maxDescription-1]) + "…"
+	}
+	return s
+}
+
+// do sends a JSON request and decodes a JSON response into out, if not nil.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.APIURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "anvil")
+	c.auth(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	c.track(resp)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if until, ok := c.limited(resp); ok {
+		return &RateLimitError{Until: until}
+	}
+	return fmt.Errorf("%s %s: responded %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+// track records the rate limit headers of a response: X-RateLimit-* on
+// GitHub and Gitea, RateLimit-* on GitLab.
+func (c *client) track(resp *http.Response) {
+	header := func(name string) string {
+		return or(resp.Header.Get("X-"+name), resp.Header.Get(name))
+	}
+	if n, err := strconv.Atoi(header("RateLimit-Remaining")); err == nil {
+		c.remaining = n
+	}
+	if n, err := strconv.ParseInt(header("RateLimit-Reset"), 10, 64); err == nil {
+		c.reset = time.Unix(n, 0)
+	}
+}
+
+// limited reports whether an error response is a rate limit, and until
+// when. GitHub signals primary and secondary limits with 403 or 429.
+func (c *client) limited(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+		return time.Time{}, false
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(s) * time.Second), true
+	}
+	if c.remaining == 0 && !c.reset.IsZero() {
+		return c.reset, true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return time.Now().Add(time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// Remaining returns the requests left before the forge's rate limit, or -1
+// if it has not said.
+func (c *client) Remaining() int {
+	return c.remaining
+}
+
+// stateName maps a state through table, falling back to the state itself.
+func stateName(s State, table map[State]string) string {
+	if name, ok := table[s]; ok {
+		return name
+	}
+	return string(s)
+}
@@ -0,0 +1,384 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// request is an API request received by a fakeAPI.
+type request struct {
+	Method, Path string
+	Header       http.Header
+	Body         map[string]any
+}
+
+// fakeAPI stands in for a forge's API, recording each request and answering
+// with respond, if set.
+type fakeAPI struct {
+	mu       sync.Mutex
+	requests []request
+	respond  func(w http.ResponseWriter, n int) bool
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, _ := io.ReadAll(req.Body)
+	var body map[string]any
+	_ = json.Unmarshal(data, &body)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, request{Method: req.Method, Path: req.URL.EscapedPath(), Header: req.Header.Clone(), Body: body})
+	if a.respond != nil && a.respond(w, len(a.requests)) {
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_, _ = io.WriteString(w, `{"id": `+strconv.Itoa(len(a.requests))+`}`)
+}
+
+func (a *fakeAPI) received() []request {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]request(nil), a.requests...)
+}
+
+func newForge(t *testing.T, kind, repo string, api *fakeAPI) Forge {
+	t.Helper()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	f, err := New(Config{Kind: kind, APIURL: srv.URL, Repo: repo, SHA: "abc123", Token: "t0ken", TargetURL: "https://ci.example/job/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// TestPublish verifies the request each forge makes for a status.
+func TestPublish(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		kind, repo string
+		path       string
+		auth       [2]string // header and value
+		state      string
+	}{
+		{"github", "acme/app", "/repos/acme/app/statuses/abc123", [2]string{"Authorization", "Bearer t0ken"}, "failure"},
+		{"gitea", "acme/app", "/repos/acme/app/statuses/abc123", [2]string{"Authorization", "token t0ken"}, "failure"},
+		{"gitlab", "acme/app", "/projects/acme%2Fapp/statuses/abc123", [2]string{"PRIVATE-TOKEN", "t0ken"}, "failed"},
+	}
+	for _, tt := range tests {
+		api := &fakeAPI{}
+		f := newForge(t, tt.kind, tt.repo, api)
+		if err := f.Publish(context.Background(), Status{Context: "anvil/ci/test", State: Failure, Description: "failed: exit status 1"}); err != nil {
+			t.Fatalf("%s: %v", tt.kind, err)
+		}
+		got := api.received()
+		if len(got) != 1 {
+			t.Fatalf("%s: expected 1 request, got %d", tt.kind, len(got))
+		}
+		r := got[0]
+		if r.Method != http.MethodPost || r.Path != tt.path {
+			t.Errorf("%s: expected POST %s, got %s %s", tt.kind, tt.path, r.Method, r.Path)
+		}
+		if v := r.Header.Get(tt.auth[0]); v != tt.auth[1] {
+			t.Errorf("%s: expected %s %q, got %q", tt.kind, tt.auth[0], tt.auth[1], v)
+		}
+		name := "context"
+		if tt.kind == "gitlab" {
+			name = "name"
+		}
+		if r.Body["state"] != tt.state || r.Body[name] != "anvil/ci/test" || r.Body["target_url"] != "https://ci.example/job/1" {
+			t.Errorf("%s: unexpected body %v", tt.kind, r.Body)
+		}
+	}
+}
+
+// TestPublish_Checks verifies that a check run is created for a context's
+// first status and updated for the next.
+func TestPublish_Checks(t *testing.T) {
+	t.Parallel()
+
+	api := &fakeAPI{}
+	f := newForge(t, "github-checks", "acme/app", api)
+	ctx := context.Background()
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, s := range []Status{
+		{Context: "anvil/ci/test", State: Running, Description: "running", Started: started},
+		{Context: "anvil/ci/test", State: Success, Description: "passed in 2s", Started: started},
+	} {
+		if err := f.Publish(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := api.received()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(got))
+	}
+	if r := got[0]; r.Method != http.MethodPost || r.Path != "/repos/acme/app/check-runs" ||
+		r.Body["name"] != "anvil/ci/test" || r.Body["head_sha"] != "abc123" || r.Body["status"] != "in_progress" || r.Body["started_at"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected create request %s %s %v", r.Method, r.Path, r.Body)
+	}
+	if r := got[1]; r.Method != http.MethodPatch || r.Path != "/repos/acme/app/check-runs/1" ||
+		r.Body["status"] != "completed" || r.Body["conclusion"] != "success" || r.Body["name"] != nil {
+		t.Errorf("unexpected update request %s %s %v", r.Method, r.Path, r.Body)
+	}
+}
+
+// TestPublish_GitLabUnchanged verifies that a status repeating the GitLab
+// state of its context is not sent, since GitLab rejects it.
+func TestPublish_GitLabUnchanged(t *testing.T) {
+	t.Parallel()
+
+	api := &fakeAPI{}
+	f := newForge(t, "gitlab", "7", api)
+	for _, s := range []Status{
+		{Context: "anvil/ci/test", State: Running, Description: "running"},
+		{Context: "anvil/ci/test", State: Running, Description: "running (attempt 2)"},
+		{Context: "anvil/ci/build", State: Running, Description: "running"},
+		{Context: "anvil/ci/test", State: Failure, Description: "failed"},
+	} {
+		if err := f.Publish(context.Background(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for _, r := range api.received() {
+		got = append(got, r.Body["name"].(string)+" "+r.Body["state"].(string))
+	}
+	want := []string{"anvil/ci/test running", "anvil/ci/build running", "anvil/ci/test failed"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestPublish_RateLimited verifies rate limit responses become a
+// RateLimitError.
+func TestPublish_RateLimited(t *testing.T) {
+	t.Parallel()
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	api := &fakeAPI{respond: func(w http.ResponseWriter, _ int) bool {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+		return true
+	}}
+	f := newForge(t, "github", "acme/app", api)
+
+	err := f.Publish(context.Background(), Status{Context: "anvil/ci", State: Pending})
+	var limited *RateLimitError
+	if !errors.As(err, &limited) || !limited.Until.Equal(reset) {
+		t.Fatalf("expected a rate limit until %v, got %v", reset, err)
+	}
+	if n := f.(interface{ Remaining() int }).Remaining(); n != 0 {
+		t.Errorf("expected 0 requests remaining, got %d", n)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		kind    string
+		env     map[string]string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "github actions",
+			kind: "auto",
+			env: map[string]string{
+				"GITHUB_ACTIONS": "true", "GITHUB_REPOSITORY": "acme/app", "GITHUB_SHA": "abc", "GITHUB_TOKEN": "gh",
+				"GITHUB_SERVER_URL": "https://github.com", "GITHUB_RUN_ID": "42",
+			},
+			want: Config{Kind: "github", APIURL: "https://api.github.com", Repo: "acme/app", SHA: "abc", Token: "gh", TargetURL: "https://github.com/acme/app/actions/runs/42"},
+		},
+		{
+			name: "gitea actions",
+			kind: "auto",
+			env: map[string]string{
+				"GITEA_ACTIONS": "true", "GITHUB_ACTIONS": "true", "GITHUB_REPOSITORY": "acme/app", "GITHUB_SHA": "abc",
+				"GITHUB_TOKEN": "gh", "GITEA_TOKEN": "gt", "GITHUB_SERVER_URL": "https://git.example/",
+			},
+			want: Config{Kind: "gitea", APIURL: "https://git.example/api/v1", Repo: "acme/app", SHA: "abc", Token: "gt"},
+		},
+		{
+			name: "gitlab with overrides",
+			kind: "auto",
+			env: map[string]string{
+				"GITLAB_CI": "true", "CI_API_V4_URL": "https://gitlab.example/api/v4", "CI_PROJECT_ID": "7", "CI_COMMIT_SHA": "abc",
+				"CI_JOB_URL": "https://gitlab.example/job/9", "ANVIL_FORGE_TOKEN": "gl", "ANVIL_FORGE_SHA": "def",
+			},
+			want: Config{Kind: "gitlab", APIURL: "https://gitlab.example/api/v4", Repo: "7", SHA: "def", Token: "gl", TargetURL: "https://gitlab.example/job/9"},
+		},
+		{name: "unknown CI", kind: "auto", wantErr: "cannot detect"},
+		{name: "unknown kind", kind: "bitbucket", wantErr: `unknown forge "bitbucket"`},
+		{name: "missing token", kind: "github-checks", env: map[string]string{"GITHUB_REPOSITORY": "acme/app", "GITHUB_SHA": "abc"}, wantErr: "missing token"},
+	}
+	for _, tt := range tests {
+		got, err := Detect(tt.kind, func(k string) string { return tt.env[k] })
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// recorder is a Forge recording published statuses. It reports remaining
+// requests left before its rate limit and refuses the first limited
+// requests.
+type recorder struct {
+	mu        sync.Mutex
+	published []Status
+	remaining int
+	limited   int
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Publish(_ context.Context, s Status) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.limited > 0 {
+		r.limited--
+		return &RateLimitError{Until: time.Now().Add(10 * time.Millisecond)}
+	}
+	r.published = append(r.published, s)
+	return nil
+}
+
+func (r *recorder) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining
+}
+
+// latest returns the last status published for each context.
+func (r *recorder) latest() map[string]Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := map[string]Status{}
+	for _, s := range r.published {
+		out[s.Context] = s
+	}
+	return out
+}
+
+func testRun(r *Reporter) {
+	r.Start(&plan.Plan{Steps: []plan.Step{{ID: "build"}, {ID: "test"}}})
+	r.Handle(exec.Event{StepID: "build", State: exec.StateRunning, Attempt: 1})
+	r.Handle(exec.Event{StepID: "build", State: exec.StateDone, Result: &exec.StepResult{ID: "build", Status: "success", Duration: "1.234s"}})
+	r.Handle(exec.Event{StepID: "test", State: exec.StateRunning, Attempt: 1})
+	r.Handle(exec.Event{StepID: "test", State: exec.StateRunning, Attempt: 2})
+	r.Handle(exec.Event{StepID: "test", State: exec.StateDone, Result: &exec.StepResult{ID: "test", Status: "failed", Error: "exit status 1"}})
+	r.Finish(context.Background(), &exec.ExecutionResult{Status: "failed", Steps: []exec.StepResult{{ID: "build", Status: "success"}, {ID: "test", Status: "failed"}}})
+}
+
+// TestReporter verifies that updates within an interval are coalesced to
+// the latest status of each context.
+func TestReporter(t *testing.T) {
+	t.Parallel()
+
+	f := &recorder{remaining: -1}
+	testRun(NewReporter(f, "anvil/ci", time.Hour))
+
+	if len(f.published) != 3 {
+		t.Errorf("expected 3 coalesced statuses, got %+v", f.published)
+	}
+	want := map[string]Status{
+		"anvil/ci":       {Context: "anvil/ci", State: Failure, Description: "1 of 2 steps failed: test"},
+		"anvil/ci/build": {Context: "anvil/ci/build", State: Success, Description: "passed in 1.2s"},
+		"anvil/ci/test":  {Context: "anvil/ci/test", State: Failure, Description: "failed: exit status 1"},
+	}
+	for c, w := range want {
+		if got := f.latest()[c]; got != w {
+			t.Errorf("expected %+v, got %+v", w, got)
+		}
+	}
+}
+
+// TestReporter_RateLimit verifies that intermediate statuses are dropped
+// when few requests remain, and that refused requests are retried.
+func TestReporter_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	f := &recorder{remaining: 1, limited: 2}
+	r := NewReporter(f, "anvil/ci", time.Millisecond)
+	r.Start(&plan.Plan{Steps: []plan.Step{{ID: "build"}, {ID: "test"}}})
+	time.Sleep(50 * time.Millisecond)
+	if n := len(f.latest()); n != 0 {
+		t.Errorf("expected pending statuses to be dropped, got %+v", f.published)
+	}
+
+	testRun(r)
+	if got := f.latest(); got["anvil/ci"].State != Failure || got["anvil/ci/build"].State != Success || got["anvil/ci/test"].State != Failure {
+		t.Errorf("expected every final status after the rate limit, got %+v", f.published)
+	}
+}
+
+// TestReporter_CloseDeadline verifies Close gives up when its context ends.
+func TestReporter_CloseDeadline(t *testing.T) {
+	t.Parallel()
+
+	f := &recorder{remaining: -1, limited: 1000}
+	r := NewReporter(f, "anvil/ci", time.Millisecond)
+	r.update(Status{Context: "anvil/ci", State: Success})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	r.Close(ctx)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected Close to return at its deadline, took %v", d)
+	}
+	if len(f.published) != 0 {
+		t.Errorf("expected nothing published, got %+v", f.published)
+	}
+}
+
+// TestReporter_Fail verifies that a run failing before it finishes leaves no
+// context running or pending.
+func TestReporter_Fail(t *testing.T) {
+	t.Parallel()
+
+	f := &recorder{remaining: -1}
+	r := NewReporter(f, "anvil/ci", time.Hour)
+	r.Start(&plan.Plan{Steps: []plan.Step{{ID: "build"}, {ID: "test"}}})
+	r.Handle(exec.Event{StepID: "build", State: exec.StateDone, Result: &exec.StepResult{ID: "build", Status: "success", Duration: "1s"}})
+	r.Handle(exec.Event{StepID: "test", State: exec.StateRunning, Attempt: 1})
+	r.Fail(context.Background(), errors.New("write results: disk full"))
+
+	want := map[string]Status{
+		"anvil/ci":       {Context: "anvil/ci", State: Failure, Description: "failed: write results: disk full"},
+		"anvil/ci/build": {Context: "anvil/ci/build", State: Success, Description: "passed in 1s"},
+		"anvil/ci/test":  {Context: "anvil/ci/test", State: Cancelled, Description: "cancelled: the run failed"},
+	}
+	got := f.latest()
+	for c, w := range want {
+		if got[c].Context != w.Context || got[c].State != w.State || got[c].Description != w.Description {
+			t.Errorf("expected %+v, got %+v", w, got[c])
+		}
+	}
+}
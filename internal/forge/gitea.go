@@ -0,0 +1,19 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// gitea publishes Gitea (and Forgejo) commit statuses, which take the same
+// form as GitHub's.
+type gitea struct {
+	*client
+}
+
+func (g *gitea) Name() string { return "gitea" }
+
+func (g *gitea) Publish(ctx context.Context, s Status) error {
+	return g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/statuses/%s", g.cfg.Repo, g.cfg.SHA), newStatusRequest(s, g.cfg.TargetURL), nil)
+}
@@ -0,0 +1,118 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// githubStates maps states to GitHub (and Gitea) commit status states, which
+// have no running, skipped or cancelled. A skipped step does not fail the
+// commit; the run's own context reports a failure that caused it.
+var githubStates = map[State]string{
+	Running:   "pending",
+	Skipped:   "success",
+	Cancelled: "error",
+}
+
+// statusRequest is the body of a GitHub or Gitea commit status.
+type statusRequest struct {
+	State       string `json:"state"`
+	Context     string `json:"context"`
+	Description string `json:"description,omitempty"`
+	TargetURL   string `json:"target_url,omitempty"`
+}
+
+func newStatusRequest(s Status, targetURL string) statusRequest {
+	return statusRequest{
+		State:       stateName(s.State, githubStates),
+		Context:     s.Context,
+		Description: truncate(s.Description),
+		TargetURL:   targetURL,
+	}
+}
+
+// githubStatuses publishes GitHub commit statuses.
+type githubStatuses struct {
+	*client
+}
+
+func (g *githubStatuses) Name() string { return "github" }
+
+func (g *githubStatuses) Publish(ctx context.Context, s Status) error {
+	return g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/statuses/%s", g.cfg.Repo, g.cfg.SHA), newStatusRequest(s, g.cfg.TargetURL), nil)
+}
+
+func githubAuth(token string) func(*http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	}
+}
+
+// githubChecks publishes GitHub check runs, one per context, created on its
+// first status and updated after.
+type githubChecks struct {
+	*client
+	ids map[string]int64 // check run of each context
+}
+
+// checkConclusions maps final states to check run conclusions.
+var checkConclusions = map[State]string{
+	Success:   "success",
+	Failure:   "failure",
+	Skipped:   "skipped",
+	Cancelled: "cancelled",
+}
+
+type checkRunRequest struct {
+	Name        string       `json:"name,omitempty"`
+	HeadSHA     string       `json:"head_sha,omitempty"`
+	Status      string       `json:"status"`
+	Conclusion  string       `json:"conclusion,omitempty"`
+	StartedAt   string       `json:"started_at,omitempty"`
+	CompletedAt string       `json:"completed_at,omitempty"`
+	DetailsURL  string       `json:"details_url,omitempty"`
+	Output      *checkOutput `json:"output,omitempty"`
+}
+
+type checkOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+func (g *githubChecks) Name() string { return "github-checks" }
+
+func (g *githubChecks) Publish(ctx context.Context, s Status) error {
+	req := checkRunRequest{Status: "queued", DetailsURL: g.cfg.TargetURL}
+	switch {
+	case s.State == Running:
+		req.Status = "in_progress"
+	case s.State.Final():
+		req.Status = "completed"
+		req.Conclusion = checkConclusions[s.State]
+		req.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if !s.Started.IsZero() {
+		req.StartedAt = s.Started.UTC().Format(time.RFC3339)
+	}
+	if s.Description != "" {
+		req.Output = &checkOutput{Title: truncate(s.Description), Summary: s.Description}
+	}
+
+	id, ok := g.ids[s.Context]
+	if ok {
+		return g.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/check-runs/%d", g.cfg.Repo, id), req, nil)
+	}
+	req.Name, req.HeadSHA = s.Context, g.cfg.SHA
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := g.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/check-runs", g.cfg.Repo), req, &created); err != nil {
+		return err
+	}
+	g.ids[s.Context] = created.ID
+	return nil
+}
@@ -0,0 +1,50 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// gitlabStates maps states to GitLab commit status states.
+var gitlabStates = map[State]string{
+	Failure:   "failed",
+	Cancelled: "canceled",
+}
+
+type gitlabStatus struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	TargetURL   string `json:"target_url,omitempty"`
+}
+
+// gitlab publishes GitLab commit statuses. The project is a numeric ID or a
+// path, which the API takes URL-encoded.
+type gitlab struct {
+	*client
+	sent map[string]string // state last sent for each context
+}
+
+func (g *gitlab) Name() string { return "gitlab" }
+
+// Publish implements Forge. GitLab rejects a status that does not change
+// the state of its context, such as "running" again for a retried step, so
+// those are not sent.
+func (g *gitlab) Publish(ctx context.Context, s Status) error {
+	body := gitlabStatus{
+		State:       stateName(s.State, gitlabStates),
+		Name:        s.Context,
+		Description: truncate(s.Description),
+		TargetURL:   g.cfg.TargetURL,
+	}
+	if g.sent[s.Context] == body.State {
+		return nil
+	}
+	if err := g.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%s/statuses/%s", url.PathEscape(g.cfg.Repo), g.cfg.SHA), body, nil); err != nil {
+		return err
+	}
+	g.sent[s.Context] = body.State
+	return nil
+}
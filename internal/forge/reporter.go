@@ -0,0 +1,312 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// DefaultInterval is how long the reporter collects updates before sending
+// them.
+const DefaultInterval = time.Second
+
+// Reporter publishes the status of a run and each of its steps as they
+// execute. Updates are batched: each interval, only the latest status of
+// each context is sent. When the forge's remaining rate limit is lower than
+// the batch, statuses that will be superseded are dropped in favour of
+// final ones, and when it refuses requests, sending pauses until it allows
+// them again.
+type Reporter struct {
+	forge    Forge
+	prefix   string
+	interval time.Duration
+
+	mu      sync.Mutex
+	queue   []string          // contexts with unsent statuses, in update order
+	latest  map[string]Status // newest unsent status of each queued context
+	states  map[string]State  // newest state of each context, sent or not
+	started map[string]time.Time
+	until   time.Time // rate limited until
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wake    chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// NewReporter starts a reporter publishing to f. Contexts are named prefix
+// for the run and prefix/<step-id> for its steps.
+func NewReporter(f Forge, prefix string, interval time.Duration) *Reporter {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reporter{
+		forge:    f,
+		prefix:   prefix,
+		interval: interval,
+		latest:   map[string]Status{},
+		states:   map[string]State{},
+		started:  map[string]time.Time{},
+		ctx:      ctx,
+		cancel:   cancel,
+		wake:     make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// Start marks the run as running and each of its steps as queued.
+func (r *Reporter) Start(p *plan.Plan) {
+	r.update(Status{Context: r.prefix, State: Running, Description: fmt.Sprintf("running %d steps", len(p.Steps)), Started: time.Now()})
+	for _, s := range p.Steps {
+		r.update(Status{Context: r.stepContext(s.ID), State: Pending, Description: "queued"})
+	}
+}
+
+// Handle reports a step state change; it is an exec.Options.OnEvent
+// observer.
+func (r *Reporter) Handle(ev exec.Event) {
+	id := r.stepContext(ev.StepID)
+	switch ev.State {
+	case exec.StateRunning:
+		r.mu.Lock()
+		if _, ok := r.started[id]; !ok {
+			r.started[id] = ev.Time
+		}
+		started := r.started[id]
+		r.mu.Unlock()
+		desc := "running"
+		if ev.Attempt > 1 {
+			desc = fmt.Sprintf("running (attempt %d)", ev.Attempt)
+		}
+		r.update(Status{Context: id, State: Running, Description: desc, Started: started})
+	case exec.StateDone:
+		if ev.Result != nil {
+			r.mu.Lock()
+			started := r.started[id]
+			r.mu.Unlock()
+			r.update(stepStatus(id, *ev.Result, started))
+		}
+	}
+}
+
+// stepStatus describes a step's final result.
+func stepStatus(name string, sr exec.StepResult, started time.Time) Status {
+	s := Status{Context: name, Started: started}
+	switch sr.Status {
+	case "success":
+		s.State, s.Description = Success, "passed in "+sr.Duration
+		if d, err := time.ParseDuration(sr.Duration); err == nil {
+			s.Description = "passed in " + d.Round(100*time.Millisecond).String()
+		}
+	case "skipped":
+		s.State, s.Description = Skipped, "skipped"
+		switch sr.Error {
+		case "":
+		case "cancelled":
+			s.State, s.Description = Cancelled, "cancelled"
+		default:
+			s.Description += ": " + sr.Error
+		}
+	case "pending":
+		s.State, s.Description = Pending, "awaiting approval"
+	default:
+		s.State, s.Description = Failure, "failed"
+		if sr.Error != "" {
+			s.Description += ": " + sr.Error
+		}
+	}
+	if sr.Tests != nil && sr.Tests.Total > 0 {
+		s.Description += " (" + sr.Tests.String() + ")"
+	}
+	return s
+}
+
+// Finish reports the run's outcome and waits until every status is sent or
+// ctx is done.
+func (r *Reporter) Finish(ctx context.Context, res *exec.ExecutionResult) {
+	s := Status{Context: r.prefix}
+	var failed []string
+	for _, sr := range res.Steps {
+		if sr.Status == "failed" {
+			failed = append(failed, sr.ID)
+		}
+	}
+	switch res.Status {
+	case "success":
+		s.State, s.Description = Success, fmt.Sprintf("%d steps passed in %s", len(res.Steps), res.Duration)
+		if d, err := time.ParseDuration(res.Duration); err == nil {
+			s.Description = fmt.Sprintf("%d steps passed in %s", len(res.Steps), d.Round(100*time.Millisecond))
+		}
+	case "pending":
+		s.State, s.Description = Pending, "waiting for approval"
+	default:
+		s.State, s.Description = Failure, fmt.Sprintf("%d of %d steps failed: %s", len(failed), len(res.Steps), strings.Join(failed, ", "))
+	}
+	r.update(s)
+	r.Close(ctx)
+}
+
+// Fail reports that the run failed with err before it could finish: the run
+// as failed and its steps that had not finished as cancelled, so none is left
+// running or pending. Like Finish, it then waits for every status to be sent.
+func (r *Reporter) Fail(ctx context.Context, err error) {
+	r.mu.Lock()
+	var unfinished []Status
+	for c, state := range r.states {
+		if c != r.prefix && !state.Final() {
+			unfinished = append(unfinished, Status{Context: c, State: Cancelled, Description: "cancelled: the run failed", Started: r.started[c]})
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(unfinished, func(a, b Status) int { return strings.Compare(a.Context, b.Context) })
+	for _, s := range unfinished {
+		r.update(s)
+	}
+	r.update(Status{Context: r.prefix, State: Failure, Description: "failed: " + err.Error()})
+	r.Close(ctx)
+}
+
+// Close sends outstanding statuses and stops the reporter, giving up when
+// ctx is done.
+func (r *Reporter) Close(ctx context.Context) {
+	select {
+	case <-r.closing:
+	default:
+		close(r.closing)
+	}
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+	}
+	r.cancel()
+}
+
+func (r *Reporter) stepContext(id string) string {
+	return r.prefix + "/" + id
+}
+
+// update queues a status, replacing any unsent status of its context.
+func (r *Reporter) update(s Status) {
+	r.mu.Lock()
+	if _, ok := r.latest[s.Context]; !ok {
+		r.queue = append(r.queue, s.Context)
+	}
+	r.latest[s.Context] = s
+	r.states[s.Context] = s.State
+	r.mu.Unlock()
+	r.signal()
+}
+
+// signal wakes the sending loop.
+func (r *Reporter) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reporter) loop() {
+	defer close(r.done)
+	for {
+		closing := false
+		select {
+		case <-r.wake:
+			// Collect the updates of the next interval into one batch.
+			select {
+			case <-time.After(r.interval):
+			case <-r.closing:
+				closing = true
+			}
+		case <-r.closing:
+			closing = true
+		}
+		more := r.send()
+		for more && closing {
+			more = r.send()
+		}
+		if closing || r.ctx.Err() != nil {
+			return
+		}
+		if more {
+			r.signal()
+		}
+	}
+}
+
+// send publishes the queued statuses, returning whether any remain to be
+// sent, such as after a rate limit.
+func (r *Reporter) send() bool {
+	r.mu.Lock()
+	until := r.until
+	r.mu.Unlock()
+	if wait := time.Until(until); wait > 0 {
+		slog.Info("forge rate limit reached; pausing status updates", "forge", r.forge.Name(), "until", until)
+		select {
+		case <-time.After(wait):
+		case <-r.ctx.Done():
+			return false
+		}
+	}
+
+	r.mu.Lock()
+	batch := make([]Status, 0, len(r.queue))
+	for _, c := range r.queue {
+		batch = append(batch, r.latest[c])
+	}
+	r.queue, r.latest = nil, map[string]Status{}
+	r.mu.Unlock()
+
+	if rl, ok := r.forge.(interface{ Remaining() int }); ok {
+		if n := rl.Remaining(); n >= 0 && n < len(batch) {
+			var final []Status
+			for _, s := range batch {
+				if s.State.Final() {
+					final = append(final, s)
+				}
+			}
+			slog.Debug("forge rate limit low; sending final statuses only", "forge", r.forge.Name(), "remaining", n, "dropped", len(batch)-len(final))
+			batch = final
+		}
+	}
+
+	for i, s := range batch {
+		err := r.forge.Publish(r.ctx, s)
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			r.mu.Lock()
+			r.until = limited.Until
+			// Requeue what was not sent, unless newer statuses replaced it.
+			for _, s := range batch[i:] {
+				if _, ok := r.latest[s.Context]; !ok {
+					r.latest[s.Context] = s
+					r.queue = append(r.queue, s.Context)
+				}
+			}
+			r.mu.Unlock()
+			return r.ctx.Err() == nil
+		}
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return false
+			}
+			slog.Warn("failed to publish status", "forge", r.forge.Name(), "context", s.Context, "error", err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.queue) > 0
+}
@@ -0,0 +1,159 @@
+// Package history keeps a compact record of every finished run, outliving
+// the run directories removed by retention, and derives duration and
+// reliability statistics from it.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// DefaultKeep is the number of runs Trim keeps by default.
+const DefaultKeep = 5000
+
+// Run is the history record of a finished run, one JSON line in the store.
+type Run struct {
+	RunID      string `json:"run_id"`
+	Project    string `json:"project"`
+	Profile    string `json:"profile"`
+	ConfigHash string `json:"config_hash"`
+	Status     string `json:"status"`
+	StartedAt  string `json:"started_at"`
+	DurationMS int64  `json:"duration_ms"`
+	Steps      []Step `json:"steps"`
+}
+
+// Step is the outcome of a step in a Run.
+type Step struct {
+	ID         string   `json:"id"`
+	Status     string   `json:"status"`
+	DurationMS int64    `json:"duration_ms"`
+	Attempts   int      `json:"attempts,omitempty"`
+	Deps       []string `json:"deps,omitempty"`
+}
+
+// Ran reports whether the step was executed in its run, rather than skipped
+// or left waiting.
+func (s Step) Ran() bool {
+	return s.Status == "success" || s.Status == "failed"
+}
+
+// NewRun builds the record of a finished run from its metadata, plan and
+// results.
+func NewRun(meta *runs.Meta, p *plan.Plan, results *exec.ExecutionResult) Run {
+	r := Run{
+		RunID:      meta.RunID,
+		Project:    meta.Project,
+		Profile:    meta.Profile,
+		ConfigHash: meta.ConfigHash,
+		Status:     results.Status,
+		StartedAt:  meta.StartedAt,
+	}
+	if d, err := time.ParseDuration(meta.Duration); err == nil {
+		r.DurationMS = d.Milliseconds()
+	} else if d, err := time.ParseDuration(results.Duration); err == nil {
+		r.DurationMS = d.Milliseconds()
+	}
+	deps := map[string][]string{}
+	for _, s := range p.Steps {
+		deps[s.ID] = s.Deps
+	}
+	for _, sr := range results.Steps {
+		d, _ := time.ParseDuration(sr.Duration)
+		r.Steps = append(r.Steps, Step{
+			ID:         sr.ID,
+			Status:     sr.Status,
+			DurationMS: d.Milliseconds(),
+			Attempts:   sr.Attempt,
+			Deps:       deps[sr.ID],
+		})
+	}
+	return r
+}
+
+// Append adds r to the store at path, creating it if needed. Each record is
+// written with a single append so concurrent runs do not interleave.
+func Append(path string, r Run) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("append history: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	return nil
+}
+
+// Load reads the store at path, oldest run first. A missing store holds no
+// runs; lines that cannot be parsed, such as one cut short by a crash, are
+// skipped.
+func Load(path string) ([]Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load history: %w", err)
+	}
+	var all []Run
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var r Run
+		if json.Unmarshal(sc.Bytes(), &r) == nil && r.RunID != "" {
+			all = append(all, r)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("load history: %w", err)
+	}
+	return all, nil
+}
+
+// Trim removes all but the newest keep runs from the store at path. Callers
+// must hold the runs lock, as runs appended during the rewrite are lost.
+func Trim(path string, keep int) error {
+	all, err := Load(path)
+	if err != nil || len(all) <= keep {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, r := range all[len(all)-keep:] {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("trim history: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("trim history: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("trim history: %w", err)
+	}
+	return nil
+}
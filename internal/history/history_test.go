@@ -0,0 +1,154 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// TestAppendLoadTrim verifies records round-trip through the store and
+// trimming keeps the newest.
+func TestAppendLoadTrim(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sub", "history.jsonl")
+	if all, err := Load(path); err != nil || len(all) != 0 {
+		t.Fatalf("expected an empty history, got %v (err %v)", all, err)
+	}
+
+	meta := &runs.Meta{RunID: "r1", Project: "demo", Profile: "ci", ConfigHash: "h", StartedAt: "2026-01-01T00:00:00.000Z", Duration: "3.5s"}
+	p := &plan.Plan{Steps: []plan.Step{{ID: "build"}, {ID: "test", Deps: []string{"build"}}}}
+	results := &exec.ExecutionResult{Status: "failed", Steps: []exec.StepResult{
+		{ID: "build", Status: "success", Duration: "1.25s", Attempt: 1},
+		{ID: "test", Status: "failed", Duration: "2s", Attempt: 2},
+	}}
+	rec := NewRun(meta, p, results)
+	if rec.DurationMS != 3500 || rec.Steps[1].DurationMS != 2000 || rec.Steps[1].Attempts != 2 || !slices.Equal(rec.Steps[1].Deps, []string{"build"}) {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	for i := 1; i <= 3; i++ {
+		rec.RunID = fmt.Sprintf("r%d", i)
+		if err := Append(path, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A record cut short by a crash is skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"run_id":"r4","st`)
+	_ = f.Close()
+
+	all, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].RunID != "r1" || all[2].Steps[0].ID != "build" {
+		t.Fatalf("expected r1..r3, got %+v", all)
+	}
+
+	if err := Trim(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	all, _ = Load(path)
+	if len(all) != 2 || all[0].RunID != "r2" {
+		t.Errorf("expected r2 and r3 after trimming, got %+v", all)
+	}
+}
+
+// run returns a history record of the ci profile.
+func run(id, status, config string, ms int64, steps ...Step) Run {
+	return Run{RunID: id, Profile: "ci", ConfigHash: config, Status: status, StartedAt: id, DurationMS: ms, Steps: steps}
+}
+
+func step(id, status string, ms int64, attempts int, deps ...string) Step {
+	return Step{ID: id, Status: status, DurationMS: ms, Attempts: attempts, Deps: deps}
+}
+
+// TestCompute verifies percentiles, rates, flakiness, the critical path and
+// regressions.
+func TestCompute(t *testing.T) {
+	t.Parallel()
+
+	var all []Run
+	// Ten baseline runs: build 1s, lint 2.5s, test 2s after build. The test
+	// passes on a retry once, and fails once and passes in the next run with
+	// the same config.
+	for i := 0; i < 10; i++ {
+		testStep := step("test", "success", 2000, 1, "build")
+		status := "success"
+		switch i {
+		case 3:
+			testStep = step("test", "success", 2000, 2, "build") // passed on retry
+		case 6:
+			testStep, status = step("test", "failed", 500, 1, "build"), "failed"
+		}
+		all = append(all, run(fmt.Sprintf("b%02d", i), status, "h1", 4000,
+			step("build", "success", 1000, 1), step("lint", "success", 2500, 1), testStep))
+	}
+	// Then three runs where the build became much slower.
+	for i := 0; i < 3; i++ {
+		all = append(all, run(fmt.Sprintf("r%02d", i), "success", "h2", 6500,
+			step("build", "success", 3500, 1), step("lint", "success", 2500, 1), step("test", "success", 2000, 1, "build")))
+	}
+	all = append(all, run("other", "failed", "h1", 1, step("build", "failed", 1, 1)))
+	all[len(all)-1].Profile = "release"
+
+	st := Compute(all, Options{Profile: "ci", Window: 0, Recent: 3, Baseline: 10, Threshold: 0.2})
+	if st.Runs != 13 || st.From != "b00" || st.To != "r02" {
+		t.Errorf("expected 13 runs from b00 to r02, got %d from %s to %s", st.Runs, st.From, st.To)
+	}
+	if got := st.FailureRate; got != 1.0/13 {
+		t.Errorf("expected failure rate 1/13, got %v", got)
+	}
+	if st.P50MS != 4000 || st.P95MS != 6500 {
+		t.Errorf("expected run p50 4000 and p95 6500, got %d and %d", st.P50MS, st.P95MS)
+	}
+
+	byID := map[string]StepStats{}
+	for _, s := range st.Steps {
+		byID[s.ID] = s
+	}
+	test := byID["test"]
+	if test.Runs != 13 || test.Failures != 1 || test.Retried != 1 || test.Flakes != 2 || test.P50MS != 2000 {
+		t.Errorf("unexpected test stats %+v", test)
+	}
+	if b := byID["build"]; b.P50MS != 1000 || b.P95MS != 3500 {
+		t.Errorf("expected build p50 1000 and p95 3500, got %+v", b)
+	}
+	if len(st.Flaky) != 1 || st.Flaky[0].ID != "test" {
+		t.Errorf("expected test to be the only flaky step, got %+v", st.Flaky)
+	}
+
+	// build (1s) then test (2s) outlasts lint (2.5s).
+	if cp := st.CriticalPath; cp == nil || !slices.Equal(cp.Steps, []string{"build", "test"}) || cp.DurationMS != 3000 {
+		t.Errorf("expected critical path build → test of 3000ms, got %+v", cp)
+	}
+
+	var regressed []string
+	for _, r := range st.Regressions {
+		regressed = append(regressed, r.Step)
+	}
+	if !slices.Equal(regressed, []string{"build", ""}) {
+		t.Fatalf("expected build and the run to regress, got %+v", st.Regressions)
+	}
+	if r := st.Regressions[0]; r.BaselineP50MS != 1000 || r.RecentP50MS != 3500 || r.Change != 2.5 {
+		t.Errorf("unexpected build regression %+v", r)
+	}
+
+	window := Compute(all, Options{Profile: "ci", Window: 3})
+	if window.Runs != 3 || len(window.Flaky) != 0 || len(window.Regressions) != 0 {
+		t.Errorf("expected a window of 3 clean runs, got %+v", window)
+	}
+	if empty := Compute(nil, Options{Profile: "ci"}); empty.Runs != 0 || empty.CriticalPath != nil {
+		t.Errorf("expected no stats without history, got %+v", empty)
+	}
+}
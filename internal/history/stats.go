@@ -0,0 +1,302 @@
+package history
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Defaults of Options.
+const (
+	DefaultWindow    = 50
+	DefaultRecent    = 5
+	DefaultBaseline  = 20
+	DefaultThreshold = 0.2
+)
+
+// minRegressionMS is the smallest slowdown reported as a regression, so that
+// noise in short steps is not.
+const minRegressionMS = 100
+
+// minBaseline is the fewest baseline samples a regression is judged on.
+const minBaseline = 3
+
+// maxFlaky bounds the flakiest steps listed.
+const maxFlaky = 5
+
+// Options select the runs statistics are computed over.
+type Options struct {
+	Profile   string  // only runs of this profile; empty for all
+	Window    int     // newest runs summarised; 0 for all
+	Recent    int     // newest runs compared against the baseline
+	Baseline  int     // runs before the recent ones forming the baseline
+	Threshold float64 // relative slowdown of the median reported, e.g. 0.2 for 20%
+}
+
+// Stats summarise a window of runs. Durations are in milliseconds and
+// percentiles are over successful executions.
+type Stats struct {
+	Profile      string       `json:"profile,omitempty"`
+	Runs         int          `json:"runs"`
+	From         string       `json:"from,omitempty"` // start of the oldest run summarised
+	To           string       `json:"to,omitempty"`   // start of the newest
+	FailureRate  float64      `json:"failure_rate"`
+	P50MS        int64        `json:"p50_ms"`
+	P95MS        int64        `json:"p95_ms"`
+	Steps        []StepStats  `json:"steps"`
+	Flaky        []StepStats  `json:"flaky"`
+	CriticalPath *Path        `json:"critical_path,omitempty"`
+	Regressions  []Regression `json:"regressions"`
+}
+
+// StepStats summarise a step over the runs it was executed in.
+type StepStats struct {
+	ID          string  `json:"id"`
+	Runs        int     `json:"runs"`
+	P50MS       int64   `json:"p50_ms"`
+	P95MS       int64   `json:"p95_ms"`
+	Failures    int     `json:"failures"`
+	Retried     int     `json:"retried"`
+	Flakes      int     `json:"flakes"`
+	FailureRate float64 `json:"failure_rate"`
+	RetryRate   float64 `json:"retry_rate"`
+	FlakeRate   float64 `json:"flake_rate"`
+}
+
+// Path is the chain of dependent steps that bounds a run's duration, with
+// each step weighted by its median duration.
+type Path struct {
+	Steps      []string `json:"steps"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// Regression is a step, or the whole run if Step is empty, whose median
+// duration over the recent runs exceeds its baseline.
+type Regression struct {
+	Step          string  `json:"step,omitempty"`
+	BaselineP50MS int64   `json:"baseline_p50_ms"`
+	RecentP50MS   int64   `json:"recent_p50_ms"`
+	Change        float64 `json:"change"` // relative, e.g. 0.5 for 50% slower
+}
+
+// Compute derives statistics from all, the history oldest run first.
+func Compute(all []Run, opts Options) *Stats {
+	var selected []Run
+	for _, r := range all {
+		if opts.Profile == "" || r.Profile == opts.Profile {
+			selected = append(selected, r)
+		}
+	}
+	window := selected
+	if opts.Window > 0 && len(window) > opts.Window {
+		window = window[len(window)-opts.Window:]
+	}
+
+	st := &Stats{Profile: opts.Profile, Runs: len(window), Steps: []StepStats{}, Flaky: []StepStats{}, Regressions: []Regression{}}
+	if len(window) == 0 {
+		return st
+	}
+	st.From, st.To = window[0].StartedAt, window[len(window)-1].StartedAt
+
+	var failed int
+	var runDurations []int64
+	for _, r := range window {
+		if r.Status == "success" {
+			runDurations = append(runDurations, r.DurationMS)
+		} else {
+			failed++
+		}
+	}
+	st.FailureRate = rate(failed, len(window))
+	st.P50MS, st.P95MS = percentile(runDurations, 0.5), percentile(runDurations, 0.95)
+
+	st.Steps = stepStats(window)
+	for _, s := range st.Steps {
+		if s.Flakes > 0 {
+			st.Flaky = append(st.Flaky, s)
+		}
+	}
+	slices.SortStableFunc(st.Flaky, func(a, b StepStats) int {
+		return cmp.Or(cmp.Compare(b.FlakeRate, a.FlakeRate), cmp.Compare(b.Flakes, a.Flakes))
+	})
+	if len(st.Flaky) > maxFlaky {
+		st.Flaky = st.Flaky[:maxFlaky]
+	}
+
+	medians := map[string]int64{}
+	for _, s := range st.Steps {
+		medians[s.ID] = s.P50MS
+	}
+	st.CriticalPath = criticalPath(window[len(window)-1].Steps, medians)
+	st.Regressions = regressions(selected, opts)
+	return st
+}
+
+// stepStats summarises each step that ran in window, in order of first
+// appearance.
+func stepStats(window []Run) []StepStats {
+	var order []string
+	byID := map[string]*StepStats{}
+	durations := map[string][]int64{}
+	// last is a step's previous outcome, with the config it ran under.
+	type outcome struct{ status, config string }
+	last := map[string]outcome{}
+
+	for _, r := range window {
+		for _, s := range r.Steps {
+			if !s.Ran() {
+				continue
+			}
+			ss, ok := byID[s.ID]
+			if !ok {
+				ss = &StepStats{ID: s.ID}
+				byID[s.ID] = ss
+				order = append(order, s.ID)
+			}
+			ss.Runs++
+			if s.Attempts > 1 {
+				ss.Retried++
+			}
+			if s.Status == "success" {
+				durations[s.ID] = append(durations[s.ID], s.DurationMS)
+				// Passing only on a retry, or after failing with the same
+				// config, points at the step rather than a change.
+				prev := last[s.ID]
+				if s.Attempts > 1 || (prev.status == "failed" && prev.config == r.ConfigHash) {
+					ss.Flakes++
+				}
+			} else {
+				ss.Failures++
+			}
+			last[s.ID] = outcome{s.Status, r.ConfigHash}
+		}
+	}
+
+	stats := make([]StepStats, 0, len(order))
+	for _, id := range order {
+		ss := byID[id]
+		ss.P50MS, ss.P95MS = percentile(durations[id], 0.5), percentile(durations[id], 0.95)
+		ss.FailureRate = rate(ss.Failures, ss.Runs)
+		ss.RetryRate = rate(ss.Retried, ss.Runs)
+		ss.FlakeRate = rate(ss.Flakes, ss.Runs)
+		stats = append(stats, *ss)
+	}
+	return stats
+}
+
+// criticalPath returns the longest chain of dependencies among steps,
+// weighting each by its median duration.
+func criticalPath(steps []Step, medians map[string]int64) *Path {
+	deps := map[string][]string{}
+	for _, s := range steps {
+		deps[s.ID] = s.Deps
+	}
+	type best struct {
+		total int64
+		prev  string
+	}
+	memo := map[string]best{}
+	var visit func(id string, seen map[string]bool) best
+	visit = func(id string, seen map[string]bool) best {
+		if b, ok := memo[id]; ok {
+			return b
+		}
+		var b best
+		seen[id] = true
+		for _, dep := range deps[id] {
+			if _, ok := deps[dep]; !ok || seen[dep] {
+				continue
+			}
+			if d := visit(dep, seen); d.total > b.total || b.prev == "" {
+				b = best{d.total, dep}
+			}
+		}
+		delete(seen, id)
+		b.total += medians[id]
+		memo[id] = b
+		return b
+	}
+
+	var end string
+	var longest int64 = -1
+	for _, s := range steps {
+		if b := visit(s.ID, map[string]bool{}); b.total > longest {
+			end, longest = s.ID, b.total
+		}
+	}
+	if end == "" {
+		return nil
+	}
+	path := &Path{DurationMS: longest}
+	for id := end; id != ""; id = memo[id].prev {
+		path.Steps = append(path.Steps, id)
+	}
+	slices.Reverse(path.Steps)
+	return path
+}
+
+// regressions compares the median durations of the newest opts.Recent runs
+// with those of the opts.Baseline runs before them.
+func regressions(all []Run, opts Options) []Regression {
+	found := []Regression{}
+	if opts.Recent <= 0 || opts.Baseline <= 0 || len(all) <= opts.Recent {
+		return found
+	}
+	recent := all[len(all)-opts.Recent:]
+	baseline := all[max(len(all)-opts.Recent-opts.Baseline, 0) : len(all)-opts.Recent]
+
+	samples := func(runs []Run) (map[string][]int64, []string) {
+		byStep := map[string][]int64{}
+		var order []string
+		for _, r := range runs {
+			if r.Status == "success" {
+				byStep[""] = append(byStep[""], r.DurationMS)
+			}
+			for _, s := range r.Steps {
+				if s.Status != "success" {
+					continue
+				}
+				if _, ok := byStep[s.ID]; !ok {
+					order = append(order, s.ID)
+				}
+				byStep[s.ID] = append(byStep[s.ID], s.DurationMS)
+			}
+		}
+		return byStep, order
+	}
+	base, _ := samples(baseline)
+	now, order := samples(recent)
+
+	for _, id := range append([]string{""}, order...) {
+		if len(base[id]) < minBaseline || len(now[id]) == 0 {
+			continue
+		}
+		b, n := percentile(base[id], 0.5), percentile(now[id], 0.5)
+		if n-b < minRegressionMS || float64(n) <= float64(b)*(1+opts.Threshold) {
+			continue
+		}
+		change := float64(n-b) / float64(max(b, 1))
+		found = append(found, Regression{Step: id, BaselineP50MS: b, RecentP50MS: n, Change: change})
+	}
+	slices.SortStableFunc(found, func(a, b Regression) int { return cmp.Compare(b.Change, a.Change) })
+	return found
+}
+
+// percentile returns the nearest-rank percentile p of values, or 0 if there
+// are none.
+func percentile(values []int64, p float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func rate(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
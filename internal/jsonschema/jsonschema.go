@@ -0,0 +1,483 @@
+// Package jsonschema validates YAML documents against a JSON Schema, keeping
+// the line and column of each problem. It implements the parts of draft-07
+// that Foundry's config schema uses: type, enum, const, required,
+// properties, additionalProperties, minProperties, items, minItems,
+// uniqueItems, minimum, pattern, allOf, anyOf, oneOf, not, if/then/else and
+// local $refs.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a parsed JSON Schema.
+type Schema struct {
+	root     map[string]any
+	patterns map[string]*regexp.Regexp
+}
+
+// Parse reads a JSON Schema, checking that its patterns compile.
+func Parse(data []byte) (*Schema, error) {
+	var root map[string]any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	s := &Schema{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := s.compile(root); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	return s, nil
+}
+
+// compile compiles the patterns under v.
+func (s *Schema) compile(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, sub := range v {
+			if p, ok := sub.(string); ok && k == "pattern" {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					return err
+				}
+				s.patterns[p] = re
+			} else if err := s.compile(sub); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, sub := range v {
+			if err := s.compile(sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Error is a place where a document does not match the schema.
+type Error struct {
+	Path    string // JSON Pointer to the value, e.g. "/profiles/ci/steps"
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.pointer(), e.Message)
+}
+
+// pointer returns the path, or "/" for the document itself.
+func (e Error) pointer() string {
+	if e.Path == "" {
+		return "/"
+	}
+	return e.Path
+}
+
+// Validate checks a YAML document, or the node at its root, against the
+// schema.
+func (s *Schema) Validate(doc *yaml.Node) []Error {
+	return s.validate(doc, true)
+}
+
+// ValidateFragment checks a document like Validate, but without requiring
+// the properties the schema requires at its root: it is for files whose
+// content is merged into another document.
+func (s *Schema) ValidateFragment(doc *yaml.Node) []Error {
+	return s.validate(doc, false)
+}
+
+func (s *Schema) validate(doc *yaml.Node, whole bool) []Error {
+	if doc.Kind == yaml.DocumentNode {
+		if len(doc.Content) == 0 {
+			return nil
+		}
+		doc = doc.Content[0]
+	}
+	schema := s.root
+	if !whole {
+		schema = make(map[string]any, len(s.root))
+		for k, v := range s.root {
+			if k != "required" {
+				schema[k] = v
+			}
+		}
+	}
+	return s.check(doc, schema, "")
+}
+
+// check validates n, at path, against schema.
+func (s *Schema) check(n *yaml.Node, schema map[string]any, path string) []Error {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		return s.check(n, s.resolve(ref), path)
+	}
+	fail := func(at *yaml.Node, format string, args ...any) []Error {
+		return []Error{{Path: path, Line: at.Line, Column: at.Column, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(n, t) }) {
+		return fail(n, "expected %s, got %s", strings.Join(types, " or "), nodeType(n))
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(v any) bool { return equal(n, v) }) {
+		var allowed []string
+		for _, v := range enum {
+			allowed = append(allowed, jsonString(v))
+		}
+		return fail(n, "%s is not one of %s", describe(n), strings.Join(allowed, ", "))
+	}
+	if c, ok := schema["const"]; ok && !equal(n, c) {
+		return fail(n, "%s must be %s", describe(n), jsonString(c))
+	}
+
+	var errs []Error
+	switch n.Kind {
+	case yaml.MappingNode:
+		errs = s.checkObject(n, schema, path)
+	case yaml.SequenceNode:
+		errs = s.checkArray(n, schema, path)
+	case yaml.ScalarNode:
+		if minimum, ok := schema["minimum"].(float64); ok {
+			if v, err := strconv.ParseFloat(n.Value, 64); err == nil && v < minimum {
+				errs = append(errs, fail(n, "%s is less than the minimum of %s", n.Value, jsonString(minimum))...)
+			}
+		}
+		if p, ok := schema["pattern"].(string); ok && hasType(n, "string") && !s.patterns[p].MatchString(n.Value) {
+			errs = append(errs, fail(n, "%s does not match the pattern %s", describe(n), jsonString(p))...)
+		}
+	}
+
+	for _, sub := range subschemas(schema["allOf"]) {
+		errs = append(errs, s.check(n, sub, path)...)
+	}
+	if anyOf := subschemas(schema["anyOf"]); len(anyOf) > 0 {
+		if matched, branchErrs := s.branches(n, anyOf, path); matched == 0 {
+			errs = append(errs, s.noMatch(n, anyOf, branchErrs, path)...)
+		}
+	}
+	if oneOf := subschemas(schema["oneOf"]); len(oneOf) > 0 {
+		matched, branchErrs := s.branches(n, oneOf, path)
+		switch {
+		case matched == 0:
+			errs = append(errs, s.noMatch(n, oneOf, branchErrs, path)...)
+		case matched > 1:
+			errs = append(errs, fail(n, "matches more than one of the allowed forms")...)
+		}
+	}
+	if not, ok := schema["not"].(map[string]any); ok && len(s.check(n, not, path)) == 0 {
+		if names := present(n, requiredNames(not)); len(names) > 0 {
+			key, _ := property(n, names[0])
+			errs = append(errs, fail(key, "property %q is not allowed here", names[0])...)
+		} else {
+			errs = append(errs, fail(n, "matches a form that is not allowed")...)
+		}
+	}
+	if cond, ok := schema["if"].(map[string]any); ok {
+		branch := "else"
+		if len(s.check(n, cond, path)) == 0 {
+			branch = "then"
+		}
+		if sub, ok := schema[branch].(map[string]any); ok {
+			errs = append(errs, s.check(n, sub, path)...)
+		}
+	}
+	return errs
+}
+
+func (s *Schema) checkObject(n *yaml.Node, schema map[string]any, path string) []Error {
+	var errs []Error
+	props, _ := schema["properties"].(map[string]any)
+	count := 0
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		if key.Value == "<<" {
+			continue // merge keys are not properties
+		}
+		count++
+		p := path + "/" + escape(key.Value)
+		if sub, ok := props[key.Value].(map[string]any); ok {
+			errs = append(errs, s.check(value, sub, p)...)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				errs = append(errs, Error{Path: p, Line: key.Line, Column: key.Column, Message: fmt.Sprintf("property %q is not allowed", key.Value)})
+			}
+		case map[string]any:
+			errs = append(errs, s.check(value, additional, p)...)
+		}
+	}
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, _ := r.(string); name != "" {
+				if _, ok := property(n, name); !ok {
+					errs = append(errs, Error{Path: path, Line: n.Line, Column: n.Column, Message: fmt.Sprintf("missing required property %q", name)})
+				}
+			}
+		}
+	}
+	if minimum, ok := schema["minProperties"].(float64); ok && float64(count) < minimum {
+		errs = append(errs, Error{Path: path, Line: n.Line, Column: n.Column, Message: fmt.Sprintf("must have at least %s properties", jsonString(minimum))})
+	}
+	return errs
+}
+
+func (s *Schema) checkArray(n *yaml.Node, schema map[string]any, path string) []Error {
+	var errs []Error
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range n.Content {
+			errs = append(errs, s.check(item, items, path+"/"+strconv.Itoa(i))...)
+		}
+	}
+	if minimum, ok := schema["minItems"].(float64); ok && float64(len(n.Content)) < minimum {
+		errs = append(errs, Error{Path: path, Line: n.Line, Column: n.Column, Message: fmt.Sprintf("must have at least %s items", jsonString(minimum))})
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i, item := range n.Content {
+			if item.Kind == yaml.ScalarNode && slices.ContainsFunc(n.Content[:i], func(o *yaml.Node) bool { return o.Kind == yaml.ScalarNode && o.Value == item.Value }) {
+				errs = append(errs, Error{Path: path + "/" + strconv.Itoa(i), Line: item.Line, Column: item.Column, Message: fmt.Sprintf("%s appears more than once", describe(item))})
+			}
+		}
+	}
+	return errs
+}
+
+// branches counts the subschemas n matches, returning the errors of each.
+func (s *Schema) branches(n *yaml.Node, subs []map[string]any, path string) (int, [][]Error) {
+	matched := 0
+	errs := make([][]Error, len(subs))
+	for i, sub := range subs {
+		errs[i] = s.check(n, sub, path)
+		if len(errs[i]) == 0 {
+			matched++
+		}
+	}
+	return matched, errs
+}
+
+// noMatch reports a value that matches none of the subschemas of an anyOf
+// or oneOf. If exactly one of them accepts the value's type, its errors are
+// the useful ones.
+func (s *Schema) noMatch(n *yaml.Node, subs []map[string]any, errs [][]Error, path string) []Error {
+	var typed []int
+	for i, sub := range subs {
+		if s.acceptsType(n, sub) {
+			typed = append(typed, i)
+		}
+	}
+	if len(typed) == 1 {
+		return errs[typed[0]]
+	}
+	var forms, required []string
+	for _, sub := range subs {
+		if names := requiredNames(sub); len(sub) == 1 && len(names) > 0 {
+			required = append(required, strings.Join(names, " and "))
+		}
+		forms = append(forms, s.describeSchema(sub))
+	}
+	msg := "expected " + strings.Join(forms, " or ")
+	if len(required) == len(subs) {
+		msg = "must set " + strings.Join(required, ", or ")
+	}
+	return []Error{{Path: path, Line: n.Line, Column: n.Column, Message: msg}}
+}
+
+// acceptsType reports whether schema allows the type of n, following $refs
+// and allOfs.
+func (s *Schema) acceptsType(n *yaml.Node, schema map[string]any) bool {
+	if ref, ok := schema["$ref"].(string); ok {
+		return s.acceptsType(n, s.resolve(ref))
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(n, t) }) {
+		return false
+	}
+	for _, sub := range subschemas(schema["allOf"]) {
+		if !s.acceptsType(n, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeSchema names the values a schema allows, for errors.
+func (s *Schema) describeSchema(schema map[string]any) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return s.describeSchema(s.resolve(ref))
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		return strings.Join(types, " or ")
+	}
+	return "another form"
+}
+
+// resolve follows a local $ref, such as "#/definitions/Step".
+func (s *Schema) resolve(ref string) map[string]any {
+	var v any = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		m, _ := v.(map[string]any)
+		v = m[unescape(part)]
+	}
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// requiredNames returns the properties a schema requires, directly or
+// through an anyOf, as in "not: {anyOf: [{required: [id]}]}".
+func requiredNames(schema map[string]any) []string {
+	var names []string
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, sub := range subschemas(schema["anyOf"]) {
+		names = append(names, requiredNames(sub)...)
+	}
+	return names
+}
+
+// present returns the names that are keys of the mapping n.
+func present(n *yaml.Node, names []string) []string {
+	var out []string
+	for _, name := range names {
+		if _, ok := property(n, name); ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// property returns the key node of name in the mapping n.
+func property(n *yaml.Node, name string) (*yaml.Node, bool) {
+	if n.Kind != yaml.MappingNode {
+		return nil, false
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == name {
+			return n.Content[i], true
+		}
+	}
+	return nil, false
+}
+
+func subschemas(v any) []map[string]any {
+	list, _ := v.([]any)
+	var out []map[string]any
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func schemaTypes(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, t := range v {
+			if t, ok := t.(string); ok {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// nodeType returns the JSON type of a YAML node.
+func nodeType(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch n.ShortTag() {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+// hasType reports whether n is of the JSON type t. Integers are numbers,
+// and so are floats with no fractional part integers.
+func hasType(n *yaml.Node, t string) bool {
+	got := nodeType(n)
+	switch {
+	case got == t:
+		return true
+	case t == "number":
+		return got == "integer"
+	case t == "integer" && got == "number":
+		v, err := strconv.ParseFloat(n.Value, 64)
+		return err == nil && v == math.Trunc(v)
+	}
+	return false
+}
+
+// equal reports whether the scalar n has the JSON value v.
+func equal(n *yaml.Node, v any) bool {
+	if n.Kind != yaml.ScalarNode {
+		return false
+	}
+	switch v := v.(type) {
+	case string:
+		return nodeType(n) == "string" && n.Value == v
+	case float64:
+		f, err := strconv.ParseFloat(n.Value, 64)
+		return hasType(n, "number") && err == nil && f == v
+	case bool:
+		var b bool
+		return nodeType(n) == "boolean" && n.Decode(&b) == nil && b == v
+	case nil:
+		return nodeType(n) == "null"
+	}
+	return false
+}
+
+// describe quotes a scalar for errors, or names the type of other nodes.
+func describe(n *yaml.Node) string {
+	switch nodeType(n) {
+	case "string":
+		return strconv.Quote(n.Value)
+	case "object", "array", "null":
+		return nodeType(n)
+	}
+	return n.Value
+}
+
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// escape and unescape encode a key as a JSON Pointer token.
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func unescape(token string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+}
@@ -0,0 +1,103 @@
+package jsonschema
+
+import (
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["name"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "pattern": "^[a-z]+$"},
+    "count": {"type": "integer", "minimum": 0},
+    "tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "uniqueItems": true},
+    "extends": {"oneOf": [{"type": "string"}, {"type": "array", "items": {"type": "string"}}]},
+    "steps": {"type": "object", "additionalProperties": {"$ref": "#/definitions/Step"}},
+    "hook": {"type": "object", "anyOf": [{"required": ["url"]}, {"required": ["cmd", "args"]}]}
+  },
+  "definitions": {
+    "Step": {
+      "type": "object",
+      "properties": {
+        "kind": {"enum": ["shell", "approval"]},
+        "command": {"type": "array"},
+        "id": {"type": "string"}
+      },
+      "not": {"anyOf": [{"required": ["id"]}]},
+      "if": {"properties": {"kind": {"const": "shell"}}},
+      "then": {"required": ["command"]}
+    }
+  }
+}`
+
+func parse(t *testing.T, doc string) *yaml.Node {
+	t.Helper()
+
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &n); err != nil {
+		t.Fatal(err)
+	}
+	return &n
+}
+
+// TestValidate verifies that every problem is reported at its line and
+// column.
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := s.Validate(parse(t, "name: demo\ncount: 3\ntags: [a, b]\nextends: [x]\nsteps:\n  a: {kind: approval}\n")); len(errs) > 0 {
+		t.Errorf("expected a valid document, got %v", errs)
+	}
+
+	doc := `count: -1
+tags: [a, a]
+extends: 3
+other: x
+hook: {cmd: x}
+steps:
+  lint:
+    kind: shel
+  test:
+    kind: shell
+  approve:
+    kind: approval
+    id: approve
+`
+	var got []string
+	for _, e := range s.Validate(parse(t, doc)) {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`line 1: /count: -1 is less than the minimum of 0`,
+		`line 2: /tags/1: "a" appears more than once`,
+		`line 3: /extends: expected string or array`,
+		`line 4: /other: property "other" is not allowed`,
+		`line 5: /hook: must set url, or cmd and args`,
+		`line 8: /steps/lint/kind: "shel" is not one of "shell", "approval"`,
+		`line 10: /steps/test: missing required property "command"`,
+		`line 13: /steps/approve: property "id" is not allowed here`,
+		`line 1: /: missing required property "name"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected errors\n%q\ngot\n%q", want, got)
+	}
+
+	errs := s.ValidateFragment(parse(t, "count: 1\n"))
+	if len(errs) > 0 {
+		t.Errorf("expected a fragment without name to be valid, got %v", errs)
+	}
+
+	errs = s.Validate(parse(t, "name: Demo\n"))
+	if len(errs) != 1 || errs[0].Line != 1 || errs[0].Column != 7 {
+		t.Errorf("expected a pattern error at 1:7, got %v", errs)
+	}
+}
@@ -0,0 +1,181 @@
+// Package lock provides an advisory lock on a Foundry output directory, so
+// concurrent anvil invocations in one checkout do not overwrite each other's
+// plans, results and logs.
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// FileName is the name of the lock file inside the locked directory.
+const FileName = ".lock"
+
+// retryInterval is how often Wait tries to take a held lock.
+const retryInterval = 250 * time.Millisecond
+
+// errHeld is returned by the platform lockFile when another process holds
+// the lock.
+var errHeld = errors.New("lock held")
+
+// Info describes the holder of a lock. It is stored in the lock file.
+type Info struct {
+	Hostname  string `json:"hostname"`
+	StartedAt string `json:"started_at"`
+	RunID     string `json:"run_id,omitempty"`
+	Command   string `json:"command,omitempty"`
+	PID       int    `json:"pid"`
+}
+
+// HeldError reports that a directory is locked by another process.
+type HeldError struct {
+	Path string
+	Info Info // zero if the holder's metadata could not be read
+}
+
+func (e *HeldError) Error() string {
+	if e.Info.PID == 0 {
+		return fmt.Sprintf("%s is locked by another anvil process", e.Path)
+	}
+	msg := fmt.Sprintf("%s is locked by pid %d on %s since %s", e.Path, e.Info.PID, e.Info.Hostname, e.Info.StartedAt)
+	if e.Info.RunID != "" {
+		msg += fmt.Sprintf(" (run %s)", e.Info.RunID)
+	}
+	return msg
+}
+
+// Lock is a held lock on a directory.
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Acquire takes the lock on dir without blocking, creating dir if needed.
+// If another process holds it, Acquire returns a *HeldError describing the
+// holder. A lock whose holder is a dead process on this host is stale: it is
+// broken and taken over.
+func Acquire(dir, runID string) (*Lock, error) {
+	if err := util.EnsureDir(dir); err != nil {
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+	path := filepath.Join(dir, FileName)
+
+	// Two attempts: the second follows breaking a stale lock.
+	for attempt := 0; ; attempt++ {
+		f, err := lockFile(path)
+		if err == nil {
+			l := &Lock{f: f, path: path}
+			if err := l.writeInfo(runID); err != nil {
+				_ = l.Release()
+				return nil, err
+			}
+			return l, nil
+		}
+		if !errors.Is(err, errHeld) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+
+		info, _ := readInfo(path)
+		if attempt == 0 && info.stale() {
+			slog.Warn("breaking stale lock", "path", path, "pid", info.PID, "host", info.Hostname)
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("lock: break stale lock: %w", err)
+			}
+			continue
+		}
+		return nil, &HeldError{Path: path, Info: info}
+	}
+}
+
+// Wait takes the lock on dir, blocking while another process holds it. It
+// calls onHeld with the first holder seen, if any, so callers can say what
+// they are waiting for.
+func Wait(ctx context.Context, dir, runID string, onHeld func(*HeldError)) (*Lock, error) {
+	notified := false
+	for {
+		l, err := Acquire(dir, runID)
+		var held *HeldError
+		if !errors.As(err, &held) {
+			return l, err
+		}
+		if !notified && onHeld != nil {
+			onHeld(held)
+			notified = true
+		}
+
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("lock: waiting for %s: %w", held.Path, ctx.Err())
+		}
+	}
+}
+
+// Release removes the lock file and releases the lock.
+func (l *Lock) Release() error {
+	// Remove before unlocking, so a waiter that already opened the old file
+	// notices it lost the race (see lockFile) instead of locking a file
+	// nobody else can see.
+	err := os.Remove(l.path)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("lock: release: %w", err)
+	}
+	return nil
+}
+
+func (l *Lock) writeInfo(runID string) error {
+	hostname, _ := os.Hostname()
+	data, err := json.Marshal(Info{
+		PID:       os.Getpid(),
+		Hostname:  hostname,
+		StartedAt: util.NowUTC(),
+		RunID:     runID,
+		Command:   strings.Join(os.Args, " "),
+	})
+	if err != nil {
+		return fmt.Errorf("lock: marshal info: %w", err)
+	}
+	if err := l.f.Truncate(0); err != nil {
+		return fmt.Errorf("lock: write info: %w", err)
+	}
+	if _, err := l.f.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("lock: write info: %w", err)
+	}
+	return nil
+}
+
+func readInfo(path string) (Info, error) {
+	var info Info
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// stale reports whether the holder is known to be gone: a process on this
+// host that no longer exists. Holders on other hosts (shared filesystems)
+// cannot be checked and are never considered stale.
+func (i Info) stale() bool {
+	if i.PID <= 0 {
+		return false
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname != i.Hostname {
+		return false
+	}
+	return !processAlive(i.PID)
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package lock
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile creates path exclusively. Without flock the file outlives a
+// crashed holder, which Acquire detects by PID and breaks.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errHeld
+	}
+	return f, err
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAcquire_Exclusive verifies a second Acquire fails with the holder's
+// metadata and succeeds once the lock is released.
+func TestAcquire_Exclusive(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "out")
+	first, err := Acquire(dir, "run-1")
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	_, err = Acquire(dir, "run-2")
+	var held *HeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("expected HeldError, got %v", err)
+	}
+	if held.Info.PID != os.Getpid() || held.Info.RunID != "run-1" {
+		t.Errorf("expected holder pid %d run-1, got %+v", os.Getpid(), held.Info)
+	}
+	if !strings.Contains(err.Error(), "(run run-1)") {
+		t.Errorf("expected error to name the holding run, got %q", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected lock file to be removed, got %v", err)
+	}
+
+	second, err := Acquire(dir, "run-2")
+	if err != nil {
+		t.Fatalf("expected Acquire after release to succeed, got %v", err)
+	}
+	_ = second.Release()
+}
+
+// TestWait verifies Wait blocks until the holder releases the lock.
+func TestWait(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first, err := Acquire(dir, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = first.Release()
+		close(released)
+	}()
+
+	var waitedOn *HeldError
+	l, err := Wait(context.Background(), dir, "run-2", func(h *HeldError) { waitedOn = h })
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	defer func() { _ = l.Release() }()
+
+	select {
+	case <-released:
+	default:
+		t.Error("expected Wait to return only after release")
+	}
+	if waitedOn == nil || waitedOn.Info.RunID != "run-1" {
+		t.Errorf("expected onHeld to report run-1, got %+v", waitedOn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Wait(ctx, dir, "run-3", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded while held, got %v", err)
+	}
+}
+
+// TestAcquire_BreaksStaleLock verifies a lock held on behalf of a dead
+// process on this host is taken over.
+func TestAcquire_BreaksStaleLock(t *testing.T) {
+	t.Parallel()
+
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	deadPID := cmd.Process.Pid
+
+	dir := t.TempDir()
+	orphan, err := Acquire(dir, "orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = orphan.f.Close() }()
+
+	// Pretend the lock is held through a descriptor inherited from a
+	// process that has since died.
+	hostname, _ := os.Hostname()
+	data, _ := json.Marshal(Info{PID: deadPID, Hostname: hostname, StartedAt: "2026-01-01T00:00:00Z"})
+	if err := os.WriteFile(filepath.Join(dir, FileName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Acquire(dir, "fresh")
+	if err != nil {
+		t.Fatalf("expected stale lock to be broken, got %v", err)
+	}
+	defer func() { _ = l.Release() }()
+
+	info, err := readInfo(filepath.Join(dir, FileName))
+	if err != nil || info.RunID != "fresh" || info.PID != os.Getpid() {
+		t.Errorf("expected lock to belong to the new holder, got %+v (err %v)", info, err)
+	}
+
+	// A holder on another host cannot be checked and is left alone.
+	data, _ = json.Marshal(Info{PID: deadPID, Hostname: "elsewhere.invalid"})
+	if err := os.WriteFile(filepath.Join(dir, FileName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var held *HeldError
+	if _, err := Acquire(dir, "other"); !errors.As(err, &held) {
+		t.Errorf("expected lock held from another host to be respected, got %v", err)
+	}
+}
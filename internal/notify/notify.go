@@ -0,0 +1,298 @@
+// Package notify sends webhook notifications when runs finish, fail or
+// recover.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Events a hook can subscribe to. A run that fails after failing before is
+// still "failed"; "recovered" is a success following a failure.
+const (
+	EventFinished  = "finished"
+	EventFailed    = "failed"
+	EventRecovered = "recovered"
+)
+
+// Events lists the valid events, most specific last.
+var Events = []string{EventFinished, EventFailed, EventRecovered}
+
+// DefaultEvents are the events of a hook that does not list any.
+var DefaultEvents = []string{EventFailed, EventRecovered}
+
+// Defaults of Hook.
+const (
+	DefaultRetries = 3
+	DefaultTimeout = 10 * time.Second
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the request body, as
+// "sha256=<hex>", when a hook has a secret.
+const SignatureHeader = "X-Anvil-Signature"
+
+// EventHeader names the event a request is for.
+const EventHeader = "X-Anvil-Event"
+
+// retryBackoff is the wait before the first retry; it doubles after each.
+var retryBackoff = time.Second
+
+// Hook is a webhook configured under notify:.
+type Hook struct {
+	URL     string            `yaml:"url" json:"url"`
+	On      []string          `yaml:"on,omitempty" json:"on,omitempty"`                 // events to notify; default failed and recovered
+	Body    string            `yaml:"body,omitempty" json:"body,omitempty"`             // text/template rendering the request body; default the JSON payload
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`       // extra request headers
+	Secret  string            `yaml:"secret_env,omitempty" json:"secret_env,omitempty"` // environment variable holding the HMAC key
+	Retries *int              `yaml:"retries,omitempty" json:"retries,omitempty"`       // retries after a failed delivery (default 3)
+	Timeout string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`       // per request (default 10s)
+}
+
+// Validate checks that the hook is well-formed.
+func (h Hook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an http or https URL", h.URL)
+	}
+	for _, e := range h.On {
+		if !slices.Contains(Events, e) {
+			return fmt.Errorf("on: unknown event %q (must be %s)", e, strings.Join(Events, ", "))
+		}
+	}
+	if h.Body != "" {
+		if _, err := parseBody(h.Body); err != nil {
+			return fmt.Errorf("body: %w", err)
+		}
+	}
+	if h.Retries != nil && *h.Retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", h.Timeout)
+		}
+	}
+	return nil
+}
+
+// event returns the event a hook is notified of for a run that raised
+// events, the most specific one it subscribes to, or "" if none.
+func (h Hook) event(raised []string) string {
+	on := h.On
+	if len(on) == 0 {
+		on = DefaultEvents
+	}
+	for _, e := range slices.Backward(Events) {
+		if slices.Contains(raised, e) && slices.Contains(on, e) {
+			return e
+		}
+	}
+	return ""
+}
+
+// Raised returns the events a run with status raises, given the status of
+// the profile's previous run ("" if none). Runs waiting for approval raise
+// none.
+func Raised(status, previous string) []string {
+	switch status {
+	case "pending":
+		return nil
+	case "success":
+		if previous == "failed" {
+			return []string{EventFinished, EventRecovered}
+		}
+		return []string{EventFinished}
+	}
+	return []string{EventFinished, EventFailed}
+}
+
+// Payload is the JSON body sent to hooks without a body template, and the
+// data of body templates.
+type Payload struct {
+	Event      string   `json:"event"`
+	Project    string   `json:"project"`
+	Profile    string   `json:"profile"`
+	RunID      string   `json:"run_id"`
+	Status     string   `json:"status"`
+	Previous   string   `json:"previous_status,omitempty"`
+	ConfigHash string   `json:"config_hash"`
+	StartedAt  string   `json:"started_at"`
+	FinishedAt string   `json:"finished_at"`
+	Duration   string   `json:"duration"`
+	Host       string   `json:"host,omitempty"`
+	RunDir     string   `json:"run_dir"`
+	Reports    []Report `json:"reports,omitempty"`
+	Steps      []Step   `json:"steps"`
+	Failed     []Step   `json:"failed_steps"`
+}
+
+// Report is a report written for the run.
+type Report struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+}
+
+// Step is the outcome of a step of the run.
+type Step struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// parseBody parses a body template. Besides the usual functions, "json"
+// encodes a value as JSON, for embedding strings in JSON bodies.
+func parseBody(body string) (*template.Template, error) {
+	return template.New("body").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join": strings.Join,
+	}).Option("missingkey=error").Parse(body)
+}
+
+// Delivery is the outcome of notifying a hook.
+type Delivery struct {
+	URL   string
+	Event string
+	Err   error
+}
+
+// Send notifies each hook subscribed to one of the raised events, returning
+// the outcome of each notification. getenv looks up hook secrets.
+func Send(ctx context.Context, hooks []Hook, raised []string, p Payload, getenv func(string) string) []Delivery {
+	var out []Delivery
+	for _, h := range hooks {
+		event := h.event(raised)
+		if event == "" {
+			continue
+		}
+		p.Event = event
+		out = append(out, Delivery{URL: h.URL, Event: event, Err: h.send(ctx, p, getenv)})
+	}
+	return out
+}
+
+func (h Hook) send(ctx context.Context, p Payload, getenv func(string) string) error {
+	body, err := h.render(p)
+	if err != nil {
+		return err
+	}
+	var key []byte
+	if h.Secret != "" {
+		if key = []byte(getenv(h.Secret)); len(key) == 0 {
+			return fmt.Errorf("secret_env %s is not set", h.Secret)
+		}
+	}
+
+	retries := DefaultRetries
+	if h.Retries != nil {
+		retries = *h.Retries
+	}
+	timeout := DefaultTimeout
+	if d, err := time.ParseDuration(h.Timeout); err == nil {
+		timeout = d
+	}
+	client := &http.Client{Timeout: timeout}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err = h.post(ctx, client, p.Event, body, key)
+		var rejected *rejectedError
+		if err == nil || errors.As(err, &rejected) || attempt == retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// render returns the request body for p.
+func (h Hook) render(p Payload) ([]byte, error) {
+	if h.Body == "" {
+		return json.Marshal(p)
+	}
+	t, err := parseBody(h.Body)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, p); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rejectedError is a response that retrying will not change.
+type rejectedError struct {
+	code int
+	body string
+}
+
+func (e *rejectedError) Error() string {
+	return responseMessage(e.code, e.body)
+}
+
+func responseMessage(code int, body string) string {
+	if body == "" {
+		return fmt.Sprintf("responded %d", code)
+	}
+	return fmt.Sprintf("responded %d: %s", code, body)
+}
+
+func (h Hook) post(ctx context.Context, client *http.Client, event string, body, key []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "anvil")
+	req.Header.Set(EventHeader, event)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	if key != nil {
+		req.Header.Set(SignatureHeader, Sign(key, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	text := strings.TrimSpace(string(msg))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return errors.New(responseMessage(resp.StatusCode, text))
+	}
+	return &rejectedError{code: resp.StatusCode, body: text}
+}
+
+// Sign returns the value of SignatureHeader for body signed with key.
+func Sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
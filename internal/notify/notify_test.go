@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint recording what it is sent. It fails the
+// first failures requests with status.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	bodies   []string
+	headers  []http.Header
+	tries    int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tries++
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "try later", r.status)
+		return
+	}
+	r.bodies = append(r.bodies, string(body))
+	r.headers = append(r.headers, req.Header.Clone())
+}
+
+func testPayload() Payload {
+	return Payload{
+		Project:  "demo",
+		Profile:  "ci",
+		RunID:    "r1",
+		Status:   "failed",
+		Duration: "12s",
+		RunDir:   ".foundry/runs/r1",
+		Reports:  []Report{{Format: "html", Path: "out/report.html"}},
+		Steps: []Step{
+			{ID: "build", Status: "success", Duration: "2s"},
+			{ID: "test", Status: "failed", Duration: "10s", ExitCode: 1, Error: "exit status 1"},
+		},
+		Failed: []Step{{ID: "test", Status: "failed", Duration: "10s", ExitCode: 1, Error: "exit status 1"}},
+	}
+}
+
+func TestRaised(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status, previous string
+		want             []string
+	}{
+		{"success", "", []string{EventFinished}},
+		{"success", "success", []string{EventFinished}},
+		{"success", "failed", []string{EventFinished, EventRecovered}},
+		{"failed", "failed", []string{EventFinished, EventFailed}},
+		{"pending", "failed", nil},
+	}
+	for _, tt := range tests {
+		if got := Raised(tt.status, tt.previous); !slices.Equal(got, tt.want) {
+			t.Errorf("Raised(%q, %q): expected %v, got %v", tt.status, tt.previous, tt.want, got)
+		}
+	}
+}
+
+// TestSend verifies event selection, the default payload, templated bodies,
+// signing and headers.
+func TestSend(t *testing.T) {
+	t.Parallel()
+
+	plain, slack, quiet := &receiver{}, &receiver{}, &receiver{}
+	servers := []*httptest.Server{httptest.NewServer(plain), httptest.NewServer(slack), httptest.NewServer(quiet)}
+	for _, s := range servers {
+		defer s.Close()
+	}
+
+	hooks := []Hook{
+		{URL: servers[0].URL, On: []string{EventFinished, EventFailed}, Secret: "HOOK_SECRET", Headers: map[string]string{"X-Team": "ci"}},
+		{URL: servers[1].URL, Body: `{"text": {{json (printf "%s/%s %s: %d failed" .Project .Profile .Status (len .Failed))}}}`},
+		{URL: servers[2].URL, On: []string{EventRecovered}},
+	}
+	env := map[string]string{"HOOK_SECRET": "s3cret"}
+	deliveries := Send(context.Background(), hooks, Raised("failed", "success"), testPayload(), func(k string) string { return env[k] })
+
+	if len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %+v", deliveries)
+	}
+	for _, d := range deliveries {
+		if d.Err != nil || d.Event != EventFailed {
+			t.Errorf("unexpected delivery %+v", d)
+		}
+	}
+	if len(quiet.bodies) != 0 {
+		t.Errorf("expected no notification for a hook on recovered only, got %v", quiet.bodies)
+	}
+
+	var got Payload
+	if err := json.Unmarshal([]byte(plain.bodies[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != EventFailed || got.RunID != "r1" || len(got.Failed) != 1 || got.Failed[0].ID != "test" || got.Reports[0].Path != "out/report.html" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+	h := plain.headers[0]
+	if want := Sign([]byte("s3cret"), []byte(plain.bodies[0])); h.Get(SignatureHeader) != want {
+		t.Errorf("expected signature %s, got %q", want, h.Get(SignatureHeader))
+	}
+	if h.Get(EventHeader) != EventFailed || h.Get("X-Team") != "ci" || h.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	if want := `{"text": "demo/ci failed: 1 failed"}`; slack.bodies[0] != want {
+		t.Errorf("expected templated body %s, got %s", want, slack.bodies[0])
+	}
+	if slack.headers[0].Get(SignatureHeader) != "" {
+		t.Error("expected no signature without a secret")
+	}
+}
+
+// TestSend_Retries verifies transient failures are retried and rejections
+// are not.
+func TestSend_Retries(t *testing.T) {
+	retryBackoff = time.Millisecond
+
+	flaky := &receiver{failures: 2, status: http.StatusServiceUnavailable}
+	rejecting := &receiver{failures: 10, status: http.StatusForbidden}
+	down := &receiver{failures: 10, status: http.StatusBadGateway}
+	servers := []*httptest.Server{httptest.NewServer(flaky), httptest.NewServer(rejecting), httptest.NewServer(down)}
+	for _, s := range servers {
+		defer s.Close()
+	}
+	one := 1
+	hooks := []Hook{
+		{URL: servers[0].URL},
+		{URL: servers[1].URL},
+		{URL: servers[2].URL, Retries: &one},
+		{URL: servers[0].URL, Secret: "MISSING"},
+	}
+
+	deliveries := Send(context.Background(), hooks, Raised("failed", ""), testPayload(), func(string) string { return "" })
+	if len(deliveries) != 4 {
+		t.Fatalf("expected 4 deliveries, got %+v", deliveries)
+	}
+	if err := deliveries[0].Err; err != nil || flaky.tries != 3 {
+		t.Errorf("expected delivery after 2 retries, got %v after %d tries", err, flaky.tries)
+	}
+	if err := deliveries[1].Err; err == nil || err.Error() != "responded 403: try later" || rejecting.tries != 1 {
+		t.Errorf("expected a single rejected try, got %v after %d tries", err, rejecting.tries)
+	}
+	if err := deliveries[2].Err; err == nil || !strings.Contains(err.Error(), "responded 502") || down.tries != 2 {
+		t.Errorf("expected failure after 1 retry, got %v after %d tries", err, down.tries)
+	}
+	if err := deliveries[3].Err; err == nil || err.Error() != "secret_env MISSING is not set" {
+		t.Errorf("expected a missing secret error, got %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// Run is a finished run to export.
+type Run struct {
+	Results  *exec.ExecutionResult
+	Plan     *plan.Plan
+	Meta     *runs.Meta
+	ExitCode int // anvil's exit code
+	Version  string
+}
+
+// Span kinds and status codes of the OTLP data model.
+const (
+	spanKindInternal = 1
+	statusOK         = 1
+	statusErr        = 2
+)
+
+// maxTries bounds the attempts to deliver each request.
+const maxTries = 3
+
+// retryBackoff is the wait before the first retry; it doubles after each.
+var retryBackoff = 500 * time.Millisecond
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue holds one of the OTLP attribute value types. Integers are
+// strings in the JSON encoding.
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func str(k, v string) keyValue {
+	return keyValue{Key: k, Value: anyValue{StringValue: &v}}
+}
+
+func integer(k string, v int64) keyValue {
+	s := strconv.FormatInt(v, 10)
+	return keyValue{Key: k, Value: anyValue{IntValue: &s}}
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            spanStatus `json:"status"`
+}
+
+type tracesRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type metricsRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type metric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Gauge       gauge  `json:"gauge"`
+}
+
+type gauge struct {
+	DataPoints []dataPoint `json:"dataPoints"`
+}
+
+type dataPoint struct {
+	Attributes   []keyValue `json:"attributes,omitempty"`
+	TimeUnixNano string     `json:"timeUnixNano"`
+	AsDouble     *float64   `json:"asDouble,omitempty"`
+	AsInt        *string    `json:"asInt,omitempty"`
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func parseTime(s string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
+
+// bounds returns the start and end of the run: its recorded times if known,
+// otherwise those of the steps that ran.
+func (r *Run) bounds() (time.Time, time.Time) {
+	var start, end time.Time
+	if m := r.Meta; m != nil {
+		start = m.Started()
+		end, _ = parseTime(m.FinishedAt)
+	}
+	for _, sr := range r.Results.Steps {
+		s, ok := parseTime(sr.Started)
+		if !ok {
+			continue
+		}
+		d, _ := time.ParseDuration(sr.Duration)
+		if start.IsZero() || s.Before(start) {
+			start = s
+		}
+		if e := s.Add(d); end.Before(e) {
+			end = e
+		}
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return start, end
+}
+
+func (r *Run) resource(cfg Config) resource {
+	attrs := []keyValue{str("service.name", cfg.ServiceName)}
+	if r.Version != "" {
+		attrs = append(attrs, str("service.version", r.Version))
+	}
+	if m := r.Meta; m != nil && m.Hostname != "" {
+		attrs = append(attrs, str("host.name", m.Hostname))
+	}
+	return resource{Attributes: attrs}
+}
+
+// runAttributes identify the run on its span and on every metric point.
+func (r *Run) runAttributes() []keyValue {
+	var project, profile, hash string
+	if p := r.Plan; p != nil {
+		project, profile, hash = p.ProjectName, p.Profile, p.ConfigHash
+	} else if m := r.Meta; m != nil {
+		project, profile, hash = m.Project, m.Profile, m.ConfigHash
+	}
+	return []keyValue{
+		str("anvil.project", project),
+		str("anvil.profile", profile),
+		str("anvil.config_hash", hash),
+	}
+}
+
+func status(s, msg string) spanStatus {
+	switch s {
+	case "success":
+		return spanStatus{Code: statusOK}
+	case "failed":
+		return spanStatus{Code: statusErr, Message: msg}
+	}
+	return spanStatus{}
+}
+
+// buildSpans builds the run's span tree: the run, a child for each step that
+// started, and a grandchild for each of its attempts.
+func (t *Trace) buildSpans(r *Run) []span {
+	res := r.Results
+	start, end := r.bounds()
+	root := span{
+		TraceID:           t.TraceID,
+		SpanID:            t.RootID,
+		ParentSpanID:      t.ParentID,
+		Name:              "anvil run",
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(end),
+		Attributes: append(r.runAttributes(),
+			str("anvil.run_id", res.RunID),
+			str("anvil.status", res.Status),
+			integer("anvil.exit_code", int64(r.ExitCode)),
+		),
+		Status: status(res.Status, ""),
+	}
+	if p := r.Plan; p != nil && p.Profile != "" {
+		root.Name = "anvil run " + p.Profile
+	}
+	spans := []span{root}
+
+	for _, sr := range res.Steps {
+		started, ok := parseTime(sr.Started)
+		if !ok {
+			continue
+		}
+		d, _ := time.ParseDuration(sr.Duration)
+		stepID := t.StepSpan(sr.ID)
+		attrs := []keyValue{
+			str("anvil.step.id", sr.ID),
+			str("anvil.step.status", sr.Status),
+			integer("anvil.step.exit_code", int64(sr.ExitCode)),
+			integer("anvil.step.attempts", int64(sr.Attempt)),
+		}
+		if sr.Slot > 0 {
+			attrs = append(attrs, integer("anvil.step.slot", int64(sr.Slot)))
+		}
+		if sr.Approval != nil {
+			attrs = append(attrs, str("anvil.step.approved_by", sr.Approval.By))
+		}
+		spans = append(spans, span{
+			TraceID:           t.TraceID,
+			SpanID:            stepID,
+			ParentSpanID:      t.RootID,
+			Name:              sr.ID,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(started),
+			EndTimeUnixNano:   unixNano(started.Add(d)),
+			Attributes:        attrs,
+			Status:            status(sr.Status, sr.Error),
+		})
+
+		attempts := sr.Attempts
+		if len(attempts) == 0 && sr.Slot > 0 {
+			// Services run once, for as long as the step.
+			attempts = []exec.AttemptResult{{Attempt: 1, Status: sr.Status, Started: sr.Started, Duration: sr.Duration, ExitCode: sr.ExitCode, Error: sr.Error}}
+		}
+		for _, a := range attempts {
+			as, ok := parseTime(a.Started)
+			if !ok {
+				continue
+			}
+			ad, _ := time.ParseDuration(a.Duration)
+			spans = append(spans, span{
+				TraceID:           t.TraceID,
+				SpanID:            t.AttemptSpan(sr.ID, a.Attempt),
+				ParentSpanID:      stepID,
+				Name:              fmt.Sprintf("%s attempt %d", sr.ID, a.Attempt),
+				Kind:              spanKindInternal,
+				StartTimeUnixNano: unixNano(as),
+				EndTimeUnixNano:   unixNano(as.Add(ad)),
+				Attributes: []keyValue{
+					str("anvil.step.id", sr.ID),
+					integer("anvil.attempt", int64(a.Attempt)),
+					integer("anvil.attempt.exit_code", int64(a.ExitCode)),
+				},
+				Status: status(a.Status, a.Error),
+			})
+		}
+	}
+	return spans
+}
+
+// metrics builds gauges of the run's duration and each step's duration and
+// attempts, recorded at the end of the run.
+func (r *Run) metrics() []metric {
+	start, end := r.bounds()
+	at := unixNano(end)
+	runAttrs := append(r.runAttributes(), str("anvil.status", r.Results.Status))
+	double := func(attrs []keyValue, v float64) dataPoint {
+		return dataPoint{Attributes: attrs, TimeUnixNano: at, AsDouble: &v}
+	}
+	count := func(attrs []keyValue, v int) dataPoint {
+		s := strconv.Itoa(v)
+		return dataPoint{Attributes: attrs, TimeUnixNano: at, AsInt: &s}
+	}
+
+	runDur := metric{Name: "anvil.run.duration", Description: "Wall time of the run.", Unit: "s"}
+	runDur.Gauge.DataPoints = []dataPoint{double(runAttrs, end.Sub(start).Seconds())}
+	stepDur := metric{Name: "anvil.step.duration", Description: "Wall time of each step, including retries.", Unit: "s"}
+	stepAttempts := metric{Name: "anvil.step.attempts", Description: "Attempts made by each step.", Unit: "{attempt}"}
+	for _, sr := range r.Results.Steps {
+		if _, ok := parseTime(sr.Started); !ok {
+			continue
+		}
+		d, _ := time.ParseDuration(sr.Duration)
+		attrs := append(r.runAttributes(), str("anvil.step.id", sr.ID), str("anvil.step.status", sr.Status))
+		stepDur.Gauge.DataPoints = append(stepDur.Gauge.DataPoints, double(attrs, d.Seconds()))
+		stepAttempts.Gauge.DataPoints = append(stepAttempts.Gauge.DataPoints, count(attrs, sr.Attempt))
+	}
+	metrics := []metric{runDur}
+	if len(stepDur.Gauge.DataPoints) > 0 {
+		metrics = append(metrics, stepDur, stepAttempts)
+	}
+	return metrics
+}
+
+// Export sends the run's spans, and its metrics if cfg has a metrics
+// endpoint, to the collector.
+func Export(ctx context.Context, cfg Config, t *Trace, r *Run) error {
+	sc := scope{Name: "anvil", Version: r.Version}
+	traces := tracesRequest{ResourceSpans: []resourceSpans{{
+		Resource:   r.resource(cfg),
+		ScopeSpans: []scopeSpans{{Scope: sc, Spans: t.buildSpans(r)}},
+	}}}
+	if err := post(ctx, cfg, cfg.TracesURL, traces); err != nil {
+		return fmt.Errorf("otlp: export traces: %w", err)
+	}
+	if cfg.MetricsURL == "" {
+		return nil
+	}
+	metrics := metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     r.resource(cfg),
+		ScopeMetrics: []scopeMetrics{{Scope: sc, Metrics: r.metrics()}},
+	}}}
+	if err := post(ctx, cfg, cfg.MetricsURL, metrics); err != nil {
+		return fmt.Errorf("otlp: export metrics: %w", err)
+	}
+	return nil
+}
+
+// post sends body as JSON to url, retrying network errors and the
+// responses the OTLP specification marks as retryable.
+func post(ctx context.Context, cfg Config, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	backoff := retryBackoff
+	for try := 1; ; try++ {
+		err = send(ctx, client, cfg, url, data)
+		if err == nil {
+			return nil
+		}
+		if se := (*responseError)(nil); errors.As(err, &se) && !se.retryable() {
+			return err
+		}
+		if try == maxTries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// responseError is an unsuccessful response from the collector.
+type responseError struct {
+	code int
+	body string
+}
+
+func (e *responseError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("collector responded %d", e.code)
+	}
+	return fmt.Sprintf("collector responded %d: %s", e.code, e.body)
+}
+
+func (e *responseError) retryable() bool {
+	switch e.code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func send(ctx context.Context, client *http.Client, cfg Config, url string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &responseError{code: resp.StatusCode, body: string(bytes.TrimSpace(msg))}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Package otlp exports runs to an OpenTelemetry collector over OTLP/HTTP,
+// using the protocol's JSON encoding: a trace with a span per run, step and
+// attempt, and a few run metrics. Trace context reaches steps through the
+// W3C TRACEPARENT environment variable.
+package otlp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultServiceName is the service.name of exported telemetry unless
+// OTEL_SERVICE_NAME is set.
+const DefaultServiceName = "anvil"
+
+// defaultTimeout bounds each export request.
+const defaultTimeout = 10 * time.Second
+
+// Config locates the collector.
+type Config struct {
+	TracesURL   string            // full URL spans are posted to
+	MetricsURL  string            // full URL metrics are posted to; empty disables metrics
+	Headers     map[string]string // sent with every request, e.g. authentication
+	ServiceName string
+	Timeout     time.Duration
+}
+
+// FromEnv reads the standard OTEL_EXPORTER_OTLP_* variables through getenv.
+// endpoint, if not empty, overrides OTEL_EXPORTER_OTLP_ENDPOINT. It reports
+// false if no endpoint is configured, meaning export is off.
+func FromEnv(getenv func(string) string, endpoint string) (Config, bool, error) {
+	cfg := Config{
+		ServiceName: getenv("OTEL_SERVICE_NAME"),
+		Timeout:     defaultTimeout,
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+
+	if endpoint == "" {
+		endpoint = getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint != "" {
+		base := strings.TrimRight(endpoint, "/")
+		cfg.TracesURL, cfg.MetricsURL = base+"/v1/traces", base+"/v1/metrics"
+	}
+	if u := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); u != "" {
+		cfg.TracesURL = u
+	}
+	if u := getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"); u != "" {
+		cfg.MetricsURL = u
+	}
+	if cfg.TracesURL == "" {
+		return cfg, false, nil
+	}
+	for _, u := range []string{cfg.TracesURL, cfg.MetricsURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return cfg, false, fmt.Errorf("otlp: invalid endpoint %q", u)
+		}
+	}
+
+	if h := getenv("OTEL_EXPORTER_OTLP_HEADERS"); h != "" {
+		headers, err := parseHeaders(h)
+		if err != nil {
+			return cfg, false, err
+		}
+		cfg.Headers = headers
+	}
+	if t := getenv("OTEL_EXPORTER_OTLP_TIMEOUT"); t != "" {
+		ms, err := strconv.Atoi(t)
+		if err != nil || ms <= 0 {
+			return cfg, false, fmt.Errorf("otlp: invalid OTEL_EXPORTER_OTLP_TIMEOUT %q", t)
+		}
+		cfg.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	return cfg, true, nil
+}
+
+// parseHeaders parses a W3C baggage-style list, "key1=value1,key2=value2",
+// with URL-encoded values.
+func parseHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("otlp: invalid header %q in OTEL_EXPORTER_OTLP_HEADERS", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("otlp: invalid header %q: %w", k, err)
+		}
+		headers[k] = value
+	}
+	return headers, nil
+}
+
+// Trace holds the identifiers of a run's trace. Span IDs are assigned up
+// front, so steps can be handed their trace context before their spans are
+// exported.
+type Trace struct {
+	TraceID  string // 32 hex digits
+	RootID   string // the run's span
+	ParentID string // span of the process that started anvil, if any
+
+	mu    sync.Mutex
+	spans map[string]string
+}
+
+// NewTrace starts a trace for a run. If traceparent is a valid W3C trace
+// context (as anvil's own TRACEPARENT), the run joins that trace as a child
+// of its span.
+func NewTrace(traceparent string) *Trace {
+	t := &Trace{RootID: randomHex(8), spans: map[string]string{}}
+	if traceID, parentID, ok := ParseTraceParent(traceparent); ok {
+		t.TraceID, t.ParentID = traceID, parentID
+	} else {
+		t.TraceID = randomHex(16)
+	}
+	return t
+}
+
+// StepSpan returns the span ID of a step.
+func (t *Trace) StepSpan(stepID string) string {
+	return t.span("step/" + stepID)
+}
+
+// AttemptSpan returns the span ID of an attempt of a step.
+func (t *Trace) AttemptSpan(stepID string, attempt int) string {
+	return t.span(fmt.Sprintf("attempt/%s/%d", stepID, attempt))
+}
+
+func (t *Trace) span(key string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, ok := t.spans[key]
+	if !ok {
+		id = randomHex(8)
+		t.spans[key] = id
+	}
+	return id
+}
+
+// TraceParent formats the W3C traceparent header value naming spanID as the
+// parent, e.g. "00-<trace-id>-<span-id>-01".
+func (t *Trace) TraceParent(spanID string) string {
+	return "00-" + t.TraceID + "-" + spanID + "-01"
+}
+
+// Env returns the TRACEPARENT entry for an attempt of a step, suitable for
+// exec.Options.AttemptEnv.
+func (t *Trace) Env(stepID string, attempt int) []string {
+	return []string{"TRACEPARENT=" + t.TraceParent(t.AttemptSpan(stepID, attempt))}
+}
+
+// ParseTraceParent extracts the trace and parent span IDs from a W3C
+// traceparent value.
+func ParseTraceParent(s string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", false
+	}
+	traceID, spanID = strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isHex(traceID, 32) || !isHex(spanID, 16) || strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,277 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// collector is a fake OTLP/HTTP collector recording the requests it gets.
+type collector struct {
+	mu       sync.Mutex
+	failures int // requests to answer with 503 before accepting
+	requests map[string][][]byte
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if c.requests == nil {
+		c.requests = map[string][][]byte{}
+	}
+	c.requests[r.URL.Path] = append(c.requests[r.URL.Path], body)
+	c.headers = append(c.headers, r.Header.Clone())
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+func testRun() *Run {
+	return &Run{
+		Plan: &plan.Plan{ProjectName: "demo", Profile: "ci", ConfigHash: "abc123"},
+		Meta: &runs.Meta{
+			RunID:      "r1",
+			StartedAt:  "2026-01-01T00:00:00.000Z",
+			FinishedAt: "2026-01-01T00:00:04.000Z",
+			Hostname:   "build-1",
+		},
+		ExitCode: 1,
+		Version:  "1.2.3",
+		Results: &exec.ExecutionResult{
+			RunID:  "r1",
+			Status: "failed",
+			Steps: []exec.StepResult{
+				{ID: "lint", Status: "success", Started: "2026-01-01T00:00:00Z", Duration: "1s", Attempt: 1, Slot: 1,
+					Attempts: []exec.AttemptResult{{Attempt: 1, Status: "success", Started: "2026-01-01T00:00:00Z", Duration: "1s"}}},
+				{ID: "test", Status: "failed", Started: "2026-01-01T00:00:01Z", Duration: "3s", Attempt: 2, Slot: 1, ExitCode: 1, Error: "exit status 1",
+					Attempts: []exec.AttemptResult{
+						{Attempt: 1, Status: "failed", Started: "2026-01-01T00:00:01Z", Duration: "1s", ExitCode: 1, Error: "exit status 1"},
+						{Attempt: 2, Status: "failed", Started: "2026-01-01T00:00:02Z", Duration: "2s", ExitCode: 1, Error: "exit status 1"},
+					}},
+				{ID: "deploy", Status: "skipped", Duration: "0s", Error: "dependency failed"},
+			},
+		},
+	}
+}
+
+func attr(attrs []keyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.Key != key {
+			continue
+		}
+		switch {
+		case kv.Value.StringValue != nil:
+			return *kv.Value.StringValue
+		case kv.Value.IntValue != nil:
+			return *kv.Value.IntValue
+		}
+	}
+	return ""
+}
+
+func TestExport(t *testing.T) {
+	c := &collector{failures: 1}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	retryBackoff = time.Millisecond
+
+	cfg, ok, err := FromEnv(func(k string) string {
+		return map[string]string{
+			"OTEL_EXPORTER_OTLP_HEADERS": "Authorization=Bearer%20xyz, X-Team=ci",
+			"OTEL_SERVICE_NAME":          "builds",
+		}[k]
+	}, srv.URL+"/")
+	if err != nil || !ok {
+		t.Fatalf("FromEnv() = %v, %v", ok, err)
+	}
+
+	const parent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	tr := NewTrace(parent)
+	// Steps are handed their attempt's span before the run is exported.
+	env := tr.Env("test", 2)
+	if err := Export(context.Background(), cfg, tr, testRun()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests["/v1/traces"]) != 1 || len(c.requests["/v1/metrics"]) != 1 {
+		t.Fatalf("requests = %v, want one to each of /v1/traces and /v1/metrics after a retry", c.requests)
+	}
+	if h := c.headers[0]; h.Get("Authorization") != "Bearer xyz" || h.Get("X-Team") != "ci" || h.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", h)
+	}
+
+	var traces tracesRequest
+	if err := json.Unmarshal(c.requests["/v1/traces"][0], &traces); err != nil {
+		t.Fatal(err)
+	}
+	rs := traces.ResourceSpans[0]
+	if got := attr(rs.Resource.Attributes, "service.name"); got != "builds" {
+		t.Errorf("service.name = %q, want builds", got)
+	}
+	spans := map[string]span{}
+	for _, s := range rs.ScopeSpans[0].Spans {
+		if s.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("span %q trace ID = %s, want the parent's", s.Name, s.TraceID)
+		}
+		spans[s.Name] = s
+	}
+	if len(spans) != 6 {
+		t.Fatalf("spans = %v, want the run, 2 steps and 3 attempts", spans)
+	}
+
+	root := spans["anvil run ci"]
+	if root.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("root parent = %q, want the TRACEPARENT span", root.ParentSpanID)
+	}
+	for key, want := range map[string]string{
+		"anvil.project":     "demo",
+		"anvil.profile":     "ci",
+		"anvil.config_hash": "abc123",
+		"anvil.exit_code":   "1",
+	} {
+		if got := attr(root.Attributes, key); got != want {
+			t.Errorf("root %s = %q, want %q", key, got, want)
+		}
+	}
+	if root.StartTimeUnixNano != "1767225600000000000" || root.EndTimeUnixNano != "1767225604000000000" {
+		t.Errorf("root times = %s..%s", root.StartTimeUnixNano, root.EndTimeUnixNano)
+	}
+	if root.Status.Code != statusErr {
+		t.Errorf("root status = %+v, want error", root.Status)
+	}
+
+	step := spans["test"]
+	if step.ParentSpanID != root.SpanID || step.Status.Message != "exit status 1" || attr(step.Attributes, "anvil.step.attempts") != "2" {
+		t.Errorf("step span = %+v", step)
+	}
+	attempt := spans["test attempt 2"]
+	if attempt.ParentSpanID != step.SpanID {
+		t.Errorf("attempt parent = %q, want step %q", attempt.ParentSpanID, step.SpanID)
+	}
+	if want := "TRACEPARENT=00-0af7651916cd43dd8448eb211c80319c-" + attempt.SpanID + "-01"; env[0] != want {
+		t.Errorf("Env() = %q, want %q", env[0], want)
+	}
+	if _, ok := spans["deploy"]; ok {
+		t.Error("skipped step exported as a span")
+	}
+
+	var metrics metricsRequest
+	if err := json.Unmarshal(c.requests["/v1/metrics"][0], &metrics); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names = append(names, m.Name)
+		if m.Name == "anvil.run.duration" && *m.Gauge.DataPoints[0].AsDouble != 4 {
+			t.Errorf("anvil.run.duration = %v, want 4", *m.Gauge.DataPoints[0].AsDouble)
+		}
+	}
+	if got := strings.Join(names, ","); got != "anvil.run.duration,anvil.step.duration,anvil.step.attempts" {
+		t.Errorf("metrics = %s", got)
+	}
+}
+
+func TestExport_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	cfg := Config{TracesURL: srv.URL + "/v1/traces", ServiceName: "anvil", Timeout: time.Second}
+	err := Export(context.Background(), cfg, NewTrace(""), testRun())
+	if err == nil || !strings.Contains(err.Error(), "collector responded 400: bad payload") {
+		t.Errorf("Export() error = %v, want the collector's rejection", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		flag      string
+		wantOK    bool
+		wantErr   bool
+		traces    string
+		metrics   string
+		timeoutMS int
+	}{
+		{name: "disabled", env: nil},
+		{name: "base endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, wantOK: true,
+			traces: "http://collector:4318/v1/traces", metrics: "http://collector:4318/v1/metrics", timeoutMS: 10000},
+		{name: "flag overrides", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, flag: "https://other", wantOK: true,
+			traces: "https://other/v1/traces", metrics: "https://other/v1/metrics", timeoutMS: 10000},
+		{name: "traces only", env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://c/traces", "OTEL_EXPORTER_OTLP_TIMEOUT": "2500"}, wantOK: true,
+			traces: "http://c/traces", timeoutMS: 2500},
+		{name: "bad scheme", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4318"}, wantErr: true},
+		{name: "bad header", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c", "OTEL_EXPORTER_OTLP_HEADERS": "novalue"}, wantErr: true},
+		{name: "bad timeout", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://c", "OTEL_EXPORTER_OTLP_TIMEOUT": "5s"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, ok, err := FromEnv(func(k string) string { return tt.env[k] }, tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ok != tt.wantOK || cfg.TracesURL != tt.traces || cfg.MetricsURL != tt.metrics {
+				t.Errorf("FromEnv() = %+v, %v", cfg, ok)
+			}
+			if ok && cfg.Timeout != time.Duration(tt.timeoutMS)*time.Millisecond {
+				t.Errorf("Timeout = %v, want %dms", cfg.Timeout, tt.timeoutMS)
+			}
+		})
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		in     string
+		wantOK bool
+	}{
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true},
+		{"00-0AF7651916CD43DD8448EB211C80319C-B7AD6B7169203331-00", true},
+		{"", false},
+		{"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false},
+		{"00-00000000000000000000000000000000-b7ad6b7169203331-01", false},
+		{"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false},
+		{"00-0af7651916cd43dd-b7ad6b7169203331-01", false},
+		{"00-0af7651916cd43dd8448eb211c80319z-b7ad6b7169203331-01", false},
+	}
+	for _, tt := range tests {
+		traceID, spanID, ok := ParseTraceParent(tt.in)
+		if ok != tt.wantOK {
+			t.Errorf("ParseTraceParent(%q) ok = %v, want %v", tt.in, ok, tt.wantOK)
+		}
+		if ok && (traceID != "0af7651916cd43dd8448eb211c80319c" || spanID != "b7ad6b7169203331") {
+			t.Errorf("ParseTraceParent(%q) = %s, %s", tt.in, traceID, spanID)
+		}
+	}
+
+	tr := NewTrace("garbage")
+	if len(tr.TraceID) != 32 || tr.ParentID != "" || len(tr.RootID) != 16 {
+		t.Errorf("NewTrace(invalid) = %+v, want a new trace", tr)
+	}
+	if tr.StepSpan("a") != tr.StepSpan("a") || tr.StepSpan("a") == tr.AttemptSpan("a", 1) {
+		t.Error("span IDs are not stable per step and attempt")
+	}
+}
@@ -0,0 +1,90 @@
+package plan
+
+import (
+	"fmt"
+
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// SkipNoChanges is the skip reason for steps whose path filters matched none
+// of the changed files.
+const SkipNoChanges = "no relevant changes"
+
+// Changes records the change set a plan was filtered against.
+type Changes struct {
+	Since string   `json:"since"`
+	Files []string `json:"files"`
+}
+
+// SkipUnchanged marks steps that are irrelevant to the changed files with
+// SkipNoChanges and records the change set on the plan.
+//
+// A step with paths or paths_ignore filters is relevant when at least one
+// changed file passes its filters. A step without filters is relevant when it
+// has no deps or when at least one of its deps is relevant, so skips
+// propagate to unfiltered downstream steps while a filtered step still runs
+// on its own matches even if everything upstream was skipped.
+func SkipUnchanged(p *Plan, since string, changed []string) error {
+	if p == nil {
+		return fmt.Errorf("skip unchanged: plan is nil")
+	}
+
+	index := make(map[string]int, len(p.Steps))
+	for i, step := range p.Steps {
+		index[step.ID] = i
+	}
+
+	relevant := make(map[string]bool, len(p.Steps))
+	for _, id := range p.Order {
+		i, ok := index[id]
+		if !ok {
+			return fmt.Errorf("skip unchanged: step %q in order but not in steps", id)
+		}
+		step := &p.Steps[i]
+
+		switch {
+		case len(step.Paths) > 0 || len(step.PathsIgnore) > 0:
+			relevant[id] = matchesChanges(*step, changed)
+		case len(step.Deps) == 0:
+			relevant[id] = true
+		default:
+			for _, dep := range step.Deps {
+				if relevant[dep] {
+					relevant[id] = true
+					break
+				}
+			}
+		}
+
+		if !relevant[id] && step.Skip == "" {
+			step.Skip = SkipNoChanges
+		}
+	}
+
+	p.Changes = &Changes{Since: since, Files: changed}
+	return nil
+}
+
+// matchesChanges reports whether any changed file matches the step's paths
+// (all files when paths is empty) and none of its paths_ignore.
+func matchesChanges(step Step, changed []string) bool {
+	for _, file := range changed {
+		if len(step.Paths) > 0 && !matchAny(step.Paths, file) {
+			continue
+		}
+		if matchAny(step.PathsIgnore, file) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if util.MatchPath(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
@@ -16,13 +16,15 @@ import (
 
 // Plan represents an execution plan for a Foundry profile.
 type Plan struct {
-	ProjectName string   `json:"project_name"`
-	Profile     string   `json:"profile"`
-	ConfigHash  string   `json:"config_hash"`
-	CreatedAt   string   `json:"created_at"`
-	Steps       []Step   `json:"steps"`
-	Order       []string `json:"order"`
-	Version     int      `json:"version"`
+	ProjectName string    `json:"project_name"`
+	Profile     string    `json:"profile"`
+	ConfigHash  string    `json:"config_hash"`
+	CreatedAt   string    `json:"created_at"`
+	Steps       []Step    `json:"steps"`
+	Order       []string  `json:"order"`
+	Version     int       `json:"version"`
+	Selector    *Selector `json:"selector,omitempty"`
+	Changes     *Changes  `json:"changes,omitempty"`
 }
 
 // Step represents a step within an execution plan.
@@ -34,6 +36,27 @@ type Step struct {
 	Command []string          `json:"command,omitempty"`
 	Deps    []string          `json:"deps,omitempty"`
 	Retries int               `json:"retries,omitempty"`
+	Ready   *Probe            `json:"ready,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Inputs  []string          `json:"inputs,omitempty"`
+	Reports map[string]string `json:"reports,omitempty"`
+
+	Paths       []string `json:"paths,omitempty"`
+	PathsIgnore []string `json:"paths_ignore,omitempty"`
+	Skip        string   `json:"skip,omitempty"` // reason the step will not run, e.g. SkipNoChanges
+}
+
+// SkipDisabled is the skip reason for steps disabled in the config.
+const SkipDisabled = "disabled"
+
+// Probe is the readiness check for a service step.
+type Probe struct {
+	TCP      string   `json:"tcp,omitempty"`
+	HTTP     string   `json:"http,omitempty"`
+	Log      string   `json:"log,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
+	Interval string   `json:"interval,omitempty"`
+	Command  []string `json:"command,omitempty"`
 }
 
 // Build creates an execution plan from resolved configuration steps.
@@ -56,6 +79,25 @@ func Build(projectName, profileName string, steps []config.Step, configData []by
 			Env:     s.Env,
 			Timeout: s.Timeout,
 			Retries: s.Retries,
+			Tags:    s.Tags,
+			Inputs:  s.Inputs,
+			Reports: s.Reports,
+
+			Paths:       s.Paths,
+			PathsIgnore: s.PathsIgnore,
+		}
+		if s.Disabled {
+			planSteps[i].Skip = SkipDisabled
+		}
+		if s.Ready != nil {
+			planSteps[i].Ready = &Probe{
+				TCP:      s.Ready.TCP,
+				HTTP:     s.Ready.HTTP,
+				Log:      s.Ready.Log,
+				Timeout:  s.Ready.Timeout,
+				Interval: s.Ready.Interval,
+				Command:  s.Ready.Command,
+			}
 		}
 	}
 
@@ -2,6 +2,7 @@ package plan
 
 import (
 	"encoding/json"
+	"slices"
 	"strings"
 	"testing"
 
@@ -225,3 +226,144 @@ func TestBuild_Determinism(t *testing.T) {
 		t.Errorf("Plan snapshots differ:\n%s\nvs\n%s", string(b1), string(b2))
 	}
 }
+
+// selectFixture returns a plan for lint -> build -> test -> package, with docs
+// independent of the chain.
+func selectFixture(t *testing.T) *Plan {
+	t.Helper()
+
+	steps := []config.Step{
+		{ID: "lint", Type: "shell", Command: []string{"true"}, Tags: []string{"check"}},
+		{ID: "build", Type: "shell", Command: []string{"true"}, Deps: []string{"lint"}},
+		{ID: "test", Type: "shell", Command: []string{"true"}, Deps: []string{"build"}, Tags: []string{"check"}},
+		{ID: "package", Type: "shell", Command: []string{"true"}, Deps: []string{"test"}},
+		{ID: "docs", Type: "shell", Command: []string{"true"}},
+	}
+
+	p, err := Build("test-project", "default", steps, []byte("config"))
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	return p
+}
+
+// TestSelect verifies dependency closure for each selector and that pruned deps are dropped.
+func TestSelect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		sel  Selector
+		want []string
+	}{
+		{name: "only pulls deps", sel: Selector{Only: []string{"test"}}, want: []string{"lint", "build", "test"}},
+		{name: "only no-deps", sel: Selector{Only: []string{"test"}, NoDeps: true}, want: []string{"test"}},
+		{name: "from", sel: Selector{From: []string{"build"}}, want: []string{"build", "test", "package"}},
+		{name: "until", sel: Selector{Until: []string{"build"}}, want: []string{"lint", "build"}},
+		{name: "from until range", sel: Selector{From: []string{"build"}, Until: []string{"test"}}, want: []string{"build", "test"}},
+		{name: "skip", sel: Selector{Skip: []string{"lint"}}, want: []string{"build", "docs", "test", "package"}},
+		{name: "glob", sel: Selector{Only: []string{"d*"}}, want: []string{"docs"}},
+		{name: "tag", sel: Selector{Only: []string{"tag:check"}, NoDeps: true}, want: []string{"lint", "test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Select(selectFixture(t), tt.sel)
+			if err != nil {
+				t.Fatalf("Select failed: %v", err)
+			}
+
+			if strings.Join(p.Order, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected order %v, got %v", tt.want, p.Order)
+			}
+
+			if p.Selector == nil {
+				t.Error("expected selector to be recorded on the plan")
+			}
+
+			// No remaining step may depend on a pruned step.
+			kept := map[string]bool{}
+			for _, s := range p.Steps {
+				kept[s.ID] = true
+			}
+			for _, s := range p.Steps {
+				for _, dep := range s.Deps {
+					if !kept[dep] {
+						t.Errorf("step %q still depends on pruned step %q", s.ID, dep)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSelect_NoMatch verifies that a pattern matching no step is rejected.
+func TestSelect_NoMatch(t *testing.T) {
+	t.Parallel()
+
+	_, err := Select(selectFixture(t), Selector{Only: []string{"tset"}})
+	if err == nil {
+		t.Fatal("expected error for unmatched pattern, got nil")
+	}
+
+	if err.Error() != `select: --only: pattern "tset" matches no step` {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+// TestSkipUnchanged verifies path filtering and how skips propagate downstream.
+func TestSkipUnchanged(t *testing.T) {
+	t.Parallel()
+
+	steps := []config.Step{
+		{ID: "lint", Type: "shell", Command: []string{"true"}, Paths: []string{"**/*.go"}},
+		{ID: "test", Type: "shell", Command: []string{"true"}, Deps: []string{"lint"}},
+		{ID: "docs", Type: "shell", Command: []string{"true"}, Paths: []string{"docs/"}, PathsIgnore: []string{"docs/drafts/**"}},
+		{ID: "site", Type: "shell", Command: []string{"true"}, Deps: []string{"lint"}, Paths: []string{"site/**"}},
+		{ID: "always", Type: "shell", Command: []string{"true"}},
+	}
+
+	tests := []struct {
+		name    string
+		changed []string
+		skipped []string
+	}{
+		{name: "go change", changed: []string{"internal/a.go"}, skipped: []string{"docs", "site"}},
+		{name: "draft only", changed: []string{"docs/drafts/x.md"}, skipped: []string{"docs", "lint", "site", "test"}},
+		{name: "site only", changed: []string{"site/index.html"}, skipped: []string{"docs", "lint", "test"}},
+		{name: "nothing", changed: nil, skipped: []string{"docs", "lint", "site", "test"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := Build("test-project", "default", steps, []byte("config"))
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+
+			if err := SkipUnchanged(p, "main", tt.changed); err != nil {
+				t.Fatalf("SkipUnchanged failed: %v", err)
+			}
+
+			var skipped []string
+			for _, s := range p.Steps {
+				if s.Skip == SkipNoChanges {
+					skipped = append(skipped, s.ID)
+				}
+			}
+			slices.Sort(skipped)
+
+			if !slices.Equal(skipped, tt.skipped) {
+				t.Errorf("expected skipped %v, got %v", tt.skipped, skipped)
+			}
+
+			if p.Changes == nil || p.Changes.Since != "main" {
+				t.Errorf("expected change set to be recorded, got %+v", p.Changes)
+			}
+		})
+	}
+}
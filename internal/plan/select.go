@@ -0,0 +1,176 @@
+package plan
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Selector narrows a plan to a subset of its steps. Each pattern is a step ID,
+// a glob over step IDs (e.g. "test-*"), or "tag:<glob>" to match step tags.
+type Selector struct {
+	Only   []string `json:"only,omitempty"`    // matched steps plus their transitive deps
+	From   []string `json:"from,omitempty"`    // matched steps plus everything downstream
+	Until  []string `json:"until,omitempty"`   // matched steps plus everything upstream
+	Skip   []string `json:"skip,omitempty"`    // steps removed after the other selectors
+	NoDeps bool     `json:"no_deps,omitempty"` // with Only: do not pull in deps
+}
+
+// IsZero reports whether the selector selects the whole plan.
+func (s Selector) IsZero() bool {
+	return len(s.Only) == 0 && len(s.From) == 0 && len(s.Until) == 0 && len(s.Skip) == 0
+}
+
+// Select returns a copy of p pruned to the steps chosen by sel. Only, From
+// and Until are intersected when combined; Skip is applied last. Deps on
+// steps that were pruned away are dropped, so the remaining steps run without
+// them. The selector is recorded on the returned plan.
+func Select(p *Plan, sel Selector) (*Plan, error) {
+	if p == nil {
+		return nil, fmt.Errorf("select: plan is nil")
+	}
+	if sel.IsZero() {
+		return p, nil
+	}
+
+	dependents := make(map[string][]string, len(p.Steps))
+	deps := make(map[string][]string, len(p.Steps))
+	for _, step := range p.Steps {
+		deps[step.ID] = step.Deps
+		for _, dep := range step.Deps {
+			dependents[dep] = append(dependents[dep], step.ID)
+		}
+	}
+
+	selected := make(map[string]bool, len(p.Steps))
+	for _, step := range p.Steps {
+		selected[step.ID] = true
+	}
+
+	narrow := func(patterns []string, edges map[string][]string) error {
+		if len(patterns) == 0 {
+			return nil
+		}
+		roots, err := matchSteps(p.Steps, patterns)
+		if err != nil {
+			return err
+		}
+		keep := closure(roots, edges)
+		for id := range selected {
+			if !keep[id] {
+				delete(selected, id)
+			}
+		}
+		return nil
+	}
+
+	onlyEdges := deps
+	if sel.NoDeps {
+		onlyEdges = nil
+	}
+	if err := narrow(sel.Only, onlyEdges); err != nil {
+		return nil, fmt.Errorf("select: --only: %w", err)
+	}
+	if err := narrow(sel.From, dependents); err != nil {
+		return nil, fmt.Errorf("select: --from: %w", err)
+	}
+	if err := narrow(sel.Until, deps); err != nil {
+		return nil, fmt.Errorf("select: --until: %w", err)
+	}
+
+	if len(sel.Skip) > 0 {
+		skipped, err := matchSteps(p.Steps, sel.Skip)
+		if err != nil {
+			return nil, fmt.Errorf("select: --skip: %w", err)
+		}
+		for _, id := range skipped {
+			delete(selected, id)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("select: no steps left after applying selector")
+	}
+
+	var steps []Step
+	for _, step := range p.Steps {
+		if !selected[step.ID] {
+			continue
+		}
+		pruned := step
+		pruned.Deps = nil
+		for _, dep := range step.Deps {
+			if selected[dep] {
+				pruned.Deps = append(pruned.Deps, dep)
+			}
+		}
+		steps = append(steps, pruned)
+	}
+
+	order, err := TopologicalSort(steps)
+	if err != nil {
+		return nil, fmt.Errorf("select: %w", err)
+	}
+
+	out := *p
+	out.Steps = steps
+	out.Order = order
+	out.Selector = &sel
+	return &out, nil
+}
+
+// matchSteps returns the IDs of steps matched by any pattern. A pattern that
+// matches nothing is an error, since it is almost always a typo.
+func matchSteps(steps []Step, patterns []string) ([]string, error) {
+	var ids []string
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "tag:"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		found := false
+		for _, step := range steps {
+			if matchStep(step, pattern) {
+				found = true
+				if !slices.Contains(ids, step.ID) {
+					ids = append(ids, step.ID)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("pattern %q matches no step", pattern)
+		}
+	}
+	return ids, nil
+}
+
+func matchStep(step Step, pattern string) bool {
+	if tag, ok := strings.CutPrefix(pattern, "tag:"); ok {
+		for _, t := range step.Tags {
+			if matched, _ := path.Match(tag, t); matched {
+				return true
+			}
+		}
+		return false
+	}
+	matched, _ := path.Match(pattern, step.ID)
+	return matched
+}
+
+// closure returns roots together with every step reachable from them along
+// edges.
+func closure(roots []string, edges map[string][]string) map[string]bool {
+	seen := make(map[string]bool, len(roots))
+	stack := slices.Clone(roots)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, edges[id]...)
+	}
+	return seen
+}
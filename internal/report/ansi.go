@@ -0,0 +1,190 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// escapeSeq matches terminal escape sequences: CSI sequences (capturing
+// their parameters and final byte) and OSC sequences such as hyperlinks and
+// window titles.
+var escapeSeq = regexp.MustCompile(`\x1b\[([0-9;?]*)[ -/]*([@-~])|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// sgr is the text style set by SGR ("select graphic rendition") sequences.
+// Colours are CSS class suffixes for the 16 standard colours or "#rrggbb".
+type sgr struct {
+	fg, bg                       string
+	bold, dim, italic, underline bool
+}
+
+// open returns the span opening tag for the style, or "" for plain text.
+func (s sgr) open() string {
+	var classes, styles []string
+	if s.fg != "" {
+		if strings.HasPrefix(s.fg, "#") {
+			styles = append(styles, "color:"+s.fg)
+		} else {
+			classes = append(classes, "fg"+s.fg)
+		}
+	}
+	if s.bg != "" {
+		if strings.HasPrefix(s.bg, "#") {
+			styles = append(styles, "background:"+s.bg)
+		} else {
+			classes = append(classes, "bg"+s.bg)
+		}
+	}
+	for _, f := range []struct {
+		on    bool
+		class string
+	}{{s.bold, "b"}, {s.dim, "d"}, {s.italic, "i"}, {s.underline, "u"}} {
+		if f.on {
+			classes = append(classes, f.class)
+		}
+	}
+	if len(classes) == 0 && len(styles) == 0 {
+		return ""
+	}
+	tag := "<span"
+	if len(classes) > 0 {
+		tag += ` class="` + strings.Join(classes, " ") + `"`
+	}
+	if len(styles) > 0 {
+		tag += ` style="` + strings.Join(styles, ";") + `"`
+	}
+	return tag + ">"
+}
+
+// apply updates the style with the parameters of an SGR sequence.
+func (s *sgr) apply(params string) {
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		n, err := strconv.Atoi(codes[i])
+		if err != nil {
+			n = 0 // an empty parameter means 0
+		}
+		switch {
+		case n == 0:
+			*s = sgr{}
+		case n == 1:
+			s.bold = true
+		case n == 2:
+			s.dim = true
+		case n == 3:
+			s.italic = true
+		case n == 4:
+			s.underline = true
+		case n == 22:
+			s.bold, s.dim = false, false
+		case n == 23:
+			s.italic = false
+		case n == 24:
+			s.underline = false
+		case n >= 30 && n <= 37:
+			s.fg = strconv.Itoa(n - 30)
+		case n >= 90 && n <= 97:
+			s.fg = strconv.Itoa(n - 90 + 8)
+		case n == 39:
+			s.fg = ""
+		case n >= 40 && n <= 47:
+			s.bg = strconv.Itoa(n - 40)
+		case n >= 100 && n <= 107:
+			s.bg = strconv.Itoa(n - 100 + 8)
+		case n == 49:
+			s.bg = ""
+		case n == 38 || n == 48:
+			c, used := extendedColor(codes[i+1:])
+			i += used
+			if n == 38 {
+				s.fg = c
+			} else {
+				s.bg = c
+			}
+		}
+	}
+}
+
+// extendedColor decodes the arguments of a 256-colour ("5;n") or truecolor
+// ("2;r;g;b") SGR sequence, returning the colour and the arguments used.
+func extendedColor(args []string) (string, int) {
+	num := func(i int) int {
+		if i >= len(args) {
+			return 0
+		}
+		n, _ := strconv.Atoi(args[i])
+		return min(max(n, 0), 255)
+	}
+	if len(args) == 0 {
+		return "", 0
+	}
+	switch args[0] {
+	case "5":
+		n := num(1)
+		if n < 16 {
+			return strconv.Itoa(n), 2
+		}
+		return palette256(n), 2
+	case "2":
+		return fmt.Sprintf("#%02x%02x%02x", num(1), num(2), num(3)), 4
+	}
+	return "", len(args)
+}
+
+// palette256 returns the colour of an entry of the xterm 256-colour palette
+// beyond the 16 standard colours.
+func palette256(n int) string {
+	if n >= 232 {
+		v := 8 + 10*(n-232)
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+	levels := []int{0, 95, 135, 175, 215, 255}
+	n -= 16
+	return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+}
+
+// ansiHTML converts terminal output to HTML, turning colours and text
+// attributes into styled spans and dropping other escape sequences. A line
+// rewritten with carriage returns (as by progress bars) keeps its last
+// version.
+func ansiHTML(s string) template.HTML {
+	var b strings.Builder
+	var style sgr
+	open := ""
+
+	for _, line := range strings.SplitAfter(s, "\n") {
+		body := strings.TrimRight(line, "\r\n")
+		if i := strings.LastIndexByte(body, '\r'); i >= 0 {
+			body = body[i+1:]
+		}
+		rest := body
+		for rest != "" {
+			loc := escapeSeq.FindStringSubmatchIndex(rest)
+			if loc == nil {
+				b.WriteString(html.EscapeString(rest))
+				break
+			}
+			b.WriteString(html.EscapeString(rest[:loc[0]]))
+			if loc[4] >= 0 && rest[loc[4]:loc[5]] == "m" {
+				style.apply(rest[loc[2]:loc[3]])
+				if open != "" {
+					b.WriteString("</span>")
+				}
+				open = style.open()
+				b.WriteString(open)
+			}
+			rest = rest[loc[1]:]
+		}
+		if strings.HasSuffix(line, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	if open != "" {
+		b.WriteString("</span>")
+	}
+	// Text is escaped above; the only markup added is the style spans.
+	return template.HTML(b.String())
+}
@@ -0,0 +1,400 @@
+package report
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/testresults"
+)
+
+//go:embed html.tmpl
+var htmlSource string
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ansi": ansiHTML,
+}).Parse(htmlSource))
+
+// maxHTMLLog bounds how much of each log file the HTML report embeds; longer
+// logs keep their tail.
+const maxHTMLLog = 256 << 10
+
+// DAG and timeline geometry, in pixels.
+const (
+	nodeWidth  = 160
+	nodeHeight = 32
+	nodeGapX   = 56
+	nodeGapY   = 14
+	dagPadding = 8
+	nodeLabel  = 20 // longest step ID shown in full in a node
+)
+
+type htmlPage struct {
+	Title    string
+	Status   string
+	Total    int
+	Failed   int
+	Skipped  int
+	Run      []htmlField
+	Plan     []htmlField
+	DAG      *htmlDAG
+	Timeline *htmlTimeline
+	Steps    []htmlStep
+}
+
+type htmlField struct {
+	Name, Value string
+}
+
+type htmlDAG struct {
+	Width, Height         int
+	NodeWidth, NodeHeight int
+	Nodes                 []htmlNode
+	Edges                 []string // SVG path data
+}
+
+type htmlNode struct {
+	ID, Label, Status string
+	X, Y              int
+}
+
+type htmlTimeline struct {
+	Ticks []htmlTick
+	Rows  []htmlBar
+}
+
+type htmlTick struct {
+	Left  float64 // percent
+	Label string
+}
+
+type htmlBar struct {
+	ID, Status, Label string
+	Left, Width       float64 // percent; Width is 0 for steps that never ran
+}
+
+type htmlStep struct {
+	exec.StepResult
+	Open     bool
+	Command  string
+	Deps     []string
+	Env      []htmlField
+	Approval string
+	Tests    string
+	Failures []testresults.Case
+	Attempts []htmlAttempt
+}
+
+type htmlAttempt struct {
+	N         int
+	Status    string
+	Log       string
+	Truncated bool
+	Open      bool
+}
+
+// HTML writes run as a single self-contained HTML page, for attaching to CI
+// jobs as an artifact: run and plan metadata, the step graph coloured by
+// status, a timeline of when steps ran, and every attempt's log with
+// colours preserved and secrets masked. It needs no scripts or external
+// resources.
+func HTML(w io.Writer, run *Run, opts Options) error {
+	c := countSteps(run.Results.Steps)
+	page := htmlPage{
+		Title:    run.name(),
+		Status:   run.Results.Status,
+		Total:    c.total,
+		Failed:   c.failed,
+		Skipped:  c.skipped,
+		Run:      run.runFields(),
+		Plan:     run.planFields(),
+		DAG:      run.dag(),
+		Timeline: run.timeline(),
+	}
+	for _, sr := range run.Results.Steps {
+		page.Steps = append(page.Steps, run.htmlStep(sr, opts))
+	}
+
+	if err := htmlTemplate.Execute(w, page); err != nil {
+		return fmt.Errorf("html: %w", err)
+	}
+	return nil
+}
+
+func (r *Run) runFields() []htmlField {
+	res := r.Results
+	fields := []htmlField{{"Status", res.Status}, {"Duration", res.Duration}}
+	if res.RunID != "" {
+		fields = append(fields, htmlField{"Run ID", res.RunID})
+	}
+	if m := r.Meta; m != nil {
+		fields = append(fields,
+			htmlField{"Started", m.StartedAt},
+			htmlField{"Finished", m.FinishedAt},
+			htmlField{"Host", m.Hostname},
+			htmlField{"User", m.User},
+			htmlField{"anvil", m.Version},
+			htmlField{"Command", r.mask(m.Command)},
+		)
+	}
+	return nonEmpty(fields)
+}
+
+func (r *Run) planFields() []htmlField {
+	var fields []htmlField
+	if p := r.Plan; p != nil {
+		fields = append(fields,
+			htmlField{"Project", p.ProjectName},
+			htmlField{"Profile", p.Profile},
+			htmlField{"Config hash", p.ConfigHash},
+			htmlField{"Planned", p.CreatedAt},
+			htmlField{"Plan version", fmt.Sprint(p.Version)},
+			htmlField{"Order", strings.Join(p.Order, " → ")},
+		)
+	} else if m := r.Meta; m != nil {
+		fields = append(fields, htmlField{"Config hash", m.ConfigHash})
+	}
+	return nonEmpty(fields)
+}
+
+func nonEmpty(fields []htmlField) []htmlField {
+	return slices.DeleteFunc(fields, func(f htmlField) bool { return f.Value == "" })
+}
+
+// status returns the recorded status of a step, or "" if it has no result.
+func (r *Run) status(id string) string {
+	for _, sr := range r.Results.Steps {
+		if sr.ID == id {
+			return sr.Status
+		}
+	}
+	return ""
+}
+
+// dag lays out the plan's steps in columns by dependency depth, each step
+// to the right of everything it depends on.
+func (r *Run) dag() *htmlDAG {
+	if r.Plan == nil || len(r.Plan.Order) == 0 {
+		return nil
+	}
+	deps := make(map[string][]string, len(r.Plan.Steps))
+	for _, s := range r.Plan.Steps {
+		deps[s.ID] = s.Deps
+	}
+
+	level := map[string]int{}
+	var columns [][]string
+	for _, id := range r.Plan.Order {
+		l := 0
+		for _, dep := range deps[id] {
+			l = max(l, level[dep]+1)
+		}
+		level[id] = l
+		if l == len(columns) {
+			columns = append(columns, nil)
+		}
+		columns[l] = append(columns[l], id)
+	}
+
+	g := &htmlDAG{NodeWidth: nodeWidth, NodeHeight: nodeHeight}
+	pos := map[string]htmlNode{}
+	rows := 0
+	for col, ids := range columns {
+		rows = max(rows, len(ids))
+		for row, id := range ids {
+			label := id
+			if n := []rune(id); len(n) > nodeLabel {
+				label = string(n[:nodeLabel-1]) + "…"
+			}
+			node := htmlNode{
+				ID:     id,
+				Label:  label,
+				Status: r.status(id),
+				X:      dagPadding + col*(nodeWidth+nodeGapX),
+				Y:      dagPadding + row*(nodeHeight+nodeGapY),
+			}
+			pos[id] = node
+			g.Nodes = append(g.Nodes, node)
+		}
+	}
+	for _, id := range r.Plan.Order {
+		to := pos[id]
+		for _, dep := range deps[id] {
+			from, ok := pos[dep]
+			if !ok {
+				continue
+			}
+			x1, y1 := from.X+nodeWidth, from.Y+nodeHeight/2
+			x2, y2 := to.X, to.Y+nodeHeight/2
+			mid := (x1 + x2) / 2
+			g.Edges = append(g.Edges, fmt.Sprintf("M%d %d C%d %d %d %d %d %d", x1, y1, mid, y1, mid, y2, x2, y2))
+		}
+	}
+	g.Width = 2*dagPadding + len(columns)*(nodeWidth+nodeGapX) - nodeGapX
+	g.Height = 2*dagPadding + rows*(nodeHeight+nodeGapY) - nodeGapY
+	return g
+}
+
+// timeline places each step that ran on a time axis starting with the run.
+func (r *Run) timeline() *htmlTimeline {
+	type span struct{ start, end time.Time }
+	spans := map[string]span{}
+	var first, last time.Time
+	for _, sr := range r.Results.Steps {
+		start, err := time.Parse(time.RFC3339Nano, sr.Started)
+		if err != nil {
+			continue
+		}
+		d, _ := time.ParseDuration(sr.Duration)
+		spans[sr.ID] = span{start, start.Add(d)}
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.Add(d).After(last) {
+			last = start.Add(d)
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	if m := r.Meta; m != nil {
+		if t := m.Started(); !t.IsZero() && t.Before(first) {
+			first = t
+		}
+	}
+	total := last.Sub(first)
+	if total <= 0 {
+		total = time.Millisecond
+	}
+	percent := func(d time.Duration) float64 {
+		return float64(d) / float64(total) * 100
+	}
+
+	tl := &htmlTimeline{}
+	for i := 0; i <= 4; i++ {
+		at := total * time.Duration(i) / 4
+		tl.Ticks = append(tl.Ticks, htmlTick{Left: float64(i) * 25, Label: roundDuration(at)})
+	}
+	for _, sr := range r.Results.Steps {
+		bar := htmlBar{ID: sr.ID, Status: sr.Status, Label: sr.Status}
+		if s, ok := spans[sr.ID]; ok {
+			bar.Left = percent(s.start.Sub(first))
+			bar.Width = max(percent(s.end.Sub(s.start)), 0.2)
+			bar.Label = fmt.Sprintf("+%s for %s", roundDuration(s.start.Sub(first)), roundDuration(s.end.Sub(s.start)))
+		}
+		tl.Rows = append(tl.Rows, bar)
+	}
+	return tl
+}
+
+// roundDuration shortens a duration for display.
+func roundDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func (r *Run) htmlStep(sr exec.StepResult, opts Options) htmlStep {
+	sr.Error = r.mask(sr.Error)
+	step := htmlStep{StepResult: sr, Open: sr.Status == "failed"}
+
+	if r.Plan != nil {
+		for _, ps := range r.Plan.Steps {
+			if ps.ID != sr.ID {
+				continue
+			}
+			step.Command = r.mask(strings.Join(ps.Command, " "))
+			step.Deps = ps.Deps
+			for name, value := range ps.Env {
+				if secretName.MatchString(name) {
+					value = masked
+				}
+				step.Env = append(step.Env, htmlField{name, r.mask(value)})
+			}
+			slices.SortFunc(step.Env, func(a, b htmlField) int { return strings.Compare(a.Name, b.Name) })
+		}
+	}
+	if a := sr.Approval; a != nil {
+		verb := "Approved"
+		if !a.Approved {
+			verb = "Rejected"
+		}
+		step.Approval = fmt.Sprintf("%s by %s at %s", verb, a.By, a.At)
+	}
+	if sr.Tests != nil {
+		step.Tests = sr.Tests.String()
+		for _, c := range sr.Tests.Cases {
+			if c.Status == testresults.Failed {
+				c.Output = r.mask(c.Output)
+				step.Failures = append(step.Failures, c)
+			}
+		}
+	}
+
+	if opts.LogLines < 0 || sr.LogFile == "" {
+		return step
+	}
+	final := r.logPath(sr.LogFile)
+	dir := filepath.Dir(final)
+	for i := 1; i <= max(sr.Attempt, 1); i++ {
+		a := htmlAttempt{N: i, Status: "failed"}
+		path := filepath.Join(dir, fmt.Sprintf("%s.%d.log", sr.ID, i))
+		if i >= sr.Attempt {
+			a.Status, a.Open, path = sr.Status, step.Open, final
+		}
+		var err error
+		a.Log, a.Truncated, err = readLog(path, opts.LogLines)
+		if err != nil {
+			continue
+		}
+		a.Log = r.mask(a.Log)
+		step.Attempts = append(step.Attempts, a)
+	}
+	return step
+}
+
+// readLog returns the log at path, keeping its last maxHTMLLog bytes and,
+// if lines is positive, its last lines. It reports whether anything was
+// left out.
+func readLog(path string, lines int) (string, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	offset := max(info.Size()-maxHTMLLog, 0)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	text, truncated := string(buf), offset > 0
+	if truncated {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	if lines > 0 {
+		all := strings.SplitAfter(strings.TrimRight(text, "\n"), "\n")
+		if len(all) > lines {
+			text, truncated = strings.Join(all[len(all)-lines:], ""), true
+		}
+	}
+	return text, truncated, nil
+}
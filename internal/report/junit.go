@@ -0,0 +1,173 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+)
+
+// JUnit XML elements, following the schema used by Jenkins and most CI
+// servers (junit-10.xsd).
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Time     string       `xml:"time,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Hostname   string          `xml:"hostname,attr,omitempty"`
+	ID         string          `xml:"id,attr,omitempty"`
+	Properties *junitProps     `xml:"properties"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProps struct {
+	Props []junitProp `xml:"property"`
+}
+
+type junitProp struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Skipped   *junitMessage `xml:"skipped"`
+	Failure   *junitMessage `xml:"failure"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit writes run as JUnit XML: one test suite for the run and one test
+// case per step. Failed steps carry the tail of their log in the failure,
+// and retried steps list their earlier attempts in system-out.
+func JUnit(w io.Writer, run *Run, opts Options) error {
+	res := run.Results
+	c := countSteps(res.Steps)
+	name := run.name()
+
+	suite := junitSuite{
+		Name:     name,
+		Tests:    c.total,
+		Failures: c.failed,
+		Skipped:  c.skipped,
+		Time:     secondsAttr(res.Duration),
+		ID:       res.RunID,
+	}
+	if m := run.Meta; m != nil {
+		suite.Hostname = m.Hostname
+		if t := m.Started(); !t.IsZero() {
+			suite.Timestamp = t.UTC().Format("2006-01-02T15:04:05")
+		}
+	}
+	if props := runProperties(run); len(props) > 0 {
+		suite.Properties = &junitProps{Props: props}
+	}
+
+	lines := opts.logLines()
+	for _, sr := range res.Steps {
+		tc := junitTestCase{Name: sr.ID, Classname: name, Time: secondsAttr(sr.Duration)}
+		switch sr.Status {
+		case "failed":
+			tc.Failure = &junitMessage{
+				Message: sr.Error,
+				Type:    failureType(sr),
+				Text:    strings.Join(run.logTail(sr, lines), "\n"),
+			}
+		case "skipped", "pending":
+			tc.Skipped = &junitMessage{Message: sr.Error}
+		}
+		tc.SystemOut = attemptHistory(run, sr, lines)
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	doc := junitSuites{
+		Name:     name,
+		Time:     suite.Time,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("junit: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("junit: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("junit: %w", err)
+	}
+	return nil
+}
+
+// runProperties describes the run as suite properties.
+func runProperties(run *Run) []junitProp {
+	var props []junitProp
+	add := func(name, value string) {
+		if value != "" {
+			props = append(props, junitProp{Name: name, Value: value})
+		}
+	}
+	add("run_id", run.Results.RunID)
+	add("status", run.Results.Status)
+	if p := run.Plan; p != nil {
+		add("project", p.ProjectName)
+		add("profile", p.Profile)
+		add("config_hash", p.ConfigHash)
+	}
+	return props
+}
+
+func failureType(sr exec.StepResult) string {
+	if sr.ExitCode > 0 {
+		return fmt.Sprintf("exit code %d", sr.ExitCode)
+	}
+	return "failed"
+}
+
+// attemptHistory describes the earlier attempts of a retried step, with the
+// tail of each attempt's log.
+func attemptHistory(run *Run, sr exec.StepResult, lines int) string {
+	earlier := run.earlierAttempts(sr, lines)
+	if len(earlier) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s after %d attempts\n", sr.Status, sr.Attempt)
+	for _, a := range earlier {
+		fmt.Fprintf(&b, "--- attempt %d (failed) ---\n", a.n)
+		for _, line := range a.log {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// secondsAttr formats a recorded duration as decimal seconds.
+func secondsAttr(d string) string {
+	return fmt.Sprintf("%.3f", seconds(d))
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// statusIcons are the markers used for step outcomes in Markdown.
+var statusIcons = map[string]string{
+	"success": "✅",
+	"failed":  "❌",
+	"skipped": "⏭️",
+	"pending": "⏸️",
+}
+
+// Markdown writes run as a Markdown summary suitable for pull request
+// comments and CI job summaries: a table of steps followed by collapsible
+// log excerpts of failed steps.
+func Markdown(w io.Writer, run *Run, opts Options) error {
+	var b bytes.Buffer
+	res := run.Results
+	c := countSteps(res.Steps)
+
+	fmt.Fprintf(&b, "## %s %s: %s\n\n", icon(res.Status), run.name(), res.Status)
+	fmt.Fprintf(&b, "%d steps, %d failed, %d skipped in %s", c.total, c.failed, c.skipped, res.Duration)
+	if res.RunID != "" {
+		fmt.Fprintf(&b, " (run `%s`)", res.RunID)
+	}
+	b.WriteString("\n\n")
+
+	b.WriteString("| Step | Status | Duration | Attempts | Details |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, sr := range res.Steps {
+		details := sr.Error
+		if a := sr.Approval; a != nil {
+			verb := "approved"
+			if !a.Approved {
+				verb = "rejected"
+			}
+			details = fmt.Sprintf("%s by %s", verb, a.By)
+		}
+		if sr.Tests != nil {
+			details = strings.TrimPrefix(details+"; "+sr.Tests.String(), "; ")
+		}
+		fmt.Fprintf(&b, "| %s | %s %s | %s | %d | %s |\n",
+			cell(sr.ID), icon(sr.Status), sr.Status, sr.Duration, sr.Attempt, cell(details))
+	}
+
+	lines := opts.logLines()
+	for _, sr := range res.Steps {
+		if sr.Status != "failed" {
+			continue
+		}
+		tail := run.logTail(sr, lines)
+		if len(tail) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n<details><summary>%s log (last %d lines)</summary>\n\n", cell(sr.ID), len(tail))
+		fence := codeFence(tail)
+		b.WriteString(fence + "text\n")
+		b.WriteString(strings.Join(tail, "\n") + "\n")
+		b.WriteString(fence + "\n\n</details>\n")
+	}
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("markdown: %w", err)
+	}
+	return nil
+}
+
+func icon(status string) string {
+	if s, ok := statusIcons[status]; ok {
+		return s
+	}
+	return "❔"
+}
+
+// cell escapes text for a Markdown table cell.
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in
+// lines, so log content cannot close the code block.
+func codeFence(lines []string) string {
+	longest := 0
+	for _, line := range lines {
+		run := 0
+		for _, r := range line {
+			if r == '`' {
+				run++
+				longest = max(longest, run)
+			} else {
+				run = 0
+			}
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,86 @@
+package report
+
+import (
+	"cmp"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// secretName matches environment variable names whose values are treated
+// as secrets.
+var secretName = regexp.MustCompile(`(?i)(secret|token|passw(or)?d|passphrase|api_?key|private_?key|access_?key|credential|auth)`)
+
+// secretPattern matches well-known credential formats wherever they appear:
+// GitHub, GitLab, Slack and AWS tokens, and PEM private keys.
+var secretPattern = regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|glpat-[A-Za-z0-9_-]{20,}|xox[abposr]-[A-Za-z0-9-]{10,}|AKIA[0-9A-Z]{16}|-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+// minSecretLen is the shortest value masked by name; shorter values would
+// mask unrelated text.
+const minSecretLen = 4
+
+// masked replaces secrets in report output.
+const masked = "***"
+
+// masker hides secret values in text shown in reports.
+type masker struct {
+	values *strings.Replacer
+}
+
+// newMasker masks the values of secret-looking variables in the plan's step
+// environments and in environ (as returned by os.Environ).
+func newMasker(envs []map[string]string, environ []string) *masker {
+	seen := map[string]bool{}
+	var values []string
+	add := func(name, value string) {
+		if len(value) >= minSecretLen && secretName.MatchString(name) && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	for _, env := range envs {
+		for name, value := range env {
+			add(name, value)
+		}
+	}
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			add(name, value)
+		}
+	}
+
+	// Longer values first, so a secret containing another is masked whole.
+	slices.SortFunc(values, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a, b))
+	})
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, masked)
+	}
+	return &masker{values: strings.NewReplacer(pairs...)}
+}
+
+// mask returns s with secrets replaced.
+func (m *masker) mask(s string) string {
+	return secretPattern.ReplaceAllString(m.values.Replace(s), masked)
+}
+
+// masker returns the run's masker, built on first use.
+func (r *Run) masker() *masker {
+	if r.secrets == nil {
+		var envs []map[string]string
+		if r.Plan != nil {
+			for _, s := range r.Plan.Steps {
+				envs = append(envs, s.Env)
+			}
+		}
+		r.secrets = newMasker(envs, os.Environ())
+	}
+	return r.secrets
+}
+
+// mask returns s with the run's secrets replaced.
+func (r *Run) mask(s string) string {
+	return r.masker().mask(s)
+}
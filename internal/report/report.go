@@ -0,0 +1,191 @@
+// Package report renders the results of a run in formats understood by CI
+// servers, review tools and people.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// Formats lists the supported report formats.
+var Formats = []string{"junit", "tap", "markdown", "html", "trace"}
+
+// defaultLogLines is how many trailing log lines are included per step.
+const defaultLogLines = 50
+
+// Run is everything known about a run that reports draw from. Only Results
+// is required.
+type Run struct {
+	Results *exec.ExecutionResult
+	Plan    *plan.Plan
+	Meta    *runs.Meta
+	Dir     string // run directory, used to find logs moved with it
+
+	secrets *masker
+}
+
+// Options tunes report output.
+type Options struct {
+	LogLines int // trailing log lines per step; 0 means 50 (whole logs for html), negative means none
+}
+
+func (o Options) logLines() int {
+	if o.LogLines == 0 {
+		return defaultLogLines
+	}
+	return max(o.LogLines, 0)
+}
+
+// Load reads a run from its directory: results.json, and plan.json and
+// metadata.json where present.
+func Load(dir string) (*Run, error) {
+	run := &Run{Dir: dir}
+	if err := util.ReadJSON(filepath.Join(dir, "results.json"), &run.Results); err != nil {
+		return nil, fmt.Errorf("load run: %w", err)
+	}
+	if err := util.ReadJSON(filepath.Join(dir, "plan.json"), &run.Plan); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("load run: %w", err)
+	}
+	if err := util.ReadJSON(filepath.Join(dir, runs.MetaFile), &run.Meta); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("load run: %w", err)
+	}
+	return run, nil
+}
+
+// Write renders run in format to w.
+func Write(w io.Writer, format string, run *Run, opts Options) error {
+	if run == nil || run.Results == nil {
+		return fmt.Errorf("report: no results")
+	}
+	switch format {
+	case "junit":
+		return JUnit(w, run, opts)
+	case "tap":
+		return TAP(w, run, opts)
+	case "markdown":
+		return Markdown(w, run, opts)
+	case "html":
+		return HTML(w, run, opts)
+	case "trace":
+		return Trace(w, run, opts)
+	}
+	return fmt.Errorf("report: unknown format %q (must be %s)", format, strings.Join(Formats, ", "))
+}
+
+// WriteFile renders run in format to the file at path.
+func WriteFile(path, format string, run *Run, opts Options) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := util.EnsureDir(dir); err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	if err := Write(f, format, run, opts); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	return nil
+}
+
+// name is the run's display name, "project/profile" where known.
+func (r *Run) name() string {
+	switch {
+	case r.Meta != nil && r.Meta.Project != "":
+		return r.Meta.Project + "/" + r.Meta.Profile
+	case r.Plan != nil && r.Plan.ProjectName != "":
+		return r.Plan.ProjectName + "/" + r.Plan.Profile
+	}
+	return "anvil"
+}
+
+// logPath locates a log file, falling back to the run directory when the
+// recorded path no longer resolves (e.g. a run directory downloaded as a CI
+// artifact).
+func (r *Run) logPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Stat(path); err == nil || r.Dir == "" {
+		return path
+	}
+	return filepath.Join(r.Dir, filepath.Base(path))
+}
+
+// logTail returns the last lines of the step's final attempt log, with
+// secrets masked.
+func (r *Run) logTail(sr exec.StepResult, n int) []string {
+	return r.tail(r.logPath(sr.LogFile), n)
+}
+
+func (r *Run) tail(path string, n int) []string {
+	lines := util.TailLines(path, n)
+	for i, line := range lines {
+		lines[i] = r.mask(line)
+	}
+	return lines
+}
+
+// attempt is one earlier, failed attempt of a retried step.
+type attempt struct {
+	n   int
+	log []string
+}
+
+// earlierAttempts returns the attempts before the final one, with the tails
+// of their logs.
+func (r *Run) earlierAttempts(sr exec.StepResult, n int) []attempt {
+	if sr.Attempt <= 1 || sr.LogFile == "" {
+		return nil
+	}
+	dir := filepath.Dir(r.logPath(sr.LogFile))
+	var attempts []attempt
+	for i := 1; i < sr.Attempt; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%s.%d.log", sr.ID, i))
+		attempts = append(attempts, attempt{n: i, log: r.tail(path, n)})
+	}
+	return attempts
+}
+
+// seconds converts a recorded duration to seconds.
+func seconds(d string) float64 {
+	dur, err := time.ParseDuration(d)
+	if err != nil {
+		return 0
+	}
+	return dur.Seconds()
+}
+
+// counts tallies step outcomes.
+type counts struct {
+	total, failed, skipped int
+}
+
+func countSteps(steps []exec.StepResult) counts {
+	var c counts
+	for _, sr := range steps {
+		c.total++
+		switch sr.Status {
+		case "failed":
+			c.failed++
+		case "skipped", "pending":
+			c.skipped++
+		}
+	}
+	return c
+}
@@ -0,0 +1,342 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	foundryexec "github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/runs"
+)
+
+// testRun returns a run with a passing, a retried, a failed and a skipped
+// step, with logs in a temporary run directory.
+func testRun(t *testing.T) *Run {
+	t.Helper()
+
+	dir := t.TempDir()
+	logs := map[string]string{
+		"flaky.1.log": "connection refused\n",
+		"flaky.2.log": "ok\n",
+		"test.1.log":  "=== RUN TestX\n\x1b[31m--- FAIL: TestX\x1b[0m <got> & \"want\"\nusing token s3cr3t-value\n",
+	}
+	for name, content := range logs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &Run{
+		Dir: dir,
+		Plan: &plan.Plan{
+			ProjectName: "demo",
+			Profile:     "ci",
+			ConfigHash:  "abc123",
+			Steps: []plan.Step{
+				{ID: "lint", Type: "shell", Command: []string{"make", "lint"}},
+				{ID: "flaky", Type: "shell", Command: []string{"make", "flaky"}},
+				{ID: "test", Type: "shell", Command: []string{"make", "test"}, Deps: []string{"lint"}, Env: map[string]string{"API_TOKEN": "s3cr3t-value"}},
+				{ID: "deploy", Type: "shell", Command: []string{"make", "deploy"}, Deps: []string{"test", "flaky"}},
+			},
+			Order: []string{"flaky", "lint", "test", "deploy"},
+		},
+		Results: &foundryexec.ExecutionResult{
+			RunID:    "20260101T000000.000Z-abcdef",
+			Status:   "failed",
+			Duration: "3.5s",
+			Steps: []foundryexec.StepResult{
+				{ID: "lint", Status: "success", Started: "2026-01-01T00:00:00Z", Duration: "1.25s", Attempt: 1},
+				{ID: "flaky", Status: "success", Started: "2026-01-01T00:00:00Z", Duration: "2s", Attempt: 2, LogFile: filepath.Join(dir, "flaky.2.log")},
+				{ID: "test", Status: "failed", Started: "2026-01-01T00:00:01.25Z", Duration: "500ms", Attempt: 1, ExitCode: 1, Error: "exit status 1", LogFile: filepath.Join(dir, "test.1.log")},
+				{ID: "deploy", Status: "skipped", Duration: "0s", Error: "dependency failed"},
+			},
+		},
+	}
+}
+
+// TestJUnit verifies the JUnit structure and, where xmllint is installed,
+// validates it against the JUnit XSD.
+func TestJUnit(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "junit", testRun(t), Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	var doc junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid XML: %v\n%s", err, buf.String())
+	}
+	suite := doc.Suites[0]
+	if suite.Name != "demo/ci" || suite.Tests != 4 || suite.Failures != 1 || suite.Skipped != 1 {
+		t.Errorf("unexpected suite counts: %+v", suite)
+	}
+
+	cases := map[string]junitTestCase{}
+	for _, tc := range suite.Cases {
+		cases[tc.Name] = tc
+	}
+	if tc := cases["lint"]; tc.Time != "1.250" || tc.Failure != nil || tc.Skipped != nil {
+		t.Errorf("unexpected lint case: %+v", tc)
+	}
+	if tc := cases["test"]; tc.Failure == nil || tc.Failure.Type != "exit code 1" || !strings.Contains(tc.Failure.Text, `--- FAIL: TestX <got> & "want"`) {
+		t.Errorf("expected test failure with log excerpt, got %+v", tc.Failure)
+	}
+	if tc := cases["flaky"]; !strings.Contains(tc.SystemOut, "--- attempt 1 (failed) ---\nconnection refused") {
+		t.Errorf("expected flaky attempt history, got %q", tc.SystemOut)
+	}
+	if tc := cases["deploy"]; tc.Skipped == nil || tc.Skipped.Message != "dependency failed" {
+		t.Errorf("expected deploy skipped, got %+v", tc)
+	}
+
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not installed; skipping XSD validation")
+	}
+	path := filepath.Join(t.TempDir(), "report.xml")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(xmllint, "--noout", "--schema", filepath.Join("testdata", "junit-10.xsd"), path).CombinedOutput()
+	if err != nil {
+		t.Errorf("JUnit output does not validate: %v\n%s\n%s", err, out, buf.String())
+	}
+}
+
+// TestTAP verifies test points, directives and diagnostics.
+func TestTAP(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "tap", testRun(t), Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"TAP version 13\n1..4\n",
+		"ok 1 - lint\n",
+		"ok 2 - flaky\n  ---\n  attempts: 2\n",
+		"not ok 3 - test\n  ---\n  message: exit status 1\n  severity: fail\n  exit_code: 1\n",
+		"--- FAIL: TestX",
+		"ok 4 - deploy # SKIP dependency failed\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected TAP output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+// TestMarkdown verifies the summary table and failed step logs.
+func TestMarkdown(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "markdown", testRun(t), Options{LogLines: 2}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"## ❌ demo/ci: failed\n",
+		"4 steps, 1 failed, 1 skipped in 3.5s (run `20260101T000000.000Z-abcdef`)",
+		"| test | ❌ failed | 500ms | 1 | exit status 1 |",
+		"<details><summary>test log (last 2 lines)</summary>",
+		"```text\n--- FAIL: TestX <got> & \"want\"\nusing token ***\n```",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected Markdown to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "=== RUN") {
+		t.Error("expected log excerpt to respect LogLines")
+	}
+}
+
+// TestWrite_UnknownFormat verifies an unsupported format is rejected.
+func TestWrite_UnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	err := Write(&bytes.Buffer{}, "xml", testRun(t), Options{})
+	if err == nil || !strings.Contains(err.Error(), `unknown format "xml"`) {
+		t.Errorf("expected unknown format error, got %v", err)
+	}
+}
+
+// TestHTML verifies the HTML report is self-contained and includes the
+// graph, timeline, attempt history and masked, coloured logs.
+func TestHTML(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "html", testRun(t), Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>demo/ci: failed</title>",
+		`<dd class="mono">abc123</dd>`,
+		`<rect class="failed" x="224" y="8"`,                     // test, one level after lint
+		`<rect class="skipped" x="440" y="8"`,                    // deploy, after test
+		`<path class="edge" d="M168 70 C196 70 196 24 224 24"/>`, // lint -> test
+		`<div class="bar failed" style="left: 62.500%; width: 25.000%">`,
+		`<details class="step" id="step-test" open>`,
+		"Attempt 1 <span class=\"badge failed\">failed</span>",
+		`<span class="fg1">--- FAIL: TestX</span> &lt;got&gt; &amp; &#34;want&#34;`,
+		"using token ***",
+		`<dt>API_TOKEN</dt><dd class="mono">***</dd>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+	if strings.Contains(out, "s3cr3t-value") {
+		t.Error("expected secret to be masked")
+	}
+	if external := regexp.MustCompile(`(?i)<(script|link|img|iframe)\b|src=|url\(`); external.MatchString(out) {
+		t.Errorf("expected no external resources, found %q", external.FindString(out))
+	}
+}
+
+// TestANSIHTML verifies colours, attributes and carriage returns.
+func TestANSIHTML(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in, want string
+	}{
+		{"plain <b>", "plain &lt;b&gt;"},
+		{"\x1b[1;32mok\x1b[0m done", `<span class="fg2 b">ok</span> done`},
+		{"\x1b[38;5;208mx\x1b[48;2;1;2;3my\x1b[m", `<span style="color:#ff8700">x</span><span style="color:#ff8700;background:#010203">y</span>`},
+		{"10%\r50%\r100%\nnext", "100%\nnext"},
+		{"\x1b]8;;http://x\x07link\x1b]8;;\x07\x1b[2K", "link"},
+	}
+	for _, tt := range tests {
+		if got := string(ansiHTML(tt.in)); got != tt.want {
+			t.Errorf("ansiHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestMask verifies secrets are masked by variable name and by format.
+func TestMask(t *testing.T) {
+	t.Parallel()
+
+	m := newMasker(
+		[]map[string]string{{"DB_PASSWORD": "hunter22", "DEBUG": "verbose", "AUTH_PIN": "123"}},
+		[]string{"NPM_TOKEN=npm-abc-123-def", "HOME=/root"},
+	)
+	in := "login hunter22 with npm-abc-123-def at /root verbose 123 ghp_" + strings.Repeat("a", 36)
+	want := "login *** with *** at /root verbose 123 ***"
+	if got := m.mask(in); got != want {
+		t.Errorf("mask() = %q, want %q", got, want)
+	}
+}
+
+// TestTrace verifies lanes per job slot, attempts as child spans and
+// explicit waits for job slots, approvals and the runs lock.
+func TestTrace(t *testing.T) {
+	t.Parallel()
+
+	run := &Run{
+		Meta: &runs.Meta{RunID: "r1", Project: "demo", Profile: "ci", StartedAt: "2026-01-01T00:00:01.000Z", FinishedAt: "2026-01-01T00:00:10.000Z", LockWait: "1s"},
+		Results: &foundryexec.ExecutionResult{
+			RunID:  "r1",
+			Status: "success",
+			Steps: []foundryexec.StepResult{
+				{ID: "db", Status: "success", Slot: 1, Queued: "2026-01-01T00:00:01Z", Started: "2026-01-01T00:00:01Z", Ready: "1s", Duration: "8s"},
+				{ID: "build", Status: "success", Slot: 2, Queued: "2026-01-01T00:00:01Z", Started: "2026-01-01T00:00:01Z", Duration: "3s", Attempt: 2, Attempts: []foundryexec.AttemptResult{
+					{Attempt: 1, Status: "failed", Started: "2026-01-01T00:00:01Z", Duration: "1s", ExitCode: 1},
+					{Attempt: 2, Status: "success", Started: "2026-01-01T00:00:02Z", Duration: "2s"},
+				}},
+				{ID: "lint", Status: "success", Slot: 1, Queued: "2026-01-01T00:00:01Z", Started: "2026-01-01T00:00:02Z", Duration: "1s", Attempt: 1},
+				{ID: "gate", Status: "success", Started: "2026-01-01T00:00:04Z", Duration: "5s", Approval: &foundryexec.Approval{By: "alice", Approved: true}},
+				{ID: "skipped", Status: "skipped", Duration: "0s"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "trace", run, Options{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var file traceFile
+	if err := json.Unmarshal(buf.Bytes(), &file); err != nil {
+		t.Fatalf("trace is not valid JSON: %v", err)
+	}
+
+	type key struct {
+		ph, name string
+		tid      int
+	}
+	events := map[key]traceEvent{}
+	metaDone := false
+	for i, e := range file.TraceEvents {
+		if e.Ph != phaseMetadata {
+			metaDone = true
+		} else if metaDone {
+			t.Errorf("metadata event %d after spans", i)
+		}
+		name := e.Name
+		if e.Name == "thread_name" {
+			name += "=" + e.Args["name"].(string)
+		}
+		events[key{e.Ph, name, e.TID}] = e
+	}
+
+	span := func(name string, tid int, ts, dur int64) {
+		t.Helper()
+		e, ok := events[key{"X", name, tid}]
+		if !ok {
+			t.Errorf("missing span %q on lane %d", name, tid)
+			return
+		}
+		if e.TS != ts || durOf(e) != dur {
+			t.Errorf("span %q: expected ts %d dur %d, got ts %d dur %d", name, ts, dur, e.TS, durOf(e))
+		}
+	}
+	for _, lane := range []string{"thread_name=run", "thread_name=job slot 1", "thread_name=job slot 2"} {
+		found := false
+		for k := range events {
+			found = found || k.name == lane
+		}
+		if !found {
+			t.Errorf("missing lane %q", lane)
+		}
+	}
+
+	// Times are relative to the start of the lock wait, one second before
+	// the run started.
+	span("waiting for runs lock", 0, 0, 1e6)
+	span("demo/ci", 0, 1e6, 9e6)
+	span("build", 2, 1e6, 3e6)
+	span("attempt 1", 2, 1e6, 1e6)
+	span("attempt 2", 2, 2e6, 2e6)
+	span("db (starting)", 1, 1e6, 1e6)
+	span("db", 3, 1e6, 8e6)
+	span("lint", 1, 2e6, 1e6)
+
+	if e, ok := events[key{"b", "lint: waiting for a job slot", 0}]; !ok || e.TS != 1e6 {
+		t.Errorf("expected lint job slot wait from 1s, got %+v", e)
+	}
+	if e, ok := events[key{"e", "lint: waiting for a job slot", 0}]; !ok || e.TS != 2e6 {
+		t.Errorf("expected lint job slot wait until 2s, got %+v", e)
+	}
+	if e, ok := events[key{"b", "gate: awaiting approval", 0}]; !ok || e.Args["by"] != "alice" {
+		t.Errorf("expected approval wait, got %+v", e)
+	}
+	for k := range events {
+		if strings.HasPrefix(k.name, "skipped") {
+			t.Error("expected no events for a step that never ran")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tapDiagnostic is the YAML block attached to a TAP test line.
+type tapDiagnostic struct {
+	Message  string  `yaml:"message,omitempty"`
+	Severity string  `yaml:"severity,omitempty"`
+	ExitCode int     `yaml:"exit_code,omitempty"`
+	Attempts int     `yaml:"attempts,omitempty"`
+	Duration float64 `yaml:"duration_s"`
+	Log      string  `yaml:"log,omitempty"`
+}
+
+// TAP writes run in TAP version 13, one test point per step. Skipped and
+// pending steps use the SKIP directive; failed and retried steps get a YAML
+// diagnostic block with the tail of their log.
+func TAP(w io.Writer, run *Run, opts Options) error {
+	var b bytes.Buffer
+	steps := run.Results.Steps
+	lines := opts.logLines()
+
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(steps))
+	for i, sr := range steps {
+		desc := strings.ReplaceAll(sr.ID, "#", `\#`)
+		switch sr.Status {
+		case "success":
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, desc)
+		case "skipped", "pending":
+			fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", i+1, desc, sr.Error)
+			continue
+		default:
+			fmt.Fprintf(&b, "not ok %d - %s\n", i+1, desc)
+		}
+
+		if sr.Status == "success" && sr.Attempt <= 1 {
+			continue
+		}
+		diag := tapDiagnostic{Duration: seconds(sr.Duration)}
+		if sr.Attempt > 1 {
+			diag.Attempts = sr.Attempt
+		}
+		if sr.Status != "success" {
+			diag.Message = sr.Error
+			diag.Severity = "fail"
+			diag.ExitCode = sr.ExitCode
+			diag.Log = strings.Join(run.logTail(sr, lines), "\n")
+		}
+		data, err := yaml.Marshal(diag)
+		if err != nil {
+			return fmt.Errorf("tap: %w", err)
+		}
+		b.WriteString("  ---\n")
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString("  ...\n")
+	}
+
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("tap: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package report
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+)
+
+// traceEvent is an event of the Chrome Trace Event Format, as read by
+// Perfetto and chrome://tracing. Times are in microseconds.
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	TS   int64          `json:"ts"`
+	Dur  *int64         `json:"dur,omitempty"`
+	PID  int            `json:"pid"`
+	TID  int            `json:"tid"`
+	ID   string         `json:"id,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type traceFile struct {
+	TraceEvents     []traceEvent      `json:"traceEvents"`
+	DisplayTimeUnit string            `json:"displayTimeUnit"`
+	OtherData       map[string]string `json:"otherData,omitempty"`
+}
+
+// Trace phases.
+const (
+	phaseComplete   = "X"
+	phaseAsyncBegin = "b"
+	phaseAsyncEnd   = "e"
+	phaseMetadata   = "M"
+)
+
+// tracePID is the single process all lanes belong to.
+const tracePID = 1
+
+// minWait is the shortest wait for a job slot shown in a trace.
+const minWait = time.Millisecond
+
+// tracer accumulates the events of a trace, with times relative to base.
+type tracer struct {
+	base   time.Time
+	events []traceEvent
+}
+
+func (t *tracer) ts(at time.Time) int64 {
+	return at.Sub(t.base).Microseconds()
+}
+
+// span adds a complete event on lane tid.
+func (t *tracer) span(tid int, cat, name string, start time.Time, d time.Duration, args map[string]any) {
+	dur := max(d.Microseconds(), 1)
+	t.events = append(t.events, traceEvent{Name: name, Cat: cat, Ph: phaseComplete, TS: t.ts(start), Dur: &dur, PID: tracePID, TID: tid, Args: args})
+}
+
+// async adds an interval shown on its own track, for waits that are not
+// tied to a job slot and may overlap.
+func (t *tracer) async(cat, name, id string, start time.Time, d time.Duration, args map[string]any) {
+	t.events = append(t.events,
+		traceEvent{Name: name, Cat: cat, Ph: phaseAsyncBegin, TS: t.ts(start), PID: tracePID, ID: id, Args: args},
+		traceEvent{Name: name, Cat: cat, Ph: phaseAsyncEnd, TS: t.ts(start.Add(d)), PID: tracePID, ID: id},
+	)
+}
+
+// lane names lane tid and fixes its position.
+func (t *tracer) lane(tid int, name string) {
+	t.events = append(t.events,
+		traceEvent{Name: "thread_name", Ph: phaseMetadata, PID: tracePID, TID: tid, Args: map[string]any{"name": name}},
+		traceEvent{Name: "thread_sort_index", Ph: phaseMetadata, PID: tracePID, TID: tid, Args: map[string]any{"sort_index": tid}},
+	)
+}
+
+// stepTimes are the parsed times of a step result.
+type stepTimes struct {
+	queued, started time.Time
+	dur, ready      time.Duration
+}
+
+func parseStepTimes(sr exec.StepResult) (stepTimes, bool) {
+	var st stepTimes
+	var err error
+	if st.started, err = time.Parse(time.RFC3339Nano, sr.Started); err != nil {
+		return st, false
+	}
+	st.queued, _ = time.Parse(time.RFC3339Nano, sr.Queued)
+	st.dur, _ = time.ParseDuration(sr.Duration)
+	st.ready, _ = time.ParseDuration(sr.Ready)
+	return st, true
+}
+
+// Trace writes run in the Chrome Trace Event Format for Perfetto or
+// chrome://tracing. Each job slot is a lane holding the steps that ran in
+// it, with retried steps' attempts as child spans. Time spent waiting for a
+// job slot or an approval is shown as separate intervals, and the wait for
+// another run's lock precedes the run on its own lane. Services occupy a
+// slot until ready and then continue on a lane of their own.
+func Trace(w io.Writer, run *Run, _ Options) error {
+	res := run.Results
+	times := map[string]stepTimes{}
+	var first, last time.Time
+	extend := func(start time.Time, d time.Duration) {
+		if start.IsZero() {
+			return
+		}
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if end := start.Add(d); end.After(last) {
+			last = end
+		}
+	}
+	slots := 0
+	for _, sr := range res.Steps {
+		st, ok := parseStepTimes(sr)
+		if !ok {
+			continue
+		}
+		times[sr.ID] = st
+		extend(st.queued, 0)
+		extend(st.started, st.dur)
+		slots = max(slots, sr.Slot)
+	}
+
+	var runStart, runEnd time.Time
+	var lockWait time.Duration
+	if m := run.Meta; m != nil {
+		runStart = m.Started()
+		runEnd, _ = time.Parse(time.RFC3339Nano, m.FinishedAt)
+		lockWait, _ = time.ParseDuration(m.LockWait)
+		extend(runStart.Add(-lockWait), lockWait)
+		extend(runEnd, 0)
+	}
+	if runStart.IsZero() {
+		runStart = first
+	}
+	if runEnd.IsZero() {
+		runEnd = last
+	}
+
+	t := &tracer{base: first}
+	t.lane(0, "run")
+	for i := 1; i <= slots; i++ {
+		t.lane(i, fmt.Sprintf("job slot %d", i))
+	}
+
+	if !first.IsZero() {
+		if lockWait > 0 {
+			t.span(0, "lock", "waiting for runs lock", runStart.Add(-lockWait), lockWait, nil)
+		}
+		t.span(0, "run", run.name(), runStart, runEnd.Sub(runStart), map[string]any{
+			"run_id":   res.RunID,
+			"status":   res.Status,
+			"duration": res.Duration,
+		})
+	}
+
+	services := slots
+	for _, sr := range res.Steps {
+		st, ok := times[sr.ID]
+		if !ok {
+			continue
+		}
+		args := map[string]any{"status": sr.Status, "exit_code": sr.ExitCode, "attempts": sr.Attempt}
+		if sr.Error != "" {
+			args["error"] = sr.Error
+		}
+		if !st.queued.IsZero() && st.started.Sub(st.queued) >= minWait {
+			t.async("queue", sr.ID+": waiting for a job slot", sr.ID, st.queued, st.started.Sub(st.queued), nil)
+		}
+
+		switch {
+		case sr.Slot == 0:
+			// Approvals wait on a person rather than running in a slot.
+			if sr.Approval != nil {
+				args["by"] = sr.Approval.By
+			}
+			t.async("approval", sr.ID+": awaiting approval", sr.ID, st.started, st.dur, args)
+		case sr.Ready != "":
+			services++
+			t.lane(services, "service "+sr.ID)
+			t.span(sr.Slot, "service", sr.ID+" (starting)", st.started, st.ready, nil)
+			t.span(services, "service", sr.ID, st.started, st.dur, args)
+		default:
+			t.span(sr.Slot, "step", sr.ID, st.started, st.dur, args)
+			if len(sr.Attempts) > 1 {
+				for _, a := range sr.Attempts {
+					t.attempt(sr.Slot, a)
+				}
+			}
+		}
+	}
+
+	// Viewers expect metadata first and spans in start order, with a parent
+	// before the children it contains.
+	slices.SortStableFunc(t.events, func(a, b traceEvent) int {
+		am, bm := a.Ph == phaseMetadata, b.Ph == phaseMetadata
+		switch {
+		case am && !bm:
+			return -1
+		case bm && !am:
+			return 1
+		}
+		return cmp.Or(cmp.Compare(a.TS, b.TS), cmp.Compare(durOf(b), durOf(a)))
+	})
+
+	file := traceFile{
+		TraceEvents:     t.events,
+		DisplayTimeUnit: "ms",
+		OtherData:       map[string]string{"run_id": res.RunID, "status": res.Status},
+	}
+	if p := run.Plan; p != nil {
+		file.OtherData["project"] = p.ProjectName
+		file.OtherData["profile"] = p.Profile
+		file.OtherData["config_hash"] = p.ConfigHash
+	}
+	if !first.IsZero() {
+		file.OtherData["start"] = first.UTC().Format(time.RFC3339Nano)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(file); err != nil {
+		return fmt.Errorf("trace: %w", err)
+	}
+	return nil
+}
+
+// attempt adds one attempt of a retried step as a child span.
+func (t *tracer) attempt(tid int, a exec.AttemptResult) {
+	start, err := time.Parse(time.RFC3339Nano, a.Started)
+	if err != nil {
+		return
+	}
+	d, _ := time.ParseDuration(a.Duration)
+	args := map[string]any{"status": a.Status, "exit_code": a.ExitCode}
+	if a.Error != "" {
+		args["error"] = a.Error
+	}
+	t.span(tid, "attempt", fmt.Sprintf("attempt %d", a.Attempt), start, d, args)
+}
+
+func durOf(e traceEvent) int64 {
+	if e.Dur == nil {
+		return 0
+	}
+	return *e.Dur
+}
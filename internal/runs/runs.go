@@ -0,0 +1,203 @@
+// Package runs manages the per-run output directories under .foundry/runs:
+// run metadata, the latest run of each profile, listing and retention.
+package runs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// MetaFile is the name of the metadata file in each run directory.
+const MetaFile = "metadata.json"
+
+// TimeFormat is the RFC 3339 layout of run timestamps, with milliseconds so
+// run durations can be derived from them.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// latestPrefix names the per-profile pointers to the latest run.
+const latestPrefix = "latest-"
+
+// Meta describes a run. It is written when the run starts and updated when
+// it finishes.
+type Meta struct {
+	RunID      string `json:"run_id"`
+	Project    string `json:"project"`
+	Profile    string `json:"profile"`
+	ConfigHash string `json:"config_hash"`
+	Status     string `json:"status"` // running, then the execution status
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+	LockWait   string `json:"lock_wait,omitempty"` // time spent waiting for another run's lock before StartedAt
+	Hostname   string `json:"hostname,omitempty"`
+	User       string `json:"user,omitempty"`
+	Version    string `json:"anvil_version,omitempty"`
+	Command    string `json:"command,omitempty"`
+}
+
+// Started returns the run's start time, or the zero time if it is invalid.
+func (m Meta) Started() time.Time {
+	t, _ := time.Parse(time.RFC3339, m.StartedAt)
+	return t
+}
+
+// Dir returns the directory of runID under root.
+func Dir(root, runID string) string {
+	return filepath.Join(root, runID)
+}
+
+// WriteMeta writes m to the run's directory under root.
+func WriteMeta(root string, m *Meta) error {
+	if err := util.WriteJSON(filepath.Join(Dir(root, m.RunID), MetaFile), m); err != nil {
+		return fmt.Errorf("write run metadata: %w", err)
+	}
+	return nil
+}
+
+// Load returns the metadata of a run. ref is a run ID, "latest" for the most
+// recent run of any profile, or "latest-<profile>".
+func Load(root, ref string) (*Meta, error) {
+	runID, err := resolve(root, ref)
+	if err != nil {
+		return nil, err
+	}
+	var m Meta
+	if err := util.ReadJSON(filepath.Join(Dir(root, runID), MetaFile), &m); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("run %q not found", ref)
+		}
+		return nil, fmt.Errorf("load run %q: %w", ref, err)
+	}
+	return &m, nil
+}
+
+func resolve(root, ref string) (string, error) {
+	switch {
+	case ref == "latest":
+		all, err := List(root)
+		if err != nil {
+			return "", err
+		}
+		if len(all) == 0 {
+			return "", fmt.Errorf("no runs in %s", root)
+		}
+		return all[0].RunID, nil
+	case strings.HasPrefix(ref, latestPrefix):
+		return Latest(root, strings.TrimPrefix(ref, latestPrefix))
+	case ref == "" || strings.ContainsAny(ref, `/\`) || ref == "." || ref == "..":
+		return "", fmt.Errorf("invalid run id %q", ref)
+	}
+	return ref, nil
+}
+
+// List returns the metadata of all runs under root, newest first. Directories
+// without metadata are ignored.
+func List(root string) ([]Meta, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list runs: %w", err)
+	}
+
+	var all []Meta
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		var m Meta
+		if err := util.ReadJSON(filepath.Join(root, e.Name(), MetaFile), &m); err != nil {
+			continue
+		}
+		all = append(all, m)
+	}
+
+	// Run IDs start with their start time, so they sort chronologically.
+	slices.SortFunc(all, func(a, b Meta) int { return strings.Compare(b.RunID, a.RunID) })
+	return all, nil
+}
+
+// SetLatest points the latest run of profile at runID. The pointer is a
+// symlink named latest-<profile>, or a file holding the run ID where
+// symlinks are unavailable.
+func SetLatest(root, profile, runID string) error {
+	link := filepath.Join(root, latestPrefix+profile)
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+
+	if err := os.Symlink(runID, tmp); err != nil {
+		if err := os.WriteFile(tmp, []byte(runID+"\n"), 0o644); err != nil {
+			return fmt.Errorf("set latest run: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("set latest run: %w", err)
+	}
+	return nil
+}
+
+// Latest returns the ID of the latest run of profile.
+func Latest(root, profile string) (string, error) {
+	link := filepath.Join(root, latestPrefix+profile)
+	if target, err := os.Readlink(link); err == nil {
+		return filepath.Base(target), nil
+	}
+	data, err := os.ReadFile(link)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("profile %q has no runs", profile)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read latest run: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Retention limits the runs kept per profile; see config.Retention.
+type Retention struct {
+	KeepRuns int // newest runs kept per profile; 0 keeps all
+	KeepDays int // maximum age in days; 0 means no limit
+}
+
+// Prune removes the run directories of each profile that fall outside r,
+// and returns the removed run IDs. The latest run of each profile and any run
+// for which keep returns true are never removed.
+func Prune(root string, r Retention, now time.Time, keep func(runID string) bool) ([]string, error) {
+	all, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Time{}
+	if r.KeepDays > 0 {
+		cutoff = now.Add(-time.Duration(r.KeepDays) * 24 * time.Hour)
+	}
+
+	var removed []string
+	seen := make(map[string]int) // runs seen per profile, newest first
+	for _, m := range all {
+		n := seen[m.Profile]
+		seen[m.Profile]++
+
+		expired := (r.KeepRuns > 0 && n >= r.KeepRuns) || (!cutoff.IsZero() && m.Started().Before(cutoff))
+		if !expired || (keep != nil && keep(m.RunID)) {
+			continue
+		}
+		if latest, err := Latest(root, m.Profile); err == nil && latest == m.RunID {
+			continue
+		}
+		if err := os.RemoveAll(Dir(root, m.RunID)); err != nil {
+			return removed, fmt.Errorf("prune run %s: %w", m.RunID, err)
+		}
+		removed = append(removed, m.RunID)
+	}
+	return removed, nil
+}
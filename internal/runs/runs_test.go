@@ -0,0 +1,120 @@
+package runs
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeRun(t *testing.T, root, runID, profile string, started time.Time) {
+	t.Helper()
+	m := &Meta{RunID: runID, Profile: profile, Status: "success", StartedAt: started.UTC().Format(time.RFC3339)}
+	if err := WriteMeta(root, m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runIDs(all []Meta) []string {
+	var ids []string
+	for _, m := range all {
+		ids = append(ids, m.RunID)
+	}
+	return ids
+}
+
+// TestListAndLatest verifies runs are listed newest first and resolved
+// through run IDs and latest pointers.
+func TestListAndLatest(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if all, err := List(root + "/missing"); err != nil || len(all) != 0 {
+		t.Errorf("expected no runs in a missing directory, got %v (err %v)", all, err)
+	}
+
+	now := time.Now()
+	writeRun(t, root, "20260101T000000Z-aaaaaa", "default", now)
+	writeRun(t, root, "20260102T000000Z-bbbbbb", "release", now)
+	writeRun(t, root, "20260103T000000Z-cccccc", "default", now)
+	if err := os.Mkdir(root+"/not-a-run", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := List(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20260103T000000Z-cccccc", "20260102T000000Z-bbbbbb", "20260101T000000Z-aaaaaa"}
+	if got := runIDs(all); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if err := SetLatest(root, "default", "20260101T000000Z-aaaaaa"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLatest(root, "default", "20260103T000000Z-cccccc"); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, id := range map[string]string{
+		"latest":                  "20260103T000000Z-cccccc",
+		"latest-default":          "20260103T000000Z-cccccc",
+		"20260102T000000Z-bbbbbb": "20260102T000000Z-bbbbbb",
+	} {
+		m, err := Load(root, ref)
+		if err != nil || m.RunID != id {
+			t.Errorf("Load(%q): expected %s, got %+v (err %v)", ref, id, m, err)
+		}
+	}
+
+	if _, err := Load(root, "latest-release"); err == nil {
+		t.Error("expected error for profile without latest pointer")
+	}
+	if _, err := Load(root, "../etc"); err == nil {
+		t.Error("expected error for run ID with path separators")
+	}
+}
+
+// TestPrune verifies count and age retention per profile, sparing the
+// latest run and runs the caller wants kept.
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	now := time.Now()
+	day := 24 * time.Hour
+	writeRun(t, root, "20260101T000000Z-000001", "default", now.Add(-10*day))
+	writeRun(t, root, "20260102T000000Z-000002", "default", now.Add(-3*day))
+	writeRun(t, root, "20260103T000000Z-000003", "default", now.Add(-2*day-time.Hour))
+	writeRun(t, root, "20260104T000000Z-000004", "default", now.Add(-1*day))
+	writeRun(t, root, "20260101T000000Z-100001", "release", now.Add(-30*day))
+
+	// The old release run is its profile's latest, so it survives any limit.
+	if err := SetLatest(root, "release", "20260101T000000Z-100001"); err != nil {
+		t.Fatal(err)
+	}
+
+	keep := func(id string) bool { return id == "20260101T000000Z-000001" }
+	removed, err := Prune(root, Retention{KeepRuns: 2}, now, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20260102T000000Z-000002"}; !slices.Equal(removed, want) {
+		t.Errorf("expected %v removed, got %v", want, removed)
+	}
+
+	removed, err = Prune(root, Retention{KeepDays: 2, KeepRuns: 10}, now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20260103T000000Z-000003", "20260101T000000Z-000001"}
+	if !slices.Equal(removed, want) {
+		t.Errorf("expected %v removed, got %v", want, removed)
+	}
+
+	all, _ := List(root)
+	if got := runIDs(all); !slices.Equal(got, []string{"20260104T000000Z-000004", "20260101T000000Z-100001"}) {
+		t.Errorf("unexpected remaining runs %v", got)
+	}
+}
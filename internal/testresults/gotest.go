@@ -0,0 +1,109 @@
+package testresults
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// goTestEvent is one line of "go test -json" output (see "go doc test2json").
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// ParseGoTestJSON reads the output of "go test -json". Lines that are not
+// JSON, such as build errors written to the same file, are ignored. A
+// package that fails without a failing test (a build failure, or a panic
+// outside any test) is reported as a failed case named after the package.
+// Tests with subtests are reported through their subtests.
+func ParseGoTestJSON(r io.Reader) ([]Case, error) {
+	type key struct{ pkg, test string }
+	var (
+		order  []key
+		output = map[key]*strings.Builder{}
+		cases  = map[key]*Case{}
+		failed = map[string]bool{} // packages with a failed test
+	)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var ev goTestEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+
+		k := key{ev.Package, ev.Test}
+		switch ev.Action {
+		case "output":
+			b, ok := output[k]
+			if !ok {
+				b = &strings.Builder{}
+				output[k] = b
+			}
+			b.WriteString(ev.Output)
+		case "pass", "fail", "skip":
+			status := map[string]string{"pass": Passed, "fail": Failed, "skip": Skipped}[ev.Action]
+			if ev.Test == "" {
+				// Package results only matter when no test explains them.
+				if status != Failed || failed[ev.Package] {
+					continue
+				}
+				k.test = ev.Package
+			} else if status == Failed {
+				failed[ev.Package] = true
+			}
+			if _, seen := cases[k]; !seen {
+				order = append(order, k)
+			}
+			cases[k] = &Case{Name: k.test, Suite: ev.Package, Status: status, Duration: duration(ev.Elapsed)}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// A test with subtests fails when any of them does, so only the
+	// subtests are counted, unless the test failed with none of them
+	// failing, which was its own doing.
+	parents := map[key]bool{}
+	failedSubtests := map[key]bool{}
+	for _, k := range order {
+		for i := strings.LastIndexByte(k.test, '/'); i > 0; i = strings.LastIndexByte(k.test[:i], '/') {
+			parent := key{k.pkg, k.test[:i]}
+			parents[parent] = true
+			if cases[k].Status == Failed {
+				failedSubtests[parent] = true
+			}
+		}
+	}
+
+	result := make([]Case, 0, len(order))
+	for _, k := range order {
+		c := cases[k]
+		if parents[k] && (c.Status != Failed || failedSubtests[k]) {
+			continue
+		}
+		if c.Status == Failed {
+			src := k
+			if c.Name == c.Suite {
+				src.test = ""
+			}
+			if b, ok := output[src]; ok {
+				c.Output = truncate(b.String())
+			}
+		}
+		result = append(result, *c)
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package testresults
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// junitSuite is the subset of a JUnit <testsuite> (or <testsuites>, which
+// has the same shape for our purposes) read from reports. Suites may nest.
+type junitSuite struct {
+	Name   string          `xml:"name,attr"`
+	Suites []junitSuite    `xml:"testsuite"`
+	Cases  []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out"`
+	SystemErr string        `xml:"system-err"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// ParseJUnit reads a JUnit XML report whose root is either <testsuites> or
+// a single <testsuite>. Errors count as failures.
+func ParseJUnit(r io.Reader) ([]Case, error) {
+	var root junitSuite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	var cases []Case
+	collectJUnit(root, &cases)
+	return cases, nil
+}
+
+func collectJUnit(s junitSuite, cases *[]Case) {
+	for _, tc := range s.Cases {
+		c := Case{Name: tc.Name, Suite: tc.Classname, Status: Passed}
+		if c.Suite == "" {
+			c.Suite = s.Name
+		}
+		if secs, err := strconv.ParseFloat(tc.Time, 64); err == nil {
+			c.Duration = duration(secs)
+		}
+
+		switch fail := tc.Failure; {
+		case fail != nil || tc.Error != nil:
+			if fail == nil {
+				fail = tc.Error
+			}
+			c.Status = Failed
+			var out []string
+			text := strings.TrimSpace(fail.Text)
+			if msg := strings.TrimSpace(fail.Message); msg != "" && !strings.Contains(text, msg) {
+				out = append(out, msg)
+			}
+			for _, p := range []string{text, tc.SystemOut, tc.SystemErr} {
+				if p = strings.TrimSpace(p); p != "" {
+					out = append(out, p)
+				}
+			}
+			c.Output = truncate(strings.Join(out, "\n"))
+		case tc.Skipped != nil:
+			c.Status = Skipped
+		}
+		*cases = append(*cases, c)
+	}
+	for _, child := range s.Suites {
+		collectJUnit(child, cases)
+	}
+}
@@ -0,0 +1,177 @@
+// Package testresults reads the test reports steps produce, such as the
+// output of "go test -json" or JUnit XML, into per-test outcomes.
+package testresults
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Formats lists the supported report formats.
+var Formats = []string{"go-test-json", "junit"}
+
+// Test outcomes.
+const (
+	Passed  = "passed"
+	Failed  = "failed"
+	Skipped = "skipped"
+)
+
+// maxOutput bounds the failure output kept per test; longer output keeps its
+// tail, where the failure usually is.
+const maxOutput = 8 << 10
+
+// Case is the outcome of a single test.
+type Case struct {
+	Name     string `json:"name"`
+	Suite    string `json:"suite,omitempty"` // Go package or JUnit suite/class
+	Status   string `json:"status"`          // passed, failed, skipped
+	Duration string `json:"duration,omitempty"`
+	Output   string `json:"output,omitempty"` // failure output; set for failed tests
+}
+
+// Summary is the combined outcome of the tests reported by a step.
+type Summary struct {
+	Total   int      `json:"total"`
+	Passed  int      `json:"passed"`
+	Failed  int      `json:"failed"`
+	Skipped int      `json:"skipped"`
+	Files   []string `json:"files"`
+	Cases   []Case   `json:"cases"`
+}
+
+// maxNames is how many failed tests String names before eliding the rest.
+const maxNames = 5
+
+// String describes the summary in one line, e.g.
+// "3 of 812 tests failed: TestX, TestY, TestZ".
+func (s *Summary) String() string {
+	if s.Failed == 0 {
+		msg := fmt.Sprintf("%d tests passed", s.Passed)
+		if s.Skipped > 0 {
+			msg += fmt.Sprintf(", %d skipped", s.Skipped)
+		}
+		return msg
+	}
+
+	names := s.FailedNames()
+	more := ""
+	if len(names) > maxNames {
+		names, more = names[:maxNames], ", ..."
+	}
+	return fmt.Sprintf("%d of %d tests failed: %s%s", s.Failed, s.Total, strings.Join(names, ", "), more)
+}
+
+// FailedNames returns the names of the failed tests in report order.
+func (s *Summary) FailedNames() []string {
+	var names []string
+	for _, c := range s.Cases {
+		if c.Status == Failed {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func (s *Summary) add(cases []Case) {
+	for _, c := range cases {
+		s.Total++
+		switch c.Status {
+		case Passed:
+			s.Passed++
+		case Failed:
+			s.Failed++
+		case Skipped:
+			s.Skipped++
+		}
+	}
+	s.Cases = append(s.Cases, cases...)
+}
+
+// Collect parses the reports matching each format's glob pattern. Files
+// last modified before since are left out, so a report left behind by an
+// earlier run is not mistaken for this one's. It returns nil if no report
+// was found; files that fail to parse are reported in the error, alongside
+// whatever could be read from the others.
+func Collect(reports map[string]string, since time.Time) (*Summary, error) {
+	formats := make([]string, 0, len(reports))
+	for format := range reports {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+
+	var sum *Summary
+	var errs []error
+	for _, format := range formats {
+		files, err := filepath.Glob(reports[format])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", format, err))
+			continue
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil || info.IsDir() || info.ModTime().Before(since) {
+				continue
+			}
+			cases, err := ParseFile(format, file)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if sum == nil {
+				sum = &Summary{}
+			}
+			sum.Files = append(sum.Files, file)
+			sum.add(cases)
+		}
+	}
+	return sum, errors.Join(errs...)
+}
+
+// ParseFile reads the test cases from a report file in format.
+func ParseFile(format, path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var cases []Case
+	switch format {
+	case "go-test-json":
+		cases, err = ParseGoTestJSON(f)
+	case "junit":
+		cases, err = ParseJUnit(f)
+	default:
+		return nil, fmt.Errorf("parse %s: unknown report format %q", path, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return cases, nil
+}
+
+// duration formats a number of seconds like the durations in run results.
+func duration(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Microsecond).String()
+}
+
+// truncate keeps the tail of output within maxOutput.
+func truncate(output string) string {
+	if len(output) <= maxOutput {
+		return output
+	}
+	tail := output[len(output)-maxOutput:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	return "...\n" + tail
+}
@@ -0,0 +1,170 @@
+package testresults
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseGoTestJSON verifies test outcomes, durations and failure output,
+// including a package that failed to build.
+func TestParseGoTestJSON(t *testing.T) {
+	t.Parallel()
+
+	cases, err := ParseFile("go-test-json", filepath.Join("testdata", "gotest.json"))
+	if err != nil {
+		t.Fatalf("ParseFile failed: %v", err)
+	}
+
+	want := []Case{
+		{Name: "TestAdd", Suite: "example.com/calc", Status: Passed, Duration: "10ms"},
+		{Name: "TestDiv", Suite: "example.com/calc", Status: Failed, Duration: "250ms"},
+		{Name: "TestMod", Suite: "example.com/calc", Status: Skipped},
+		{Name: "example.com/broken", Suite: "example.com/broken", Status: Failed},
+	}
+	if len(cases) != len(want) {
+		t.Fatalf("expected %d cases, got %d: %+v", len(want), len(cases), cases)
+	}
+	for i, w := range want {
+		got := cases[i]
+		got.Output = ""
+		if got != w {
+			t.Errorf("case %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+	if !strings.Contains(cases[1].Output, "calc_test.go:12: got 0, want 2") {
+		t.Errorf("expected TestDiv failure output, got %q", cases[1].Output)
+	}
+	if !strings.Contains(cases[3].Output, "[build failed]") {
+		t.Errorf("expected build failure output, got %q", cases[3].Output)
+	}
+	if cases[0].Output != "" || cases[2].Output != "" {
+		t.Error("expected output only for failed tests")
+	}
+}
+
+// TestParseGoTestJSON_Subtests verifies that a test failing because of its
+// subtests is reported through them, while one failing by itself is kept.
+func TestParseGoTestJSON_Subtests(t *testing.T) {
+	t.Parallel()
+
+	cases, err := ParseFile("go-test-json", filepath.Join("testdata", "subtests.json"))
+	if err != nil {
+		t.Fatalf("ParseFile failed: %v", err)
+	}
+
+	var got []string
+	for _, c := range cases {
+		got = append(got, c.Name+" "+c.Status)
+	}
+	want := []string{"TestSplit/comma passed", "TestSplit/empty failed", "TestTrim/space passed", "TestTrim failed"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if !strings.Contains(cases[1].Output, `got [""], want []`) {
+		t.Errorf("expected TestSplit/empty failure output, got %q", cases[1].Output)
+	}
+	if !strings.Contains(cases[3].Output, "setup failed") {
+		t.Errorf("expected TestTrim failure output, got %q", cases[3].Output)
+	}
+}
+
+// TestParseJUnit verifies nested suites, failures, errors and skips.
+func TestParseJUnit(t *testing.T) {
+	t.Parallel()
+
+	cases, err := ParseFile("junit", filepath.Join("testdata", "junit.xml"))
+	if err != nil {
+		t.Fatalf("ParseFile failed: %v", err)
+	}
+	if len(cases) != 4 {
+		t.Fatalf("expected 4 cases, got %d: %+v", len(cases), cases)
+	}
+
+	byName := map[string]Case{}
+	for _, c := range cases {
+		byName[c.Name] = c
+	}
+	if c := byName["creates user"]; c.Status != Passed || c.Suite != "api.UserTest" || c.Duration != "120ms" {
+		t.Errorf("unexpected passing case: %+v", c)
+	}
+	if c := byName["deletes user"]; c.Status != Failed || c.Output != "expected 204\n  at UserTest.java:42" {
+		t.Errorf("unexpected failed case: %+v", c)
+	}
+	if c := byName["connects"]; c.Status != Failed || c.Suite != "api" || c.Output != "connection refused\ndialing db:5432" {
+		t.Errorf("expected error counted as failure, got %+v", c)
+	}
+	if c := byName["slow path"]; c.Status != Skipped {
+		t.Errorf("expected skipped case, got %+v", c)
+	}
+}
+
+// TestCollect verifies globbing, totals, the one-line summary and that stale
+// reports are ignored.
+func TestCollect(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"gotest.json", "junit.xml"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale := filepath.Join(dir, "old.xml")
+	if err := os.WriteFile(stale, []byte("<testsuite><testcase name=\"old\"/></testsuite>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := Collect(map[string]string{
+		"go-test-json": filepath.Join(dir, "*.json"),
+		"junit":        filepath.Join(dir, "*.xml"),
+	}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if sum.Total != 8 || sum.Passed != 2 || sum.Failed != 4 || sum.Skipped != 2 || len(sum.Files) != 2 {
+		t.Errorf("unexpected totals: %+v", sum)
+	}
+	want := "4 of 8 tests failed: TestDiv, example.com/broken, deletes user, connects"
+	if got := sum.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	none, err := Collect(map[string]string{"junit": filepath.Join(dir, "missing-*.xml")}, time.Time{})
+	if none != nil || err != nil {
+		t.Errorf("expected no summary without reports, got %+v, %v", none, err)
+	}
+
+	if _, err := Collect(map[string]string{"junit": filepath.Join(dir, "gotest.json")}, time.Time{}); err == nil {
+		t.Error("expected parse error for a malformed report")
+	}
+}
+
+// TestSummary_String verifies passing summaries and elided failure lists.
+func TestSummary_String(t *testing.T) {
+	t.Parallel()
+
+	pass := &Summary{Total: 10, Passed: 9, Skipped: 1}
+	if got := pass.String(); got != "9 tests passed, 1 skipped" {
+		t.Errorf("unexpected summary %q", got)
+	}
+
+	fail := &Summary{}
+	for _, name := range []string{"A", "B", "C", "D", "E", "F"} {
+		fail.add([]Case{{Name: "Test" + name, Status: Failed}})
+	}
+	fail.add([]Case{{Name: "TestOK", Status: Passed}})
+	if got := fail.String(); got != "6 of 7 tests failed: TestA, TestB, TestC, TestD, TestE, ..." {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
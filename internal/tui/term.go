@@ -0,0 +1,11 @@
+package tui
+
+import "os"
+
+// IsTerminal reports whether f is connected to a terminal, which on every
+// platform shows up as a character device. Only the dashboard's raw mode is
+// platform-specific; approval prompts need nothing more than this.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package tui
+
+import (
+	"fmt"
+	"os"
+)
+
+// makeRaw fails outside Linux, where the interactive view is not
+// implemented, so Dashboard.Start fails and anvil keeps plain output.
+func makeRaw(*os.File) (func(), error) {
+	return nil, fmt.Errorf("raw terminal mode is only supported on linux")
+}
+
+func termSize(*os.File) (int, int) {
+	return 80, 24
+}
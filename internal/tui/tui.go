@@ -0,0 +1,369 @@
+// Package tui renders a live, full-screen progress view of a Foundry run on
+// an interactive terminal.
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+const refreshInterval = 100 * time.Millisecond
+
+// Options configures a Dashboard.
+type Options struct {
+	Title     string          // Header text, e.g. "project / profile"
+	Canceller *exec.Canceller // Used by the cancel-step key
+	Abort     func()          // Called on Ctrl-C to cancel the whole run
+}
+
+// stepView is the dashboard's picture of one step.
+type stepView struct {
+	started    time.Time
+	result     *exec.StepResult
+	id         string
+	state      exec.StepState
+	logFile    string
+	deps       []string
+	attempt    int
+	cancelling bool
+}
+
+// Dashboard tracks step events and draws them as a status table with the
+// log tail of the selected step. Feed it events through Handle (suitable as
+// exec.Options.OnEvent) and drive the terminal with Start and Stop.
+type Dashboard struct {
+	opts     Options
+	start    time.Time
+	now      func() time.Time
+	steps    map[string]*stepView
+	out      *os.File
+	restore  func()
+	stop     chan struct{}
+	done     chan struct{}
+	order    []string
+	mu       sync.Mutex
+	selected int
+	manual   bool // selection was moved by the user
+	viewing  bool // full-screen log view is open
+}
+
+// New returns a Dashboard for the steps of p.
+func New(p *plan.Plan, opts Options) *Dashboard {
+	d := &Dashboard{
+		opts:  opts,
+		start: time.Now(),
+		now:   time.Now,
+		steps: make(map[string]*stepView, len(p.Steps)),
+		order: p.Order,
+	}
+	for _, s := range p.Steps {
+		d.steps[s.ID] = &stepView{id: s.ID, deps: s.Deps}
+	}
+	return d
+}
+
+// Handle records a step event. It is safe for concurrent use.
+func (d *Dashboard) Handle(ev exec.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sv, ok := d.steps[ev.StepID]
+	if !ok {
+		return
+	}
+	sv.state = ev.State
+	switch ev.State {
+	case exec.StateRunning:
+		if sv.started.IsZero() {
+			sv.started = ev.Time
+		}
+		sv.attempt = ev.Attempt
+		sv.logFile = ev.LogFile
+	case exec.StateDone:
+		sv.result = ev.Result
+		if ev.Result != nil && ev.Result.LogFile != "" {
+			sv.logFile = ev.Result.LogFile
+		}
+	}
+}
+
+// Start switches the terminal to raw mode and the alternate screen, then
+// redraws periodically and reads keys from in until Stop is called.
+func (d *Dashboard) Start(in, out *os.File) error {
+	restore, err := makeRaw(in)
+	if err != nil {
+		return fmt.Errorf("tui: %w", err)
+	}
+	d.restore = restore
+	d.out = out
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+
+	_, _ = io.WriteString(out, "\x1b[?1049h\x1b[?25l")
+
+	go d.readKeys(in)
+	go d.drawLoop()
+	return nil
+}
+
+// Stop halts redrawing and restores the terminal.
+func (d *Dashboard) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	<-d.done
+	_, _ = io.WriteString(d.out, "\x1b[?25h\x1b[?1049l")
+	d.restore()
+}
+
+func (d *Dashboard) drawLoop() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		d.draw()
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *Dashboard) draw() {
+	width, height := termSize(d.out)
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	d.render(&buf, width, height)
+	buf.WriteString("\x1b[J")
+	_, _ = d.out.Write(buf.Bytes())
+}
+
+// readKeys turns raw terminal input into key presses. Reads block, so this
+// goroutine may outlive Stop until the next key or process exit.
+func (d *Dashboard) readKeys(in *os.File) {
+	buf := make([]byte, 32)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+		d.handleInput(buf[:n])
+	}
+}
+
+// handleInput interprets one read of raw terminal input.
+func (d *Dashboard) handleInput(b []byte) {
+	switch {
+	case bytes.Equal(b, []byte("\x1b[A")):
+		d.handleKey("up")
+	case bytes.Equal(b, []byte("\x1b[B")):
+		d.handleKey("down")
+	case len(b) == 1:
+		switch b[0] {
+		case 0x03:
+			d.handleKey("ctrl-c")
+		case '\r', '\n':
+			d.handleKey("enter")
+		case 0x1b, 0x7f:
+			d.handleKey("back")
+		default:
+			d.handleKey(string(b))
+		}
+	}
+}
+
+func (d *Dashboard) handleKey(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch key {
+	case "up", "k":
+		if d.selected > 0 {
+			d.selected--
+		}
+		d.manual = true
+	case "down", "j":
+		if d.selected < len(d.order)-1 {
+			d.selected++
+		}
+		d.manual = true
+	case "enter", "l":
+		d.viewing = true
+		d.manual = true
+	case "back", "q", "h":
+		d.viewing = false
+	case "c":
+		if len(d.order) == 0 {
+			return
+		}
+		sv := d.steps[d.currentLocked()]
+		if sv.state != exec.StateDone && !sv.cancelling {
+			sv.cancelling = true
+			d.opts.Canceller.Cancel(sv.id)
+		}
+	case "ctrl-c":
+		if d.opts.Abort != nil {
+			d.opts.Abort()
+		}
+	}
+}
+
+// currentLocked returns the ID of the selected step. Until the user moves the
+// selection it follows the first running step.
+func (d *Dashboard) currentLocked() string {
+	if !d.manual {
+		for i, id := range d.order {
+			if d.steps[id].state == exec.StateRunning {
+				d.selected = i
+				break
+			}
+		}
+	}
+	return d.order[d.selected]
+}
+
+// render draws one frame of at most height lines of width columns.
+func (d *Dashboard) render(w io.Writer, width, height int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var lines []string
+	if len(d.order) == 0 {
+		lines = append(lines, "no steps")
+		writeLines(w, lines, width)
+		return
+	}
+	current := d.steps[d.currentLocked()]
+
+	if d.viewing {
+		lines = append(lines, fmt.Sprintf("log: %s  %s", current.id, current.logFile), "")
+		lines = append(lines, readTail(current.logFile, max(height-4, 1))...)
+		for len(lines) < height-1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "esc back  c cancel step  ctrl-c abort run")
+		writeLines(w, lines, width)
+		return
+	}
+
+	done := 0
+	for _, sv := range d.steps {
+		if sv.state == exec.StateDone {
+			done++
+		}
+	}
+	header := fmt.Sprintf("anvil run  %s  %s elapsed  %d/%d done", d.opts.Title, roundDuration(d.now().Sub(d.start)), done, len(d.order))
+	lines = append(lines, header, "", fmt.Sprintf("   %-12s %-24s %s", "STATUS", "STEP", "TIME"))
+
+	for i, id := range d.order {
+		cursor := " "
+		if i == d.selected {
+			cursor = ">"
+		}
+		lines = append(lines, fmt.Sprintf(" %s %s", cursor, d.row(d.steps[id])))
+	}
+
+	tailHeight := height - len(lines) - 4
+	if tailHeight > 0 {
+		lines = append(lines, "", fmt.Sprintf("── %s %s", current.id, current.logFile))
+		lines = append(lines, readTail(current.logFile, tailHeight)...)
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "↑/↓ select  enter open log  c cancel step  ctrl-c abort run")
+	writeLines(w, lines, width)
+}
+
+// row formats one line of the status table.
+func (d *Dashboard) row(sv *stepView) string {
+	var status, elapsed string
+	switch sv.state {
+	case exec.StateWaiting:
+		var pending []string
+		for _, dep := range sv.deps {
+			if dsv, ok := d.steps[dep]; ok && dsv.state != exec.StateDone {
+				pending = append(pending, dep)
+			}
+		}
+		status, elapsed = "◌ waiting", "on "+strings.Join(pending, ", ")
+	case exec.StateRunning:
+		status = "▶ running"
+		elapsed = roundDuration(d.now().Sub(sv.started)).String()
+		if sv.attempt > 1 {
+			elapsed += fmt.Sprintf(" (attempt %d)", sv.attempt)
+		}
+	case exec.StateDone:
+		status = "✓ done"
+		if sv.result != nil {
+			switch sv.result.Status {
+			case "failed":
+				status = "✗ failed"
+			case "skipped":
+				status = "- skipped"
+				elapsed = sv.result.Error
+			case "pending":
+				status = "? approval"
+				elapsed = sv.result.Error
+			}
+			if elapsed == "" {
+				if dur, err := time.ParseDuration(sv.result.Duration); err == nil {
+					elapsed = roundDuration(dur).String()
+				}
+			}
+		}
+	default:
+		status = "· queued"
+	}
+	if sv.cancelling && sv.state != exec.StateDone {
+		status = "⊘ cancelling"
+	}
+	return fmt.Sprintf("%-12s %-24s %s", status, sv.id, elapsed)
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(100 * time.Millisecond)
+}
+
+// writeLines writes each line truncated to width, clearing the remainder of
+// the terminal row.
+func writeLines(w io.Writer, lines []string, width int) {
+	for i, line := range lines {
+		if r := []rune(line); len(r) > width {
+			line = string(r[:width])
+		}
+		sep := "\x1b[K\n"
+		if i == len(lines)-1 {
+			sep = "\x1b[K"
+		}
+		_, _ = io.WriteString(w, line+sep)
+	}
+}
+
+// readTail returns util.TailLines with tabs expanded to four spaces, as
+// the terminal would otherwise move the cursor past the pane's width.
+func readTail(path string, n int) []string {
+	lines := util.TailLines(path, n)
+	for i, line := range lines {
+		lines[i] = strings.ReplaceAll(line, "\t", "    ")
+	}
+	return lines
+}
@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/exec"
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+func testPlan() *plan.Plan {
+	return &plan.Plan{
+		Steps: []plan.Step{
+			{ID: "lint"},
+			{ID: "test", Deps: []string{"lint"}},
+			{ID: "docs"},
+		},
+		Order: []string{"docs", "lint", "test"},
+	}
+}
+
+// TestDashboard_Render verifies the status table and the log tail of the running step.
+func TestDashboard_Render(t *testing.T) {
+	t.Parallel()
+
+	logFile := filepath.Join(t.TempDir(), "lint.1.log")
+	if err := os.WriteFile(logFile, []byte("line one\n\x1b[31mline two\x1b[0m\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(testPlan(), Options{Title: "proj / default"})
+	start := time.Now()
+	d.now = func() time.Time { return start.Add(2 * time.Second) }
+
+	d.Handle(exec.Event{StepID: "docs", State: exec.StateDone, Result: &exec.StepResult{ID: "docs", Status: "success", Duration: "1.23s"}})
+	d.Handle(exec.Event{StepID: "lint", State: exec.StateRunning, Time: start, Attempt: 1, LogFile: logFile})
+	d.Handle(exec.Event{StepID: "test", State: exec.StateWaiting})
+
+	var buf bytes.Buffer
+	d.render(&buf, 120, 20)
+	out := buf.String()
+
+	for _, want := range []string{
+		"1/3 done",
+		"✓ done       docs                     1.2s",
+		"▶ running    lint                     2s",
+		"◌ waiting    test                     on lint",
+		"line two",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected frame to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "\x1b[31m") {
+		t.Error("expected escape sequences from the log to be stripped")
+	}
+}
+
+// TestDashboard_Keys verifies selection, log view, single-step cancel and abort.
+func TestDashboard_Keys(t *testing.T) {
+	t.Parallel()
+
+	aborted := false
+	d := New(testPlan(), Options{Canceller: exec.NewCanceller(), Abort: func() { aborted = true }})
+	d.Handle(exec.Event{StepID: "lint", State: exec.StateRunning, Time: time.Now(), Attempt: 1})
+
+	// Selection follows the running step until the user moves it.
+	d.handleKey("c")
+	if !d.steps["lint"].cancelling {
+		t.Error("expected cancel key to cancel the running step")
+	}
+
+	d.handleInput([]byte("\x1b[B"))
+	if got := d.currentLocked(); got != "test" {
+		t.Errorf("expected selection to move to test, got %q", got)
+	}
+
+	d.handleInput([]byte("\r"))
+	if !d.viewing {
+		t.Error("expected enter to open the log view")
+	}
+	d.handleInput([]byte("\x1b"))
+	if d.viewing {
+		t.Error("expected escape to close the log view")
+	}
+
+	d.handleInput([]byte{0x03})
+	if !aborted {
+		t.Error("expected ctrl-c to abort the run")
+	}
+}
+
+// TestReadTail verifies that only the requested number of trailing lines is returned.
+func TestReadTail(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "step.log")
+	if err := os.WriteFile(path, []byte("a\nb\nc\nd\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTail(path, 2); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("expected [c d], got %v", got)
+	}
+
+	if got := readTail(filepath.Join(t.TempDir(), "missing.log"), 2); got != nil {
+		t.Errorf("expected nil for missing log, got %v", got)
+	}
+}
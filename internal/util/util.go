@@ -2,14 +2,19 @@
 package util
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -18,6 +23,16 @@ func NowUTC() string {
 	return time.Now().UTC().Format(time.RFC3339)
 }
 
+// NewRunID returns a new run identifier. IDs start with the UTC start time
+// in milliseconds so they sort chronologically, followed by a random suffix
+// to keep runs started at the same instant apart, e.g.
+// "20261018T150405.123Z-3fa9c1".
+func NewRunID() string {
+	var suffix [3]byte
+	_, _ = rand.Read(suffix[:])
+	return time.Now().UTC().Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix[:])
+}
+
 // CanonicalHash computes the SHA-256 hash of canonicalized JSON data.
 // Canonicalization ensures deterministic hashing by unmarshaling and
 // re-marshaling with sorted object keys (Go's json.Marshal sorts map keys).
@@ -138,3 +153,86 @@ func ReadJSON(path string, v interface{}) error {
 
 	return nil
 }
+
+// tailBytes is how much of a file TailLines reads to find its last lines.
+const tailBytes = 64 * 1024
+
+// ansiSeq matches terminal escape sequences, such as colours in step output.
+var ansiSeq = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// StripANSI removes terminal escape sequences and carriage returns from s.
+func StripANSI(s string) string {
+	return strings.ReplaceAll(ansiSeq.ReplaceAllString(s, ""), "\r", "")
+}
+
+// TailLines returns up to n trailing lines of the file at path with escape
+// sequences stripped, reading at most its last 64 KiB. It returns nil if the
+// file cannot be read.
+func TailLines(path string, n int) []string {
+	if path == "" || n <= 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	offset := max(info.Size()-tailBytes, 0)
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil
+	}
+
+	text := strings.TrimRight(StripANSI(string(buf)), "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// MatchPath reports whether a slash-separated relative path matches a glob
+// pattern. Patterns use path.Match syntax per segment, plus "**" to match
+// zero or more whole segments; a trailing slash matches everything below a
+// directory. Malformed patterns never match.
+func MatchPath(pattern, name string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	name = strings.TrimPrefix(filepath.ToSlash(name), "./")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, segs []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := range len(segs) + 1 {
+				if matchSegments(rest, segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segs[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segs = pattern[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,6 +27,24 @@ func TestNowUTC_Format(t *testing.T) {
 	}
 }
 
+// TestNewRunID verifies that run IDs are unique and sort by start time.
+func TestNewRunID(t *testing.T) {
+	t.Parallel()
+
+	a, b := NewRunID(), NewRunID()
+	if a == b {
+		t.Errorf("expected distinct run IDs, got %q twice", a)
+	}
+
+	stamp, _, ok := strings.Cut(a, "-")
+	if !ok {
+		t.Fatalf("expected <time>-<suffix>, got %q", a)
+	}
+	if _, err := time.Parse("20060102T150405.000Z", stamp); err != nil {
+		t.Errorf("expected run ID to start with a UTC timestamp, got %q: %v", a, err)
+	}
+}
+
 // TestCanonicalHash_Deterministic verifies that hashing the same input always produces the same hash.
 func TestCanonicalHash_Deterministic(t *testing.T) {
 	t.Parallel()
@@ -285,3 +304,32 @@ func TestWriteJSON_CreatesParentDirs(t *testing.T) {
 		t.Fatalf("file was not created: %v", err)
 	}
 }
+
+// TestMatchPath verifies glob matching with ** segments and directory prefixes.
+func TestMatchPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/anvil/main.go", true},
+		{"internal/**", "internal/exec/executor.go", true},
+		{"internal/**/*_test.go", "internal/exec/executor_test.go", true},
+		{"internal/**/*_test.go", "internal/exec/executor.go", false},
+		{"docs/", "docs/guide/intro.md", true},
+		{"docs/", "docsite/index.md", false},
+		{"./go.mod", "go.mod", true},
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPath(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
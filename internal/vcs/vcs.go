@@ -0,0 +1,95 @@
+// Package vcs provides the version-control queries Foundry needs, implemented
+// by shelling out to git.
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// ChangedFiles returns the slash-separated paths under dir, relative to dir,
+// that differ between the merge base of ref and HEAD and the current working
+// tree. Untracked files that are not ignored count as changed, and renames
+// are reported under both their old and new names.
+func ChangedFiles(dir, ref string) ([]string, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("changed files: ref is empty")
+	}
+
+	base, err := git(dir, "merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("changed files: resolve %q: %w", ref, err)
+	}
+
+	diff, err := git(dir, "diff", "--name-only", "--no-renames", "--relative", strings.TrimSpace(base))
+	if err != nil {
+		return nil, fmt.Errorf("changed files: %w", err)
+	}
+
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("changed files: list untracked: %w", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(diff+untracked, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// Info describes the commit checked out in a working tree.
+type Info struct {
+	SHA      string
+	ShortSHA string
+	Branch   string // "" when HEAD is detached
+	Tag      string // a tag pointing at HEAD, or ""
+	Dirty    bool   // uncommitted changes, including untracked files
+}
+
+// Describe returns the commit checked out in the working tree at dir.
+func Describe(dir string) (Info, error) {
+	sha, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return Info{}, fmt.Errorf("describe: %w", err)
+	}
+	info := Info{SHA: strings.TrimSpace(sha)}
+	if short, err := git(dir, "rev-parse", "--short", "HEAD"); err == nil {
+		info.ShortSHA = strings.TrimSpace(short)
+	}
+	if branch, err := git(dir, "symbolic-ref", "-q", "--short", "HEAD"); err == nil {
+		info.Branch = strings.TrimSpace(branch)
+	}
+	if tag, err := git(dir, "describe", "--tags", "--exact-match", "HEAD"); err == nil {
+		info.Tag = strings.TrimSpace(tag)
+	}
+	status, err := git(dir, "status", "--porcelain")
+	if err != nil {
+		return Info{}, fmt.Errorf("describe: %w", err)
+	}
+	info.Dirty = strings.TrimSpace(status) != ""
+	return info, nil
+}
+
+// git runs a git subcommand in dir and returns its stdout. Stderr is folded
+// into the error.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,118 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a throwaway git repository with one commit containing the
+// given files.
+func initRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	run("init", "-q", "-b", "main")
+	for name, content := range files {
+		writeFile(t, dir, name, content)
+	}
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestChangedFiles verifies that modified, deleted and untracked files are reported.
+func TestChangedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := initRepo(t, map[string]string{
+		"go.mod":          "module x",
+		"docs/index.md":   "docs",
+		"internal/a/a.go": "package a",
+	})
+
+	writeFile(t, dir, "internal/a/a.go", "package a // changed")
+	writeFile(t, dir, "internal/b/b.go", "package b")
+	if err := os.Remove(filepath.Join(dir, "docs", "index.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ChangedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("ChangedFiles failed: %v", err)
+	}
+
+	want := []string{"docs/index.md", "internal/a/a.go", "internal/b/b.go"}
+	if !slices.Equal(files, want) {
+		t.Errorf("expected %v, got %v", want, files)
+	}
+}
+
+// TestChangedFiles_BadRef verifies that an unknown ref is reported as an error.
+func TestChangedFiles_BadRef(t *testing.T) {
+	t.Parallel()
+
+	dir := initRepo(t, map[string]string{"go.mod": "module x"})
+
+	if _, err := ChangedFiles(dir, "no-such-branch"); err == nil {
+		t.Fatal("expected error for unknown ref, got nil")
+	}
+}
+
+// TestDescribe verifies the commit, branch, tag and dirty state reported.
+func TestDescribe(t *testing.T) {
+	t.Parallel()
+
+	dir := initRepo(t, map[string]string{"go.mod": "module x"})
+	if out, err := exec.Command("git", "-C", dir, "tag", "v1.0.0").CombinedOutput(); err != nil {
+		t.Fatalf("git tag: %v\n%s", err, out)
+	}
+
+	info, err := Describe(dir)
+	if err != nil {
+		t.Fatalf("Describe failed: %v", err)
+	}
+	if len(info.SHA) != 40 || !strings.HasPrefix(info.SHA, info.ShortSHA) || info.ShortSHA == "" {
+		t.Errorf("unexpected commit %q (short %q)", info.SHA, info.ShortSHA)
+	}
+	if info.Branch != "main" || info.Tag != "v1.0.0" || info.Dirty {
+		t.Errorf("expected clean main at v1.0.0, got %+v", info)
+	}
+
+	writeFile(t, dir, "new.go", "package x")
+	if info, err = Describe(dir); err != nil || !info.Dirty {
+		t.Errorf("expected a dirty tree, got %+v, %v", info, err)
+	}
+
+	if _, err := Describe(t.TempDir()); err == nil {
+		t.Error("expected an error outside a repository")
+	}
+}
@@ -0,0 +1,171 @@
+//go:build linux
+
+package watch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotify watches every directory under root. Directories created later are
+// added as their creation events arrive.
+type inotify struct {
+	root   string
+	file   *os.File
+	fd     int
+	mu     sync.Mutex
+	dirs   map[int32]string // watch descriptor -> directory relative to root
+	events chan string
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newNotifyBackend(root string) (backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+
+	n := &inotify{
+		root: root,
+		// A non-blocking fd is registered with the runtime poller, so Close
+		// unblocks a pending Read.
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		dirs:   map[int32]string{},
+		events: make(chan string, 64),
+		stop:   make(chan struct{}),
+	}
+
+	if _, err := n.addTree("."); err != nil {
+		_ = n.file.Close()
+		return nil, err
+	}
+
+	go n.readLoop()
+	return n, nil
+}
+
+func (n *inotify) Events() <-chan string {
+	return n.events
+}
+
+func (n *inotify) Close() error {
+	n.once.Do(func() { close(n.stop) })
+	return n.file.Close()
+}
+
+func (n *inotify) send(rel string) {
+	select {
+	case n.events <- rel:
+	case <-n.stop:
+	}
+}
+
+// addTree watches dir and every directory below it, returning the files
+// found so that ones created before their directory was watched are not lost.
+func (n *inotify) addTree(dir string) ([]string, error) {
+	var files []string
+	start := filepath.Join(n.root, dir)
+	err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == start {
+				return err
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(n.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !d.IsDir() {
+			files = append(files, rel)
+			return nil
+		}
+		if path != n.root && slices.Contains(skipDirs, d.Name()) {
+			return filepath.SkipDir
+		}
+
+		wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+		if err != nil {
+			return fmt.Errorf("inotify watch %q: %w", rel, err)
+		}
+		n.mu.Lock()
+		n.dirs[int32(wd)] = rel
+		n.mu.Unlock()
+		return nil
+	})
+	return files, err
+}
+
+func (n *inotify) readLoop() {
+	defer close(n.events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= count; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			nameStart := off + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+nameLen]), "\x00")
+			off = nameStart + nameLen
+
+			n.handle(wd, mask, name)
+		}
+	}
+}
+
+func (n *inotify) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		slog.Warn("inotify queue overflow, some changes may be missed")
+		return
+	}
+
+	n.mu.Lock()
+	dir, ok := n.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.dirs, wd)
+	}
+	n.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+
+	rel := filepath.ToSlash(filepath.Join(dir, name))
+
+	if mask&syscall.IN_ISDIR != 0 {
+		if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 || slices.Contains(skipDirs, name) {
+			return
+		}
+		files, err := n.addTree(rel)
+		if err != nil {
+			slog.Warn("failed to watch new directory", "dir", rel, "error", err)
+		}
+		for _, f := range files {
+			n.send(f)
+		}
+		return
+	}
+
+	n.send(rel)
+}
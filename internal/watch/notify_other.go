@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watch
+
+import "fmt"
+
+func newNotifyBackend(string) (backend, error) {
+	return nil, fmt.Errorf("native file notifications are only supported on linux")
+}
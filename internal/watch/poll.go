@@ -0,0 +1,133 @@
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// fileState is what the poller compares between scans.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// poller is the portable backend: it rescans the tree on an interval and
+// reports files that appeared, disappeared or changed size or mtime.
+type poller struct {
+	root     string
+	interval time.Duration
+	match    func(rel string) bool
+	events   chan string
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func newPoller(root string, interval time.Duration, match func(string) bool) (*poller, error) {
+	p := &poller{
+		root:     root,
+		interval: interval,
+		match:    match,
+		events:   make(chan string),
+		stop:     make(chan struct{}),
+	}
+
+	snap, err := p.scan()
+	if err != nil {
+		return nil, fmt.Errorf("initial scan: %w", err)
+	}
+
+	go p.loop(snap)
+	return p, nil
+}
+
+func (p *poller) Events() <-chan string {
+	return p.events
+}
+
+func (p *poller) Close() error {
+	p.once.Do(func() { close(p.stop) })
+	return nil
+}
+
+func (p *poller) loop(prev map[string]fileState) {
+	defer close(p.events)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+
+		next, err := p.scan()
+		if err != nil {
+			// Transient errors (e.g. a directory removed mid-walk) are
+			// retried on the next tick.
+			continue
+		}
+
+		for rel, st := range next {
+			if old, ok := prev[rel]; !ok || old != st {
+				if !p.send(rel) {
+					return
+				}
+			}
+		}
+		for rel := range prev {
+			if _, ok := next[rel]; !ok {
+				if !p.send(rel) {
+					return
+				}
+			}
+		}
+		prev = next
+	}
+}
+
+func (p *poller) send(rel string) bool {
+	select {
+	case p.events <- rel:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+func (p *poller) scan() (map[string]fileState, error) {
+	snap := map[string]fileState{}
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != p.root && slices.Contains(skipDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !p.match(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed between listing and stat
+		}
+		snap[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return snap, err
+}
@@ -0,0 +1,171 @@
+// Package watch detects changes to the files declared as step inputs so that
+// affected steps can be re-run during local development.
+package watch
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/plan"
+	"github.com/foundry-ci/foundry/internal/util"
+)
+
+// Options configures a Watcher.
+type Options struct {
+	Root         string        // Directory watched recursively (default ".")
+	Patterns     []string      // Globs relative to Root; only matching paths are reported
+	Debounce     time.Duration // Quiet period before a batch is emitted (default 300ms)
+	PollInterval time.Duration // Scan interval for the polling backend (default 500ms)
+	Poll         bool          // Force the polling backend even where inotify is available
+}
+
+// Watcher reports debounced batches of changed files.
+type Watcher struct {
+	opts    Options
+	be      backend
+	mode    string
+	changes chan []string
+	done    chan struct{}
+}
+
+// backend produces raw change notifications as slash-separated paths
+// relative to the watched root.
+type backend interface {
+	Events() <-chan string
+	Close() error
+}
+
+// skipDirs are never descended into: VCS metadata and anvil's own output
+// would otherwise trigger a re-run after every run.
+var skipDirs = []string{".git", ".foundry"}
+
+// New starts watching opts.Root. It uses inotify on Linux and falls back to
+// polling elsewhere or when inotify cannot be initialised.
+func New(opts Options) (*Watcher, error) {
+	if len(opts.Patterns) == 0 {
+		return nil, fmt.Errorf("watch: no patterns to watch")
+	}
+	if opts.Root == "" {
+		opts.Root = "."
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 300 * time.Millisecond
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 500 * time.Millisecond
+	}
+
+	root, err := filepath.Abs(opts.Root)
+	if err != nil {
+		return nil, fmt.Errorf("watch: resolve root: %w", err)
+	}
+	opts.Root = root
+
+	w := &Watcher{
+		opts:    opts,
+		changes: make(chan []string),
+		done:    make(chan struct{}),
+	}
+
+	if !opts.Poll {
+		be, err := newNotifyBackend(root)
+		if err != nil {
+			slog.Warn("inotify unavailable, falling back to polling", "error", err)
+		} else {
+			w.be, w.mode = be, "inotify"
+		}
+	}
+	if w.be == nil {
+		be, err := newPoller(root, opts.PollInterval, w.matches)
+		if err != nil {
+			return nil, fmt.Errorf("watch: %w", err)
+		}
+		w.be, w.mode = be, "poll"
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+// Mode returns the active backend: "inotify" or "poll".
+func (w *Watcher) Mode() string {
+	return w.mode
+}
+
+// Changes returns the channel of debounced, sorted batches of changed paths.
+// It is closed when the watcher stops.
+func (w *Watcher) Changes() <-chan []string {
+	return w.changes
+}
+
+// Close stops the watcher and releases its resources.
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.be.Close()
+}
+
+func (w *Watcher) matches(rel string) bool {
+	for _, pattern := range w.opts.Patterns {
+		if util.MatchPath(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) loop() {
+	defer close(w.changes)
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	for {
+		select {
+		case rel, ok := <-w.be.Events():
+			if !ok {
+				return
+			}
+			if !w.matches(rel) {
+				continue
+			}
+			pending[rel] = true
+			timer.Reset(w.opts.Debounce)
+
+		case <-timer.C:
+			batch := make([]string, 0, len(pending))
+			for rel := range pending {
+				batch = append(batch, rel)
+			}
+			slices.Sort(batch)
+			pending = map[string]bool{}
+
+			select {
+			case w.changes <- batch:
+			case <-w.done:
+				return
+			}
+
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Affected returns the IDs of steps whose inputs match any changed path, in
+// plan step order.
+func Affected(steps []plan.Step, changed []string) []string {
+	var ids []string
+	for _, step := range steps {
+		for _, input := range step.Inputs {
+			if slices.ContainsFunc(changed, func(rel string) bool { return util.MatchPath(input, rel) }) {
+				ids = append(ids, step.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/foundry-ci/foundry/internal/plan"
+)
+
+// waitForBatch returns the first batch from w or fails the test after a timeout.
+func waitForBatch(t *testing.T, w *Watcher) []string {
+	t.Helper()
+
+	select {
+	case batch, ok := <-w.Changes():
+		if !ok {
+			t.Fatal("watcher closed unexpectedly")
+		}
+		return batch
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changes")
+		return nil
+	}
+}
+
+// TestWatcher verifies that both backends report matching changes in debounced
+// batches and ignore non-matching files.
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	for _, poll := range []bool{false, true} {
+		name := "native"
+		if poll {
+			name = "poll"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "src"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := New(Options{
+				Root:         root,
+				Patterns:     []string{"src/**/*.go"},
+				Debounce:     50 * time.Millisecond,
+				PollInterval: 20 * time.Millisecond,
+				Poll:         poll,
+			})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer func() { _ = w.Close() }()
+
+			// Let the poller take its baseline before writing.
+			time.Sleep(50 * time.Millisecond)
+
+			if err := os.WriteFile(filepath.Join(root, "README.md"), []byte("ignored"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Join(root, "src", "pkg"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "src", "pkg", "a.go"), []byte("package pkg"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			batch := waitForBatch(t, w)
+			if !slices.Equal(batch, []string{"src/pkg/a.go"}) {
+				t.Errorf("expected batch [src/pkg/a.go], got %v", batch)
+			}
+		})
+	}
+}
+
+// TestAffected verifies that steps are selected by their declared inputs.
+func TestAffected(t *testing.T) {
+	t.Parallel()
+
+	steps := []plan.Step{
+		{ID: "lint", Inputs: []string{"**/*.go"}},
+		{ID: "docs", Inputs: []string{"docs/"}},
+		{ID: "test", Inputs: []string{"internal/**/*.go", "go.mod"}},
+		{ID: "package"},
+	}
+
+	got := Affected(steps, []string{"go.mod"})
+	if !slices.Equal(got, []string{"test"}) {
+		t.Errorf("expected [test], got %v", got)
+	}
+
+	got = Affected(steps, []string{"internal/exec/executor.go", "docs/index.md"})
+	if !slices.Equal(got, []string{"lint", "docs", "test"}) {
+		t.Errorf("expected [lint docs test], got %v", got)
+	}
+}
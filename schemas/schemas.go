@@ -0,0 +1,10 @@
+// Package schemas embeds the JSON Schemas of Foundry's file formats, for
+// validating them in-process.
+package schemas
+
+import _ "embed"
+
+// Config is the JSON Schema of .foundry.yaml.
+//
+//go:embed foundry-config.schema.json
+var Config []byte